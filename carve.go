@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/KarmaPenny/pdfparser/pdf"
+	"os"
+)
+
+func carveUsage() {
+	fmt.Fprintln(os.Stderr, "PDF Parser - Finds PDF files in arbitrary data such as memory dumps and disk images")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Usage: pdfparser carve [OPTION]... [FILE]")
+	fmt.Fprintln(os.Stderr, "Example: pdfparser carve -o carved/ memory.dmp")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "  -json     write the carved PDF files as json")
+	fmt.Fprintln(os.Stderr, "  -o        output directory for the carved PDF files (default: list only)")
+	fmt.Fprintln(os.Stderr, "  -p        decryption password")
+}
+
+func carve(args []string) {
+	// parse command line
+	flags := flag.NewFlagSet("carve", flag.ExitOnError)
+	json_output := flags.Bool("json", false, "write the carved pdf files as json")
+	output_dir := flags.String("o", "", "output directory")
+	password := flags.String("p", "", "decryption password")
+	flags.Usage = carveUsage
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		carveUsage()
+		os.Exit(1)
+	}
+
+	// carve the pdfs
+	carved, err := pdf.Carve(flags.Arg(0), *password, *output_dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// write the carved pdfs as json
+	if *json_output {
+		data, _ := json.MarshalIndent(carved, "", "\t")
+		fmt.Println(string(data))
+		return
+	}
+
+	// list the carved pdfs: start offset, end offset, %%EOF count, whether it is truncated, whether it parsed and the error if it did not
+	for _, carved_pdf := range carved {
+		fmt.Printf("%d:%d:%d:%t:%t:%s\n", carved_pdf.Start, carved_pdf.End, carved_pdf.EOFCount, carved_pdf.Truncated, carved_pdf.Parsed, carved_pdf.Error)
+	}
+}
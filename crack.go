@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/KarmaPenny/pdfparser/pdf"
+	"os"
+	"runtime"
+	"strings"
+)
+
+func crackUsage() {
+	fmt.Fprintln(os.Stderr, "PDF Parser - Guesses the password of an encrypted PDF file")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Usage: pdfparser crack [OPTION]... [FILE] [WORDLIST]")
+	fmt.Fprintln(os.Stderr, "Example: pdfparser crack -r case,digits,years -s session.txt input.pdf words.txt")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "  -r        comma separated mangling rules: case, digits, years")
+	fmt.Fprintln(os.Stderr, "  -s        session file used to resume an interrupted run with the same inputs")
+	fmt.Fprintln(os.Stderr, "  -t        number of threads (default: number of CPUs)")
+}
+
+func crack(args []string) {
+	// parse command line
+	flags := flag.NewFlagSet("crack", flag.ExitOnError)
+	rules := flags.String("r", "", "comma separated mangling rules")
+	session := flags.String("s", "", "session file")
+	threads := flags.Int("t", runtime.NumCPU(), "number of threads")
+	flags.Usage = crackUsage
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		crackUsage()
+		os.Exit(1)
+	}
+
+	// split rules, an unknown rule would silently weaken the attack
+	rule_list := []string{}
+	if *rules != "" {
+		rule_list = strings.Split(*rules, ",")
+	}
+	for _, rule := range rule_list {
+		if rule != pdf.CrackRuleCase && rule != pdf.CrackRuleDigits && rule != pdf.CrackRuleYears {
+			fmt.Fprintf(os.Stderr, "unknown rule: %s\n", rule)
+			crackUsage()
+			os.Exit(1)
+		}
+	}
+
+	// crack the password
+	password, password_type, err := pdf.Crack(flags.Arg(0), flags.Arg(1), rule_list, *threads, *session, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("%s:%s\n", password_type, password)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/KarmaPenny/pdfparser/pdf"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func diffUsage() {
+	fmt.Fprintln(os.Stderr, "PDF Parser - Compares the objects of two PDF files or two revisions of a PDF file")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Usage: pdfparser diff [OPTION]... [OLD FILE] [NEW FILE]")
+	fmt.Fprintln(os.Stderr, "   or: pdfparser diff [OPTION]... [FILE]")
+	fmt.Fprintln(os.Stderr, "Example: pdfparser diff -r 0,2 input.pdf")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "  -json     write the diff as json")
+	fmt.Fprintln(os.Stderr, "  -p        decryption password")
+	fmt.Fprintln(os.Stderr, "  -r        comma separated old and new revision of FILE (default: the last two)")
+}
+
+func diff(args []string) {
+	// parse command line
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	json_output := flags.Bool("json", false, "write the diff as json")
+	password := flags.String("p", "", "decryption password")
+	revision_range := flags.String("r", "", "comma separated old and new revision")
+	flags.Usage = diffUsage
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 || (flags.NArg() == 2 && *revision_range != "") {
+		diffUsage()
+		os.Exit(1)
+	}
+
+	// compare two files or two revisions of one file
+	var result *pdf.Diff
+	var err error
+	if flags.NArg() == 2 {
+		result, err = pdf.DiffFiles(flags.Arg(0), flags.Arg(1), *password)
+	} else {
+		var old_revision, new_revision int
+		if old_revision, new_revision, err = revisionRange(flags.Arg(0), *revision_range); err == nil {
+			result, err = pdf.DiffRevisions(flags.Arg(0), *password, old_revision, new_revision)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// write the diff as json
+	if *json_output {
+		data, _ := json.MarshalIndent(result, "", "\t")
+		fmt.Println(string(data))
+		return
+	}
+
+	// write the diff as text
+	for _, number := range result.Added {
+		fmt.Printf("added:%d\n", number)
+	}
+	for _, number := range result.Removed {
+		fmt.Printf("removed:%d\n", number)
+	}
+	for _, change := range result.Changed {
+		for _, value := range change.Values {
+			fmt.Printf("changed:%d:/%s:%s:%s\n", change.Object, strings.Join(value.Path, "/"), value.Old, value.New)
+		}
+		for _, line := range change.Stream {
+			fmt.Printf("stream:%d:%s\n", change.Object, line)
+		}
+	}
+}
+
+// revisionRange parses the old and new revision option, the default is the last two revisions
+func revisionRange(file_path string, revision_range string) (int, int, error) {
+	if revision_range != "" {
+		revisions := strings.Split(revision_range, ",")
+		if len(revisions) != 2 {
+			diffUsage()
+			os.Exit(1)
+		}
+		old_revision, err := strconv.Atoi(revisions[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		new_revision, err := strconv.Atoi(revisions[1])
+		return old_revision, new_revision, err
+	}
+
+	// count the revisions
+	file, err := os.Open(file_path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	count := len(pdf.NewParser(file, nil).Revisions())
+	if count < 2 {
+		return 0, 0, pdf.RevisionNotFoundError
+	}
+	return count - 2, count - 1, nil
+}
@@ -1,27 +1,51 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/KarmaPenny/pdfparser/pdf"
 	"os"
 )
 
+var certificate *string
+var encryption_key *string
+var json_output *bool
+var max_document *int64
+var max_ratio *float64
+var max_stream *int64
 var overwrite *bool
 var password *string
+var private_key *string
+var uncovered *bool
 
 func usage() {
 	fmt.Fprintln(os.Stderr, "PDF Parser - Decrypts a PDF file and extracts contents")
 	fmt.Fprintln(os.Stderr, "<https://github.com/KarmaPenny/pdfparser>")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Usage: pdfparser [OPTION]... [FILE] [DIRECTORY]")
+	fmt.Fprintln(os.Stderr, "   or: pdfparser COMMAND [OPTION]... [ARGS]...")
 	fmt.Fprintln(os.Stderr, "Example: pdfparser -v -f -p password input.pdf output/")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "  -c        recipient certificate file (PEM or DER)")
+	fmt.Fprintln(os.Stderr, "  -e        hex encoded file encryption key")
 	fmt.Fprintln(os.Stderr, "  -f        overwrite output directory")
+	fmt.Fprintln(os.Stderr, "  -json     write the report to stdout, DIRECTORY is optional")
+	fmt.Fprintln(os.Stderr, "  -k        recipient private key file (PEM or DER)")
+	fmt.Fprintln(os.Stderr, "  -maxdoc   maximum decoded size of all streams in MiB, 0 for no limit")
+	fmt.Fprintln(os.Stderr, "  -maxratio maximum decoded to encoded size ratio of a stream, 0 for no limit")
+	fmt.Fprintln(os.Stderr, "  -maxsize  maximum decoded size of a stream in MiB, 0 for no limit")
 	fmt.Fprintln(os.Stderr, "  -p        decryption password")
+	fmt.Fprintln(os.Stderr, "  -u        dump data that does not belong to any object to the output directory")
 	fmt.Fprintln(os.Stderr, "  -v        display verbose messages")
 	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  carve     find PDF files in arbitrary data")
+	fmt.Fprintln(os.Stderr, "  crack     guess the password of an encrypted PDF file")
+	fmt.Fprintln(os.Stderr, "  diff      compare two PDF files or two revisions of a PDF file")
+	fmt.Fprintln(os.Stderr, "  revisions list or extract the incremental updates of a PDF file")
+	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Copyright (C) 2019 Cole Robinette")
 	fmt.Fprintln(os.Stderr, "This program is free to use, redistribute, and modify under")
 	fmt.Fprintln(os.Stderr, "the terms of the GNU General Public License version 3. This")
@@ -30,26 +54,117 @@ func usage() {
 }
 
 func init() {
+	certificate = flag.String("c", "", "recipient certificate file for public-key encryption")
+	encryption_key = flag.String("e", "", "hex encoded file encryption key, used instead of a password")
+	json_output = flag.Bool("json", false, "write report.json to stdout")
+	max_document = flag.Int64("maxdoc", pdf.DefaultDecodeLimits.MaxDocumentSize >> 20, "maximum decoded size of all streams in MiB, 0 for no limit")
+	max_ratio = flag.Float64("maxratio", pdf.DefaultDecodeLimits.MaxRatio, "maximum decoded to encoded size ratio of a stream, 0 for no limit")
+	max_stream = flag.Int64("maxsize", pdf.DefaultDecodeLimits.MaxStreamSize >> 20, "maximum decoded size of a stream in MiB, 0 for no limit")
 	overwrite = flag.Bool("f", false, "overwrite of output directory if it already exists")
 	password = flag.String("p", "", "encryption password (default: empty)")
+	private_key = flag.String("k", "", "recipient private key file for public-key encryption")
+	uncovered = flag.Bool("u", false, "dump uncovered regions to the output directory")
 	pdf.Verbose = flag.Bool("v", false, "display verbose messages")
 	flag.Usage = usage
+}
+
+// commands maps sub command names to their entry points
+var commands = map[string]func([]string){
+	"carve": carve,
+	"crack": crack,
+	"diff": diff,
+	"revisions": revisions,
+}
+
+func main() {
+	// run sub command
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	// parse command line
 	flag.Parse()
-	if flag.NArg() != 2 {
+	if flag.NArg() != 2 && !(*json_output && flag.NArg() == 1) {
 		usage()
 		os.Exit(1)
 	}
-}
+	input_file := flag.Arg(0)
+	output_dir := flag.Arg(1)
 
-func main() {
 	// check if output directory already exists
-	if _, err := os.Stat(flag.Arg(1)); !os.IsNotExist(err) && !*overwrite {
-		fmt.Printf("output directory \"%s\" already exists, use -f to overwrite\n", flag.Arg(1))
+	if output_dir != "" {
+		if _, err := os.Stat(output_dir); !os.IsNotExist(err) && !*overwrite {
+			fmt.Printf("output directory \"%s\" already exists, use -f to overwrite\n", output_dir)
+			return
+		}
+	}
+
+	// open the pdf
+	file, err := os.Open(input_file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 		return
 	}
+	defer file.Close()
+
+	// write to the output directory and keep the report in memory for stdout
+	sinks := pdf.NewMultiSink()
+	if output_dir != "" {
+		os.RemoveAll(output_dir)
+		directory_sink, err := pdf.NewDirectorySink(output_dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		directory_sink.DumpUncovered = *uncovered
+		sinks = append(sinks, directory_sink)
+	}
+	memory_sink := pdf.NewMemorySink()
+	if *json_output {
+		sinks = append(sinks, memory_sink)
+	}
+	parser := pdf.NewParser(file, sinks)
+	parser.DecodeLimits = pdf.DecodeLimits{MaxStreamSize: *max_stream << 20, MaxDocumentSize: *max_document << 20, MaxRatio: *max_ratio}
+
+	// use a known file encryption key
+	if *encryption_key != "" {
+		key, err := pdf.ParseEncryptionKey(*encryption_key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		parser.SecurityHandler().SetEncryptionKey(key)
+	}
+
+	// load the recipient certificate and private key
+	if *certificate != "" || *private_key != "" {
+		cert, err := pdf.ReadCertificate(*certificate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		key, err := pdf.ReadPrivateKey(*private_key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		parser.SecurityHandler().SetCertificate(cert, key)
+	}
 
 	// parse the pdf
-	if err := pdf.Parse(flag.Arg(0), *password, flag.Arg(1)); err != nil {
+	if err := parser.Extract(*password); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	if err := sinks.Close(); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 	}
+
+	// write the report to stdout
+	if *json_output {
+		report, _ := json.MarshalIndent(memory_sink.Result().Report, "", "\t")
+		fmt.Println(string(report))
+	}
 }
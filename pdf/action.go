@@ -1,12 +1,8 @@
 package pdf
 
-import (
-	"fmt"
-)
-
 type Action Dictionary
 
-func (a Action) Extract(output *Output) {
+func (a Action) Extract(sink Sink, location Location) {
 	d := Dictionary(a)
 
 	isCommand := false
@@ -16,11 +12,11 @@ func (a Action) Extract(output *Output) {
 
 	// filespecification can be in either F or Win[F]
 	if f, ok := d.GetString("F"); ok {
-		fmt.Fprintf(output.Files, "%s:%s\n", unknownHash, f)
+		sink.WriteFileName(f, location.child("F"))
 	} else if f, ok := d.GetDictionary("F"); ok {
-		File(f).Extract(output, isCommand)
+		File(f).Extract(sink, location.child("F"), isCommand)
 	}
 	if win, ok := d.GetDictionary("Win"); ok {
-		File(win).Extract(output, isCommand)
+		File(win).Extract(sink, location.child("Win"), isCommand)
 	}
 }
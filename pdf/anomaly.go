@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+)
+
+// number of bytes before and after an anomaly included in its context
+var anomaly_context_size int64 = 16
+
+// AnomalyType is a kind of format error or abnormality, the code never changes
+type AnomalyType struct {
+	Code string
+	Message string
+	Severity string
+}
+
+// withDetail returns the anomaly type with details of a single anomaly added to the message
+func (anomaly_type AnomalyType) withDetail(format string, args ...interface{}) AnomalyType {
+	anomaly_type.Message = fmt.Sprintf("%s (%s)", anomaly_type.Message, fmt.Sprintf(format, args...))
+	return anomaly_type
+}
+
+// Anomaly is a format error or abnormality found while parsing
+// context is the bytes around the anomaly with unprintable bytes replaced by dots
+// count is the number of times the anomaly was found at the same location with the same message
+type Anomaly struct {
+	Code string `json:"code"`
+	Message string `json:"message"`
+	Severity string `json:"severity"`
+	Location
+	Context string `json:"context"`
+	Count int `json:"count"`
+}
+
+func NewAnomaly(anomaly_type AnomalyType, location Location, context string) Anomaly {
+	return Anomaly{anomaly_type.Code, anomaly_type.Message, anomaly_type.Severity, location.copy(), context, 1}
+}
+
+// String formats the anomaly as a line of errors.txt
+func (anomaly Anomaly) String() string {
+	return fmt.Sprintf("%s:%s:%d:%d:%d:%d:%s:%s", anomaly.Severity, anomaly.Code, anomaly.Offset, anomaly.Object, anomaly.Generation, anomaly.Count, anomaly.Message, anomaly.Context)
+}
+
+// key identifies anomalies of the same type and details found at the same location
+func (anomaly Anomaly) key() string {
+	return fmt.Sprintf("%s:%d:%d:%d:%d:%s", anomaly.Code, anomaly.Object, anomaly.Generation, anomaly.ObjectStream, anomaly.Offset, anomaly.Message)
+}
+
+// anomalyContext returns the bytes around offset with unprintable bytes replaced by dots
+func (parser *Parser) anomalyContext(offset int64) string {
+	// read without moving the parser
+	reader_at, ok := parser.seeker.(io.ReaderAt)
+	if !ok {
+		return ""
+	}
+	start := offset - anomaly_context_size
+	if start < 0 {
+		start = 0
+	}
+	data := make([]byte, offset + anomaly_context_size - start)
+	bytes_read, _ := reader_at.ReadAt(data, start)
+	data = data[:bytes_read]
+
+	// replace unprintable bytes
+	for i := range data {
+		if data[i] < 0x20 || data[i] > 0x7e {
+			data[i] = '.'
+		}
+	}
+	return string(data)
+}
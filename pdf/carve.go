@@ -0,0 +1,125 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+)
+
+var carve_header_regexp = regexp.MustCompile(`%PDF-\d`)
+
+// CarvedPDF is a pdf found in arbitrary data
+// end is just past the end of line after the last %%EOF marker of the pdf, including incremental updates
+// truncated is true if no %%EOF marker was found, in which case end is the start of the next pdf or the end of the data
+// parsed is true if the pdf loads and has a catalog, otherwise error is why it did not
+type CarvedPDF struct {
+	Start int64 `json:"start"`
+	End int64 `json:"end"`
+	EOFCount int `json:"eof_count"`
+	Truncated bool `json:"truncated"`
+	Parsed bool `json:"parsed"`
+	Objects int `json:"objects"`
+	Error string `json:"error,omitempty"`
+}
+
+// Carve finds the pdfs in a file and writes each to carved_START.pdf in the output directory, nothing is written if the output directory is empty
+func Carve(file_path string, password string, output_dir string) ([]*CarvedPDF, error) {
+	// open the file
+	file, err := os.Open(file_path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// find the pdfs
+	carved := CarveReader(file, password)
+	if output_dir == "" {
+		return carved, nil
+	}
+
+	// write each pdf to the output directory
+	if err = os.MkdirAll(output_dir, 0755); err != nil {
+		return nil, err
+	}
+	for _, carved_pdf := range carved {
+		output, err := os.Create(path.Join(output_dir, fmt.Sprintf("carved_%d.pdf", carved_pdf.Start)))
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(output, io.NewSectionReader(file, carved_pdf.Start, carved_pdf.End - carved_pdf.Start))
+		output.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return carved, nil
+}
+
+// CarveReader finds the pdfs in the data read from reader and loads each one to check that it parses
+// a pdf ends at its last %%EOF marker before the first header that follows one of its %%EOF markers
+// so pdfs embedded in a pdf do not end the pdf that contains them
+func CarveReader(reader io.ReadSeeker, password string) []*CarvedPDF {
+	carved := []*CarvedPDF{}
+
+	// find every header and end of file marker
+	scanner := NewParser(reader, nil)
+	size, _ := scanner.Seek(0, io.SeekEnd)
+	headers := scanner.findOffsets(carve_header_regexp)
+	eofs := scanner.findOffsets(eof_regexp)
+
+	for i, start := range headers {
+		carved_pdf := &CarvedPDF{start, size, 0, true, false, 0, ""}
+
+		// the pdf is bounded by the next header after its first %%EOF marker
+		bound := size
+		j := 0
+		for j < len(eofs) && eofs[j] < start {
+			j++
+		}
+		for k := i + 1; k < len(headers); k++ {
+			if j >= len(eofs) || headers[k] > eofs[j] {
+				bound = headers[k]
+				break
+			}
+		}
+
+		// the pdf ends at the last %%EOF marker before the bound
+		for ; j < len(eofs) && eofs[j] + 5 <= bound; j++ {
+			carved_pdf.EOFCount++
+			carved_pdf.End = scanner.eolEnd(eofs[j] + 5)
+			carved_pdf.Truncated = false
+		}
+		if carved_pdf.Truncated {
+			carved_pdf.End = bound
+		}
+
+		// load the pdf
+		section, err := scanner.sectionReader(carved_pdf.Start, carved_pdf.End - carved_pdf.Start)
+		if err == nil {
+			err = carveLoad(section, password, carved_pdf)
+		}
+		if err != nil {
+			carved_pdf.Error = err.Error()
+		}
+
+		carved = append(carved, carved_pdf)
+	}
+
+	return carved
+}
+
+// carveLoad loads a carved pdf and records the number of objects found
+func carveLoad(reader io.ReadSeeker, password string, carved_pdf *CarvedPDF) error {
+	parser := NewParser(reader, nil)
+	if err := parser.Load(password); err != nil {
+		return err
+	}
+	carved_pdf.Objects = len(parser.Xref)
+	if _, ok := parser.trailer.GetDictionary("Root"); !ok {
+		return MissingCatalogError
+	}
+	carved_pdf.Parsed = true
+	return nil
+}
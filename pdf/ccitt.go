@@ -0,0 +1,545 @@
+package pdf
+
+import (
+	"bytes"
+	"golang.org/x/image/ccitt"
+)
+
+// largest number of columns decoded, the same limit as the group 4 decoder
+var ccitt_max_columns = 1 << 20
+
+// ccittCode is the bits of a run length or mode code
+type ccittCode struct {
+	value int
+	bits string
+}
+
+// 2D modes, vertical modes are the offset of a1 from b1
+const (
+	ccittModePass = 100
+	ccittModeHorizontal = 101
+)
+
+var ccitt_mode_codes = []ccittCode{
+	ccittCode{ccittModePass, "0001"},
+	ccittCode{ccittModeHorizontal, "001"},
+	ccittCode{0, "1"},
+	ccittCode{1, "011"},
+	ccittCode{2, "000011"},
+	ccittCode{3, "0000011"},
+	ccittCode{-1, "010"},
+	ccittCode{-2, "000010"},
+	ccittCode{-3, "0000010"},
+}
+
+// makeup codes for runs of 1792 or more are shared by both colors
+var ccitt_extended_makeup_codes = []ccittCode{
+	ccittCode{1792, "00000001000"},
+	ccittCode{1856, "00000001100"},
+	ccittCode{1920, "00000001101"},
+	ccittCode{1984, "000000010010"},
+	ccittCode{2048, "000000010011"},
+	ccittCode{2112, "000000010100"},
+	ccittCode{2176, "000000010101"},
+	ccittCode{2240, "000000010110"},
+	ccittCode{2304, "000000010111"},
+	ccittCode{2368, "000000011100"},
+	ccittCode{2432, "000000011101"},
+	ccittCode{2496, "000000011110"},
+	ccittCode{2560, "000000011111"},
+}
+
+var ccitt_white_codes = append([]ccittCode{
+	ccittCode{0, "00110101"},
+	ccittCode{1, "000111"},
+	ccittCode{2, "0111"},
+	ccittCode{3, "1000"},
+	ccittCode{4, "1011"},
+	ccittCode{5, "1100"},
+	ccittCode{6, "1110"},
+	ccittCode{7, "1111"},
+	ccittCode{8, "10011"},
+	ccittCode{9, "10100"},
+	ccittCode{10, "00111"},
+	ccittCode{11, "01000"},
+	ccittCode{12, "001000"},
+	ccittCode{13, "000011"},
+	ccittCode{14, "110100"},
+	ccittCode{15, "110101"},
+	ccittCode{16, "101010"},
+	ccittCode{17, "101011"},
+	ccittCode{18, "0100111"},
+	ccittCode{19, "0001100"},
+	ccittCode{20, "0001000"},
+	ccittCode{21, "0010111"},
+	ccittCode{22, "0000011"},
+	ccittCode{23, "0000100"},
+	ccittCode{24, "0101000"},
+	ccittCode{25, "0101011"},
+	ccittCode{26, "0010011"},
+	ccittCode{27, "0100100"},
+	ccittCode{28, "0011000"},
+	ccittCode{29, "00000010"},
+	ccittCode{30, "00000011"},
+	ccittCode{31, "00011010"},
+	ccittCode{32, "00011011"},
+	ccittCode{33, "00010010"},
+	ccittCode{34, "00010011"},
+	ccittCode{35, "00010100"},
+	ccittCode{36, "00010101"},
+	ccittCode{37, "00010110"},
+	ccittCode{38, "00010111"},
+	ccittCode{39, "00101000"},
+	ccittCode{40, "00101001"},
+	ccittCode{41, "00101010"},
+	ccittCode{42, "00101011"},
+	ccittCode{43, "00101100"},
+	ccittCode{44, "00101101"},
+	ccittCode{45, "00000100"},
+	ccittCode{46, "00000101"},
+	ccittCode{47, "00001010"},
+	ccittCode{48, "00001011"},
+	ccittCode{49, "01010010"},
+	ccittCode{50, "01010011"},
+	ccittCode{51, "01010100"},
+	ccittCode{52, "01010101"},
+	ccittCode{53, "00100100"},
+	ccittCode{54, "00100101"},
+	ccittCode{55, "01011000"},
+	ccittCode{56, "01011001"},
+	ccittCode{57, "01011010"},
+	ccittCode{58, "01011011"},
+	ccittCode{59, "01001010"},
+	ccittCode{60, "01001011"},
+	ccittCode{61, "00110010"},
+	ccittCode{62, "00110011"},
+	ccittCode{63, "00110100"},
+	ccittCode{64, "11011"},
+	ccittCode{128, "10010"},
+	ccittCode{192, "010111"},
+	ccittCode{256, "0110111"},
+	ccittCode{320, "00110110"},
+	ccittCode{384, "00110111"},
+	ccittCode{448, "01100100"},
+	ccittCode{512, "01100101"},
+	ccittCode{576, "01101000"},
+	ccittCode{640, "01100111"},
+	ccittCode{704, "011001100"},
+	ccittCode{768, "011001101"},
+	ccittCode{832, "011010010"},
+	ccittCode{896, "011010011"},
+	ccittCode{960, "011010100"},
+	ccittCode{1024, "011010101"},
+	ccittCode{1088, "011010110"},
+	ccittCode{1152, "011010111"},
+	ccittCode{1216, "011011000"},
+	ccittCode{1280, "011011001"},
+	ccittCode{1344, "011011010"},
+	ccittCode{1408, "011011011"},
+	ccittCode{1472, "010011000"},
+	ccittCode{1536, "010011001"},
+	ccittCode{1600, "010011010"},
+	ccittCode{1664, "011000"},
+	ccittCode{1728, "010011011"},
+}, ccitt_extended_makeup_codes...)
+
+var ccitt_black_codes = append([]ccittCode{
+	ccittCode{0, "0000110111"},
+	ccittCode{1, "010"},
+	ccittCode{2, "11"},
+	ccittCode{3, "10"},
+	ccittCode{4, "011"},
+	ccittCode{5, "0011"},
+	ccittCode{6, "0010"},
+	ccittCode{7, "00011"},
+	ccittCode{8, "000101"},
+	ccittCode{9, "000100"},
+	ccittCode{10, "0000100"},
+	ccittCode{11, "0000101"},
+	ccittCode{12, "0000111"},
+	ccittCode{13, "00000100"},
+	ccittCode{14, "00000111"},
+	ccittCode{15, "000011000"},
+	ccittCode{16, "0000010111"},
+	ccittCode{17, "0000011000"},
+	ccittCode{18, "0000001000"},
+	ccittCode{19, "00001100111"},
+	ccittCode{20, "00001101000"},
+	ccittCode{21, "00001101100"},
+	ccittCode{22, "00000110111"},
+	ccittCode{23, "00000101000"},
+	ccittCode{24, "00000010111"},
+	ccittCode{25, "00000011000"},
+	ccittCode{26, "000011001010"},
+	ccittCode{27, "000011001011"},
+	ccittCode{28, "000011001100"},
+	ccittCode{29, "000011001101"},
+	ccittCode{30, "000001101000"},
+	ccittCode{31, "000001101001"},
+	ccittCode{32, "000001101010"},
+	ccittCode{33, "000001101011"},
+	ccittCode{34, "000011010010"},
+	ccittCode{35, "000011010011"},
+	ccittCode{36, "000011010100"},
+	ccittCode{37, "000011010101"},
+	ccittCode{38, "000011010110"},
+	ccittCode{39, "000011010111"},
+	ccittCode{40, "000001101100"},
+	ccittCode{41, "000001101101"},
+	ccittCode{42, "000011011010"},
+	ccittCode{43, "000011011011"},
+	ccittCode{44, "000001010100"},
+	ccittCode{45, "000001010101"},
+	ccittCode{46, "000001010110"},
+	ccittCode{47, "000001010111"},
+	ccittCode{48, "000001100100"},
+	ccittCode{49, "000001100101"},
+	ccittCode{50, "000001010010"},
+	ccittCode{51, "000001010011"},
+	ccittCode{52, "000000100100"},
+	ccittCode{53, "000000110111"},
+	ccittCode{54, "000000111000"},
+	ccittCode{55, "000000100111"},
+	ccittCode{56, "000000101000"},
+	ccittCode{57, "000001011000"},
+	ccittCode{58, "000001011001"},
+	ccittCode{59, "000000101011"},
+	ccittCode{60, "000000101100"},
+	ccittCode{61, "000001011010"},
+	ccittCode{62, "000001100110"},
+	ccittCode{63, "000001100111"},
+	ccittCode{64, "0000001111"},
+	ccittCode{128, "000011001000"},
+	ccittCode{192, "000011001001"},
+	ccittCode{256, "000001011011"},
+	ccittCode{320, "000000110011"},
+	ccittCode{384, "000000110100"},
+	ccittCode{448, "000000110101"},
+	ccittCode{512, "0000001101100"},
+	ccittCode{576, "0000001101101"},
+	ccittCode{640, "0000001001010"},
+	ccittCode{704, "0000001001011"},
+	ccittCode{768, "0000001001100"},
+	ccittCode{832, "0000001001101"},
+	ccittCode{896, "0000001110010"},
+	ccittCode{960, "0000001110011"},
+	ccittCode{1024, "0000001110100"},
+	ccittCode{1088, "0000001110101"},
+	ccittCode{1152, "0000001110110"},
+	ccittCode{1216, "0000001110111"},
+	ccittCode{1280, "0000001010010"},
+	ccittCode{1344, "0000001010011"},
+	ccittCode{1408, "0000001010100"},
+	ccittCode{1472, "0000001010101"},
+	ccittCode{1536, "0000001011010"},
+	ccittCode{1600, "0000001011011"},
+	ccittCode{1664, "0000001100100"},
+	ccittCode{1728, "0000001100101"},
+}, ccitt_extended_makeup_codes...)
+
+var ccitt_mode_table = newCCITTTable(ccitt_mode_codes)
+var ccitt_white_table = newCCITTTable(ccitt_white_codes)
+var ccitt_black_table = newCCITTTable(ccitt_black_codes)
+
+// ccittTable maps the length and bits of each code to its value
+type ccittTable map[int]int
+
+func newCCITTTable(codes []ccittCode) ccittTable {
+	table := ccittTable{}
+	for _, code := range codes {
+		bits := 0
+		for _, c := range code.bits {
+			bits = bits << 1 | int(c - '0')
+		}
+		table[len(code.bits) << 16 | bits] = code.value
+	}
+	return table
+}
+
+// CCITTFaxDecode decodes group 3 and group 4 fax data to one bit per pixel rows
+// group 4 (K < 0) is decoded by golang.org/x/image/ccitt, which does not decode group 3 without end of line markers or mixed 1D and 2D rows (K > 0)
+func CCITTFaxDecode(data []byte, decode_parms Dictionary) []byte {
+	decoded_data, _, err := ccittFaxDecode(data, decode_parms, defaultMaxSize(data))
+	if err != nil && len(decoded_data) == 0 {
+		return data
+	}
+	return decoded_data
+}
+
+// ccittFaxDecode decodes fax data and returns the offset of the row where decoding stopped if it failed
+// zero bits after the last row are padding, not a row that failed, decoding stops once more than max_size bytes are decoded
+func ccittFaxDecode(data []byte, decode_parms Dictionary, max_size int64) ([]byte, int64, error) {
+	// get the decode parms using defaults when not found
+	k, _ := decode_parms.GetInt("K")
+	columns, ok := decode_parms.GetInt("Columns")
+	if !ok {
+		columns = 1728
+	}
+	rows, _ := decode_parms.GetInt("Rows")
+	encoded_byte_align, _ := decode_parms.GetBool("EncodedByteAlign")
+	black_is_1, _ := decode_parms.GetBool("BlackIs1")
+	end_of_block, ok := decode_parms.GetBool("EndOfBlock")
+	if !ok {
+		end_of_block = true
+	}
+
+	// make sure columns value is acceptable
+	if columns <= 0 || columns > ccitt_max_columns {
+		return nil, 0, FilterParmsError
+	}
+
+	// decode group 4
+	if k < 0 {
+		height := ccitt.AutoDetectHeight
+		if rows > 0 {
+			height = rows
+		}
+		byte_reader := bytes.NewReader(data)
+		reader := ccitt.NewReader(byte_reader, ccitt.MSB, ccitt.Group4, columns, height, &ccitt.Options{Align: encoded_byte_align, Invert: black_is_1})
+		decoded_data, err := readLimited(reader, max_size)
+		return decoded_data, int64(len(data) - byte_reader.Len()), err
+	}
+
+	// decode group 3 one row at a time
+	var decoded_data bytes.Buffer
+	decoder := &ccittDecoder{data, 0}
+	reference := []int{}
+	for row := 0; (rows <= 0 || row < rows) && decoder.position < len(data) * 8; row++ {
+		row_start := decoder.position
+
+		// rows may start with an end of line marker, otherwise they are aligned if encoded byte align is set
+		eol := decoder.readEOL()
+		if !eol && encoded_byte_align {
+			decoder.align()
+		}
+
+		// mixed rows have a tag bit after the end of line marker that is 0 if the row is 2D
+		two_d := false
+		if k > 0 {
+			bit, ok := decoder.readBit()
+			if !ok {
+				break
+			}
+			two_d = bit == 0
+		}
+
+		// consecutive end of line markers end the data
+		if eol && end_of_block && decoder.isEOL() {
+			break
+		}
+
+		// decode the row
+		var changes []int
+		if two_d {
+			changes, ok = decoder.decode2D(reference, columns)
+		} else {
+			changes, ok = decoder.decode1D(columns)
+		}
+		if !ok {
+			if decoder.isPadding(row_start) {
+				break
+			}
+			return decoded_data.Bytes(), int64(row_start / 8), FilterInvalidDataError
+		}
+		decoded_data.Write(ccittRow(changes, columns, black_is_1))
+		reference = changes
+		if int64(decoded_data.Len()) > max_size {
+			return decoded_data.Bytes()[:max_size], int64(decoder.position / 8), DecodeLimitError
+		}
+	}
+
+	if decoded_data.Len() == 0 {
+		return nil, 0, FilterInvalidDataError
+	}
+	return decoded_data.Bytes(), int64(len(data)), nil
+}
+
+// ccittDecoder reads codes from fax data, position is in bits from the most significant bit of the first byte
+type ccittDecoder struct {
+	data []byte
+	position int
+}
+
+// isPadding returns true if every bit from position to the end of the data is 0
+func (decoder *ccittDecoder) isPadding(position int) bool {
+	for ; position < len(decoder.data) * 8; position++ {
+		if decoder.data[position / 8] >> uint(7 - position % 8) & 1 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (decoder *ccittDecoder) readBit() (int, bool) {
+	if decoder.position >= len(decoder.data) * 8 {
+		return 0, false
+	}
+	bit := int(decoder.data[decoder.position / 8] >> uint(7 - decoder.position % 8)) & 1
+	decoder.position++
+	return bit, true
+}
+
+// align skips to the next byte boundary
+func (decoder *ccittDecoder) align() {
+	decoder.position = (decoder.position + 7) / 8 * 8
+}
+
+// isEOL returns true if the next bits are an end of line marker, 11 or more 0 bits followed by a 1 bit
+func (decoder *ccittDecoder) isEOL() bool {
+	position := decoder.position
+	defer func() {
+		decoder.position = position
+	}()
+	return decoder.readEOL()
+}
+
+// readEOL reads an end of line marker and its fill bits, nothing is read if the next bits are not an end of line marker
+func (decoder *ccittDecoder) readEOL() bool {
+	position := decoder.position
+	zeros := 0
+	for {
+		bit, ok := decoder.readBit()
+		if !ok {
+			break
+		}
+		if bit == 1 {
+			if zeros >= 11 {
+				return true
+			}
+			break
+		}
+		zeros++
+	}
+	decoder.position = position
+	return false
+}
+
+// readCode reads a code of up to 13 bits from a table
+func (decoder *ccittDecoder) readCode(table ccittTable) (int, bool) {
+	bits := 0
+	for length := 1; length <= 13; length++ {
+		bit, ok := decoder.readBit()
+		if !ok {
+			return 0, false
+		}
+		bits = bits << 1 | bit
+		if value, ok := table[length << 16 | bits]; ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// readRun reads makeup codes followed by a terminating code and returns the total run length
+func (decoder *ccittDecoder) readRun(white bool) (int, bool) {
+	table := ccitt_black_table
+	if white {
+		table = ccitt_white_table
+	}
+	run := 0
+	for {
+		length, ok := decoder.readCode(table)
+		if !ok {
+			return 0, false
+		}
+		run += length
+		if length < 64 {
+			return run, true
+		}
+	}
+}
+
+// decode1D decodes a row of alternating white and black runs and returns the offsets where the color changes
+func (decoder *ccittDecoder) decode1D(columns int) ([]int, bool) {
+	changes := []int{}
+	for a0, white := 0, true; a0 < columns; white = !white {
+		run, ok := decoder.readRun(white)
+		if !ok || a0 + run > columns {
+			return nil, false
+		}
+		a0 += run
+		changes = append(changes, a0)
+	}
+	return changes, true
+}
+
+// decode2D decodes a row coded relative to the changes of the reference row above it
+func (decoder *ccittDecoder) decode2D(reference []int, columns int) ([]int, bool) {
+	changes := []int{}
+	a0 := -1
+	white := true
+	for a0 < columns {
+		mode, ok := decoder.readCode(ccitt_mode_table)
+		if !ok {
+			return nil, false
+		}
+
+		// b1 is the first change in the reference row after a0 to the opposite color of a0, b2 is the change after b1
+		b1, b2 := columns, columns
+		for i := range reference {
+			if reference[i] > a0 && (i % 2 == 0) == white {
+				b1 = reference[i]
+				if i + 1 < len(reference) {
+					b2 = reference[i + 1]
+				}
+				break
+			}
+		}
+
+		if mode == ccittModePass {
+			// the color of a0 continues to below b2
+			a0 = b2
+		} else if mode == ccittModeHorizontal {
+			// two runs follow, the first in the color of a0
+			if a0 < 0 {
+				a0 = 0
+			}
+			run1, ok := decoder.readRun(white)
+			if !ok {
+				return nil, false
+			}
+			run2, ok := decoder.readRun(!white)
+			if !ok || a0 + run1 + run2 > columns {
+				return nil, false
+			}
+			changes = append(changes, a0 + run1, a0 + run1 + run2)
+			a0 += run1 + run2
+		} else {
+			// the color changes at an offset from b1
+			a1 := b1 + mode
+			if a1 < 0 || a1 > columns || a1 < a0 {
+				return nil, false
+			}
+			changes = append(changes, a1)
+			a0 = a1
+			white = !white
+		}
+	}
+	return changes, true
+}
+
+// ccittRow packs a row to one bit per pixel, 1 is white unless black is 1
+func ccittRow(changes []int, columns int, black_is_1 bool) []byte {
+	row := make([]byte, (columns + 7) / 8)
+	for i := 0; i < len(changes); i += 2 {
+		// pixels from an even change to the next change are black
+		end := columns
+		if i + 1 < len(changes) {
+			end = changes[i + 1]
+		}
+		for x := changes[i]; x < end && x < columns; x++ {
+			row[x / 8] |= 0x80 >> uint(x % 8)
+		}
+	}
+
+	// black pixels are 0 by default, the padding at the end of the row is always 0 like the group 4 decoder
+	if !black_is_1 {
+		for i := range row {
+			row[i] = ^row[i]
+		}
+		if columns % 8 > 0 {
+			row[len(row) - 1] &= 0xff << uint(8 - columns % 8)
+		}
+	}
+	return row
+}
@@ -0,0 +1,286 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"sort"
+)
+
+// number of bytes at the start of an uncovered region included in its preview
+var coverage_preview_size = 32
+
+// longest line starting with % that is covered as a comment
+var coverage_comment_max_size = 256
+
+// prefixes of lines starting with % that start another document instead of a comment
+var comment_document_prefixes = [][]byte{[]byte("%PDF-"), []byte("%FDF-"), []byte("%!")}
+
+// number of bytes at the start of the file searched for the header
+var header_scan_buffer_size int64 = 1024
+
+// kinds of coverage ranges
+const (
+	CoverageHeader = "header"
+	CoverageObject = "object"
+	CoverageXref = "xref"
+	CoverageTrailer = "trailer"
+	CoverageStartXref = "startxref"
+	CoverageComment = "comment"
+)
+
+// Coverage is the byte ranges consumed by each part of a pdf and the regions that are not consumed by any part
+type Coverage struct {
+	Size int64 `json:"size"`
+	Ranges []CoverageRange `json:"ranges"`
+	Uncovered []UncoveredRegion `json:"uncovered"`
+}
+
+// CoverageRange is the byte range consumed by a part of a pdf, object is set if the part is an object
+type CoverageRange struct {
+	Kind string `json:"kind"`
+	Object int `json:"object,omitempty"`
+	Offset int64 `json:"offset"`
+	Size int64 `json:"size"`
+}
+
+// UncoveredRegion is a byte range that is not whitespace and not consumed by any part of a pdf
+// entropy is in bits per byte and preview is the hex encoded start of the region
+type UncoveredRegion struct {
+	Offset int64 `json:"offset"`
+	Size int64 `json:"size"`
+	Entropy float64 `json:"entropy"`
+	Preview string `json:"preview"`
+}
+
+// Coverage finds the byte ranges of the header, objects, xref tables, trailers, startxref markers and comments
+// Load must be called first so every definition of each object is known
+func (parser *Parser) Coverage() *Coverage {
+	size, _ := parser.Seek(0, io.SeekEnd)
+	coverage := &Coverage{size, []CoverageRange{}, []UncoveredRegion{}}
+
+	// objects are read again so anomalies are not logged here
+	sink := parser.sink
+	parser.sink = nil
+	defer func() {
+		parser.sink = sink
+	}()
+
+	// add the header
+	if offset, end, ok := parser.findHeader(); ok {
+		coverage.Ranges = append(coverage.Ranges, CoverageRange{CoverageHeader, 0, offset, end - offset})
+	}
+
+	// add every definition of each object
+	for _, definitions := range parser.definitions {
+		for _, definition := range definitions {
+			coverage.Ranges = append(coverage.Ranges, parser.objectRanges(definition.Offset)...)
+		}
+	}
+
+	// add xref tables and their trailers
+	for _, offset := range parser.findXrefTableOffsets() {
+		coverage.Ranges = append(coverage.Ranges, parser.xrefTableRanges(offset)...)
+	}
+
+	// add startxref and %%EOF markers
+	for _, marker := range parser.findEOFMarkers() {
+		coverage.Ranges = append(coverage.Ranges, CoverageRange{CoverageStartXref, 0, marker.start, marker.end - marker.start})
+	}
+
+	// find the gaps between the covered ranges
+	sort.Slice(coverage.Ranges, func(i, j int) bool { return coverage.Ranges[i].Offset < coverage.Ranges[j].Offset })
+	gaps := [][2]int64{}
+	covered_end := int64(0)
+	for _, covered := range coverage.Ranges {
+		if covered.Offset > covered_end {
+			gaps = append(gaps, [2]int64{covered_end, covered.Offset})
+		}
+		if covered.Offset + covered.Size > covered_end {
+			covered_end = covered.Offset + covered.Size
+		}
+	}
+	if covered_end < size {
+		gaps = append(gaps, [2]int64{covered_end, size})
+	}
+
+	// whitespace and comments in the gaps are covered, anything else is not
+	for _, gap := range gaps {
+		parser.addGap(coverage, gap[0], gap[1])
+	}
+	sort.Slice(coverage.Ranges, func(i, j int) bool { return coverage.Ranges[i].Offset < coverage.Ranges[j].Offset })
+
+	return coverage
+}
+
+// ReadRange reads size bytes at offset
+func (parser *Parser) ReadRange(offset int64, size int64) []byte {
+	data := make([]byte, size)
+	parser.Seek(offset, io.SeekStart)
+	bytes_read, _ := io.ReadFull(parser, data)
+	return data[:bytes_read]
+}
+
+// findHeader returns the offset of the %PDF- header and the offset of the end of its line
+func (parser *Parser) findHeader() (int64, int64, bool) {
+	buffer := parser.ReadRange(0, header_scan_buffer_size)
+	start := bytes.Index(buffer, []byte("%PDF-"))
+	if start < 0 {
+		return 0, 0, false
+	}
+	return int64(start), int64(lineEnd(buffer, start)), true
+}
+
+// objectRanges returns the byte ranges of the object at offset
+// data between the declared end of a stream and the endstream marker is not part of the object
+func (parser *Parser) objectRanges(offset int64) []CoverageRange {
+	// read the object header and value
+	parser.Seek(offset, io.SeekStart)
+	number, _, ok := parser.ReadObjectHeader()
+	if !ok {
+		return []CoverageRange{}
+	}
+	value, _ := parser.ReadObject(noDecryptor)
+	end := parser.CurrentOffset()
+
+	// read the stream
+	ranges := []CoverageRange{}
+	if keyword := parser.ReadKeyword(); keyword == KEYWORD_STREAM {
+		d, _ := value.(Dictionary)
+		end = parser.CurrentOffset()
+		if !parser.skipStreamEOL() {
+			return []CoverageRange{CoverageRange{CoverageObject, number, offset, end - offset}}
+		}
+		start := parser.CurrentOffset()
+		length := parser.streamLength(d)
+		if _, ok := parser.readStreamData(start, length); !ok {
+			// the endstream marker does not follow the declared length so the data was scanned for
+			parser.Seek(start, io.SeekStart)
+			stream_data := parser.scanStreamData()
+			if length >= 0 && length < int64(len(stream_data)) {
+				ranges = append(ranges, CoverageRange{CoverageObject, number, offset, start + length - offset})
+				offset = start + int64(len(stream_data))
+			}
+		}
+		end = parser.CurrentOffset()
+
+		// read endobj
+		if keyword = parser.ReadKeyword(); keyword == KEYWORD_ENDOBJ {
+			end = parser.CurrentOffset()
+		}
+	} else if keyword == KEYWORD_ENDOBJ {
+		end = parser.CurrentOffset()
+	}
+
+	return append(ranges, CoverageRange{CoverageObject, number, offset, end - offset})
+}
+
+// xrefTableRanges returns the byte ranges of the xref table at offset and its trailer
+func (parser *Parser) xrefTableRanges(offset int64) []CoverageRange {
+	// read the xref table
+	parser.Seek(offset, io.SeekStart)
+	if keyword := parser.ReadKeyword(); keyword != KEYWORD_XREF {
+		return []CoverageRange{}
+	}
+	parser.readXrefEntries()
+	parser.consumeWhitespace()
+	trailer_offset := parser.CurrentOffset()
+	ranges := []CoverageRange{CoverageRange{CoverageXref, 0, offset, trailer_offset - offset}}
+
+	// read the trailer
+	if keyword := parser.ReadKeyword(); keyword == KEYWORD_TRAILER {
+		parser.ReadDictionary(noDecryptor)
+		ranges = append(ranges, CoverageRange{CoverageTrailer, 0, trailer_offset, parser.CurrentOffset() - trailer_offset})
+	}
+	return ranges
+}
+
+// addGap adds the comments in a gap to the covered ranges and anything that is not whitespace or a comment to the uncovered regions
+func (parser *Parser) addGap(coverage *Coverage, start int64, end int64) {
+	data := parser.ReadRange(start, end - start)
+	for i := 0; i < len(data); {
+		// skip whitespace
+		if bytes.IndexByte(whitespace, data[i]) >= 0 {
+			i++
+			continue
+		}
+
+		// comments run to the end of the line
+		if j := lineEnd(data, i); parser.isComment(start + int64(i), data[i:j]) {
+			coverage.Ranges = append(coverage.Ranges, CoverageRange{CoverageComment, 0, start + int64(i), int64(j - i)})
+			i = j
+			continue
+		}
+
+		// uncovered regions run until a line that is blank or a comment
+		j := i
+		for j < len(data) {
+			j = lineEnd(data, j)
+			k := j
+			for k < len(data) && bytes.IndexByte(whitespace, data[k]) >= 0 {
+				k++
+			}
+			if k >= len(data) || parser.isComment(start + int64(k), data[k:lineEnd(data, k)]) {
+				break
+			}
+			j = k
+		}
+		coverage.Uncovered = append(coverage.Uncovered, newUncoveredRegion(start + int64(i), data[i:j]))
+		i = j
+	}
+}
+
+// isComment returns true if the line at offset is a short comment of text or binary marker bytes
+// lines starting with % that hold control bytes, start another document or contain the signature of another format are payloads hidden as comments
+func (parser *Parser) isComment(offset int64, line []byte) bool {
+	if len(line) == 0 || line[0] != '%' || len(line) > coverage_comment_max_size {
+		return false
+	}
+	for _, b := range line {
+		if b < 0x20 && b != '\t' || b == 0x7f {
+			return false
+		}
+	}
+	for _, prefix := range comment_document_prefixes {
+		if bytes.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	return len(parser.scanFormats(offset, line)) == 0
+}
+
+func newUncoveredRegion(offset int64, data []byte) UncoveredRegion {
+	preview := data
+	if len(preview) > coverage_preview_size {
+		preview = preview[:coverage_preview_size]
+	}
+	return UncoveredRegion{offset, int64(len(data)), entropy(data), hex.EncodeToString(preview)}
+}
+
+// lineEnd returns the index of the end of line at or after i
+func lineEnd(data []byte, i int) int {
+	for i < len(data) && data[i] != '\r' && data[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// entropy returns the shannon entropy of data in bits per byte rounded to 2 decimal places
+func entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	counts := make([]int, 256)
+	for _, b := range data {
+		counts[b]++
+	}
+	e := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(data))
+			e -= p * math.Log2(p)
+		}
+	}
+	return math.Round(e * 100) / 100
+}
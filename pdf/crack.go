@@ -0,0 +1,366 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// mangling rules applied to each word of a wordlist
+const (
+	CrackRuleCase = "case"
+	CrackRuleDigits = "digits"
+	CrackRuleYears = "years"
+)
+
+// number of words checked between progress updates and session saves
+var crack_batch_size = 1024
+
+// longest word read from a wordlist, longer lines are skipped
+var crack_max_word_size = bufio.MaxScanTokenSize
+
+// range of years appended by the years rule
+var crack_first_year = 1950
+var crack_last_year = 2030
+
+// Cracker guesses the password of an encrypted pdf using a wordlist and mangling rules
+// skipped is the number of wordlist lines that were too long to be a word
+type Cracker struct {
+	security_handler *SecurityHandler
+	Rules []string
+	Threads int
+	Progress io.Writer
+	SessionPath string
+	Fingerprint string
+	Skipped int64
+	skipping bool
+}
+
+// NewCracker creates a cracker for a pdf whose encryption dictionary has been loaded by the security handler
+func NewCracker(security_handler *SecurityHandler, rules []string, threads int) *Cracker {
+	if threads < 1 {
+		threads = 1
+	}
+	return &Cracker{security_handler, rules, threads, nil, "", "", 0, false}
+}
+
+// Crack guesses the password of the encrypted pdf at file_path using the words in wordlist_path
+// the session file at session_path (if not empty) records progress so an interrupted run with the same inputs can be resumed
+func Crack(file_path string, wordlist_path string, rules []string, threads int, session_path string, progress io.Writer) (string, string, error) {
+	// open the pdf
+	file, err := os.Open(file_path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	// load the pdf with an empty password, this loads the encryption dictionary
+	parser := NewParser(file, nil)
+	err = parser.Load("")
+	if err == nil {
+		// the empty password works or the pdf is not encrypted
+		if parser.SecurityHandler().PasswordType == "" {
+			return "", "", NotEncryptedError
+		}
+		return "", parser.SecurityHandler().PasswordType, nil
+	}
+	if err != EncryptionPasswordError {
+		return "", "", err
+	}
+
+	// open the wordlist
+	wordlist, err := os.Open(wordlist_path)
+	if err != nil {
+		return "", "", err
+	}
+	defer wordlist.Close()
+
+	// identify the inputs of the session
+	fingerprint, err := crackFingerprint(file, wordlist, rules)
+	if err != nil {
+		return "", "", err
+	}
+
+	// crack the password
+	cracker := NewCracker(parser.SecurityHandler(), rules, threads)
+	cracker.Progress = progress
+	cracker.SessionPath = session_path
+	cracker.Fingerprint = fingerprint
+	return cracker.Run(wordlist)
+}
+
+// crackFingerprint hashes the pdf, the path, size and modification time of the wordlist and the rules so a session is only resumed with the same inputs
+func crackFingerprint(file *os.File, wordlist *os.File, rules []string) (string, error) {
+	hash := sha256.New()
+
+	// hash the pdf
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	// hash the wordlist info
+	wordlist_path, err := filepath.Abs(wordlist.Name())
+	if err != nil {
+		return "", err
+	}
+	info, err := wordlist.Stat()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(hash, "\n%s\n%d\n%d\n%s\n", wordlist_path, info.Size(), info.ModTime().UnixNano(), strings.Join(rules, ","))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Run checks each word of the wordlist and its mangled variants and returns the matching password and password type
+func (cracker *Cracker) Run(wordlist io.Reader) (string, string, error) {
+	// resume from the saved session
+	skip, err := cracker.loadSession()
+	if err != nil {
+		return "", "", err
+	}
+
+	// read the wordlist in batches
+	scanner := bufio.NewScanner(wordlist)
+	scanner.Buffer(make([]byte, 4096), crack_max_word_size)
+	scanner.Split(cracker.scanWords)
+	cracker.Skipped, cracker.skipping = 0, false
+	words_done := int64(0)
+	candidates_done := int64(0)
+	start := time.Now()
+	batch := make([]string, 0, crack_batch_size)
+	for more := true; more; {
+		// fill the next batch skipping words that were already checked
+		batch = batch[:0]
+		for len(batch) < crack_batch_size {
+			if more = scanner.Scan(); !more {
+				break
+			}
+			words_done++
+			if words_done > skip {
+				batch = append(batch, strings.TrimRight(scanner.Text(), "\r"))
+			}
+		}
+
+		// check the batch
+		password, password_type, candidates, found := cracker.checkBatch(batch)
+		candidates_done += candidates
+		if found {
+			cracker.removeSession()
+			cracker.reportProgress(words_done, candidates_done, start, true)
+			return password, password_type, nil
+		}
+
+		// save progress
+		cracker.saveSession(words_done)
+		cracker.reportProgress(words_done, candidates_done, start, !more)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	cracker.removeSession()
+	return "", "", PasswordNotFoundError
+}
+
+// scanWords splits the wordlist into lines and skips lines longer than the longest word instead of failing
+func (cracker *Cracker) scanWords(data []byte, at_eof bool) (int, []byte, error) {
+	// a line that does not fit is skipped up to its end of line
+	i := bytes.IndexByte(data, '\n')
+	if cracker.skipping {
+		if i < 0 {
+			return len(data), nil, nil
+		}
+		cracker.skipping = false
+		return i + 1, nil, nil
+	}
+	if i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if len(data) >= crack_max_word_size {
+		cracker.skipping = true
+		cracker.Skipped++
+		return len(data), nil, nil
+	}
+
+	// the last line may not have an end of line
+	if at_eof && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// checkBatch checks the words of a batch in parallel, returns the password, its type, the number of candidates checked and whether it was found
+func (cracker *Cracker) checkBatch(batch []string) (string, string, int64, bool) {
+	var wait_group sync.WaitGroup
+	var lock sync.Mutex
+	words := make(chan string)
+	password := ""
+	password_type := ""
+	found := false
+	candidates := int64(0)
+
+	// start workers
+	for i := 0; i < cracker.Threads; i++ {
+		wait_group.Add(1)
+		go func() {
+			defer wait_group.Done()
+			checked := int64(0)
+			for word := range words {
+				for _, candidate := range MangleWord(word, cracker.Rules) {
+					checked++
+					if t, ok := cracker.security_handler.CheckPassword([]byte(candidate)); ok {
+						lock.Lock()
+						password, password_type, found = candidate, t, true
+						lock.Unlock()
+						break
+					}
+				}
+			}
+			lock.Lock()
+			candidates += checked
+			lock.Unlock()
+		}()
+	}
+
+	// send words to workers until the password is found
+	for _, word := range batch {
+		lock.Lock()
+		done := found
+		lock.Unlock()
+		if done {
+			break
+		}
+		words <- word
+	}
+	close(words)
+	wait_group.Wait()
+
+	return password, password_type, candidates, found
+}
+
+// MangleWord returns the word and the variants produced by the mangling rules without duplicates
+func MangleWord(word string, rules []string) []string {
+	// determine which rules are enabled
+	use_case, use_digits, use_years := false, false, false
+	for _, rule := range rules {
+		if rule == CrackRuleCase {
+			use_case = true
+		} else if rule == CrackRuleDigits {
+			use_digits = true
+		} else if rule == CrackRuleYears {
+			use_years = true
+		}
+	}
+
+	// case toggles
+	bases := []string{word}
+	if use_case {
+		runes := []rune(strings.ToLower(word))
+		if len(runes) > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		bases = append(bases, strings.ToLower(word), strings.ToUpper(word), string(runes), toggleCase(word))
+	}
+
+	// appended digits and years
+	candidates := []string{}
+	seen := map[string]interface{}{}
+	add := func(candidate string) {
+		if _, ok := seen[candidate]; !ok {
+			seen[candidate] = nil
+			candidates = append(candidates, candidate)
+		}
+	}
+	for _, base := range bases {
+		add(base)
+		if use_digits {
+			for i := 0; i < 10; i++ {
+				add(base + strconv.Itoa(i))
+			}
+			for i := 0; i < 100; i++ {
+				add(fmt.Sprintf("%s%02d", base, i))
+			}
+		}
+		if use_years {
+			for year := crack_first_year; year <= crack_last_year; year++ {
+				add(base + strconv.Itoa(year))
+			}
+		}
+	}
+	return candidates
+}
+
+// toggleCase swaps the case of each letter in s
+func toggleCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// loadSession returns the number of words checked by a previous run with the same fingerprint
+func (cracker *Cracker) loadSession() (int64, error) {
+	if cracker.SessionPath == "" {
+		return 0, nil
+	}
+	data, err := ioutil.ReadFile(cracker.SessionPath)
+	if err != nil {
+		return 0, nil
+	}
+
+	// refuse to resume a session of other inputs since its word count means nothing for these
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != cracker.Fingerprint {
+		return 0, SessionMismatchError
+	}
+	words_done, err := strconv.ParseInt(strings.TrimSpace(lines[1]), 10, 64)
+	if err != nil {
+		return 0, SessionMismatchError
+	}
+	return words_done, nil
+}
+
+// saveSession records the fingerprint and the number of words that have been checked
+func (cracker *Cracker) saveSession(words_done int64) {
+	if cracker.SessionPath != "" {
+		ioutil.WriteFile(cracker.SessionPath, []byte(fmt.Sprintf("%s\n%d\n", cracker.Fingerprint, words_done)), 0644)
+	}
+}
+
+// removeSession deletes the session file once the run is complete
+func (cracker *Cracker) removeSession() {
+	if cracker.SessionPath != "" {
+		os.Remove(cracker.SessionPath)
+	}
+}
+
+// reportProgress writes the number of words and candidates checked and the rate
+func (cracker *Cracker) reportProgress(words_done int64, candidates_done int64, start time.Time, final bool) {
+	if cracker.Progress == nil {
+		return
+	}
+	rate := float64(candidates_done) / time.Since(start).Seconds()
+	fmt.Fprintf(cracker.Progress, "\rwords: %d candidates: %d (%.0f/s)", words_done, candidates_done, rate)
+	if cracker.Skipped > 0 {
+		fmt.Fprintf(cracker.Progress, " skipped: %d lines over %d bytes", cracker.Skipped, crack_max_word_size)
+	}
+	if final {
+		fmt.Fprintln(cracker.Progress, "")
+	}
+}
@@ -0,0 +1,76 @@
+package pdf
+
+import (
+	"io"
+	"sort"
+)
+
+// Definitions returns every physical definition of an object in the order they appear in the file
+// the xref only points to one of them, the others are shadowed but may be shown by other readers
+func (parser *Parser) Definitions(number int) []*XrefEntry {
+	return parser.definitions[number]
+}
+
+// GetObjectAt reads the physical object definition at offset instead of the one the xref points to
+func (parser *Parser) GetObjectAt(offset int64) (*IndirectObject, bool) {
+	// read the object header
+	parser.Seek(offset, io.SeekStart)
+	number, generation, ok := parser.ReadObjectHeader()
+	if !ok {
+		return nil, false
+	}
+
+	// anomalies found while reading the object are reported at the definition
+	previous_location := parser.location
+	parser.location = Location{number, generation, 0, offset, nil}
+	defer func() {
+		parser.location = previous_location
+	}()
+
+	// definitions are decrypted the same way as the object the xref points to
+	xref_entry := NewXrefEntry(offset, generation, XrefTypeIndirectObject)
+	if current, ok := parser.Xref[number]; ok {
+		xref_entry.IsEncrypted = current.IsEncrypted
+	}
+
+	object := NewIndirectObject(number)
+	parser.readIndirectObject(object, xref_entry)
+	return object, true
+}
+
+// checkDefinitions reports objects that are defined more than once
+// a definition in the same revision as the previous one is a duplicate, otherwise it is an incremental update
+func (parser *Parser) checkDefinitions() {
+	markers := parser.findEOFMarkers()
+
+	// report in object order
+	numbers := []int{}
+	for number := range parser.definitions {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		definitions := parser.definitions[number]
+		for i := 1; i < len(definitions); i++ {
+			parser.Seek(definitions[i].Offset, io.SeekStart)
+			parser.location = Location{number, definitions[i].Generation, 0, definitions[i].Offset, nil}
+			if revisionIndex(markers, definitions[i - 1].Offset) == revisionIndex(markers, definitions[i].Offset) {
+				parser.log_error(DuplicateObject)
+			} else {
+				parser.log_error(RedefinedObject)
+			}
+		}
+	}
+	parser.location = Location{}
+}
+
+// revisionIndex returns the index of the revision containing offset, offsets after the last %%EOF are in an unfinished revision
+func revisionIndex(markers []eofMarker, offset int64) int {
+	for i, marker := range markers {
+		if offset < marker.end {
+			return i
+		}
+	}
+	return len(markers)
+}
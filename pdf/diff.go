@@ -0,0 +1,295 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// max_line_diff_size is the largest number of line pairs compared when diffing streams, larger streams only have their common start and end removed
+const max_line_diff_size = 4000000
+
+// Diff is the structural difference between two pdfs or two revisions of a pdf
+type Diff struct {
+	Added []int `json:"added"`
+	Removed []int `json:"removed"`
+	Changed []ObjectChange `json:"changed"`
+}
+
+// ObjectChange is the difference between the old and new version of an object
+type ObjectChange struct {
+	Object int `json:"object"`
+	Values []ValueChange `json:"values"`
+
+	// Stream is a line diff of the decoded stream data, lines start with - if removed and + if added
+	// binary streams are described by their size and md5 instead of their lines
+	Stream []string `json:"stream,omitempty"`
+}
+
+// ValueChange is a changed value in an object, path is the chain of keys (and array indexes) from the object to the value
+// old is empty if the value was added and new is empty if the value was removed
+type ValueChange struct {
+	Path []string `json:"path"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// DiffFiles compares the objects of two pdf files
+func DiffFiles(old_path string, new_path string, password string) (*Diff, error) {
+	// open the old pdf
+	old_file, err := os.Open(old_path)
+	if err != nil {
+		return nil, err
+	}
+	defer old_file.Close()
+	old_parser := NewParser(old_file, nil)
+	if err = old_parser.Load(password); err != nil {
+		return nil, err
+	}
+
+	// open the new pdf
+	new_file, err := os.Open(new_path)
+	if err != nil {
+		return nil, err
+	}
+	defer new_file.Close()
+	new_parser := NewParser(new_file, nil)
+	if err = new_parser.Load(password); err != nil {
+		return nil, err
+	}
+
+	return DiffParsers(old_parser, new_parser), nil
+}
+
+// DiffRevisions compares the objects of two revisions of a pdf file
+func DiffRevisions(file_path string, password string, old_revision int, new_revision int) (*Diff, error) {
+	// open the pdf
+	file, err := os.Open(file_path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	parser := NewParser(file, nil)
+
+	// open the old revision
+	old_parser, err := parser.OpenRevision(old_revision)
+	if err != nil {
+		return nil, err
+	}
+	if err = old_parser.Load(password); err != nil {
+		return nil, err
+	}
+
+	// open the new revision
+	new_parser, err := parser.OpenRevision(new_revision)
+	if err != nil {
+		return nil, err
+	}
+	if err = new_parser.Load(password); err != nil {
+		return nil, err
+	}
+
+	return DiffParsers(old_parser, new_parser), nil
+}
+
+// DiffParsers compares the objects of two loaded parsers
+func DiffParsers(old_parser *Parser, new_parser *Parser) *Diff {
+	diff := &Diff{[]int{}, []int{}, []ObjectChange{}}
+
+	// compare every object in either pdf in order
+	old_numbers := old_parser.objectNumbers()
+	new_numbers := new_parser.objectNumbers()
+	numbers := []int{}
+	for number := range old_numbers {
+		numbers = append(numbers, number)
+	}
+	for number := range new_numbers {
+		if _, ok := old_numbers[number]; !ok {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		_, in_old := old_numbers[number]
+		_, in_new := new_numbers[number]
+		if !in_old {
+			diff.Added = append(diff.Added, number)
+		} else if !in_new {
+			diff.Removed = append(diff.Removed, number)
+		} else if change, changed := diffObjects(old_parser.GetObject(number), new_parser.GetObject(number)); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	return diff
+}
+
+// objectNumbers returns the numbers of the objects that are in use
+func (parser *Parser) objectNumbers() map[int]interface{} {
+	numbers := map[int]interface{}{}
+	for number, xref_entry := range parser.Xref {
+		if xref_entry.Type != XrefTypeFreeObject {
+			numbers[number] = nil
+		}
+	}
+	return numbers
+}
+
+// diffObjects compares the values and decoded streams of two versions of an object
+func diffObjects(old_object *IndirectObject, new_object *IndirectObject) (ObjectChange, bool) {
+	change := ObjectChange{old_object.Number, []ValueChange{}, nil}
+	diffValues(old_object.Value, new_object.Value, []string{}, &change.Values)
+	if !bytes.Equal(old_object.Stream, new_object.Stream) {
+		change.Stream = diffStreams(old_object.Stream, new_object.Stream)
+	}
+	return change, len(change.Values) > 0 || change.Stream != nil
+}
+
+// diffValues adds the changes between two values to changes, dictionaries and arrays are compared by key and index
+func diffValues(old_value Object, new_value Object, path []string, changes *[]ValueChange) {
+	old_d, old_is_dictionary := old_value.(Dictionary)
+	new_d, new_is_dictionary := new_value.(Dictionary)
+	old_a, old_is_array := old_value.(Array)
+	new_a, new_is_array := new_value.(Array)
+
+	if old_is_dictionary && new_is_dictionary {
+		// sort keys so changes do not depend on map order
+		keys := []string{}
+		for key := range old_d {
+			keys = append(keys, key)
+		}
+		for key := range new_d {
+			if _, ok := old_d[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffValues(old_d[key], new_d[key], append(append([]string{}, path...), key), changes)
+		}
+	} else if old_is_array && new_is_array {
+		for i := 0; i < len(old_a) || i < len(new_a); i++ {
+			var old_element, new_element Object
+			if i < len(old_a) {
+				old_element = old_a[i]
+			}
+			if i < len(new_a) {
+				new_element = new_a[i]
+			}
+			diffValues(old_element, new_element, append(append([]string{}, path...), strconv.Itoa(i)), changes)
+		}
+	} else {
+		// missing values are empty
+		old_string, new_string := "", ""
+		if old_value != nil {
+			old_string = old_value.String()
+		}
+		if new_value != nil {
+			new_string = new_value.String()
+		}
+		if old_string != new_string {
+			*changes = append(*changes, ValueChange{path, old_string, new_string})
+		}
+	}
+}
+
+// diffStreams returns a line diff of two decoded streams or a description of each if either is binary
+func diffStreams(old_data []byte, new_data []byte) []string {
+	if !isText(old_data) || !isText(new_data) {
+		return []string{"-" + describeData(old_data), "+" + describeData(new_data)}
+	}
+	return diffLines(splitLines(old_data), splitLines(new_data))
+}
+
+// diffLines returns the lines removed from old_lines and added in new_lines in order
+func diffLines(old_lines []string, new_lines []string) []string {
+	// remove common start and end
+	for len(old_lines) > 0 && len(new_lines) > 0 && old_lines[0] == new_lines[0] {
+		old_lines = old_lines[1:]
+		new_lines = new_lines[1:]
+	}
+	for len(old_lines) > 0 && len(new_lines) > 0 && old_lines[len(old_lines) - 1] == new_lines[len(new_lines) - 1] {
+		old_lines = old_lines[:len(old_lines) - 1]
+		new_lines = new_lines[:len(new_lines) - 1]
+	}
+
+	// too large to compare line by line
+	lines := []string{}
+	if len(old_lines) * len(new_lines) > max_line_diff_size {
+		for _, line := range old_lines {
+			lines = append(lines, "-" + line)
+		}
+		for _, line := range new_lines {
+			lines = append(lines, "+" + line)
+		}
+		return lines
+	}
+
+	// find the length of the longest common subsequence of the remaining lines
+	lcs := make([][]int, len(old_lines) + 1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new_lines) + 1)
+	}
+	for i := len(old_lines) - 1; i >= 0; i-- {
+		for j := len(new_lines) - 1; j >= 0; j-- {
+			if old_lines[i] == new_lines[j] {
+				lcs[i][j] = lcs[i + 1][j + 1] + 1
+			} else if lcs[i + 1][j] >= lcs[i][j + 1] {
+				lcs[i][j] = lcs[i + 1][j]
+			} else {
+				lcs[i][j] = lcs[i][j + 1]
+			}
+		}
+	}
+
+	// walk the common subsequence, lines that are not in it were removed or added
+	i, j := 0, 0
+	for i < len(old_lines) || j < len(new_lines) {
+		if i < len(old_lines) && j < len(new_lines) && old_lines[i] == new_lines[j] {
+			i++
+			j++
+		} else if j >= len(new_lines) || (i < len(old_lines) && lcs[i + 1][j] >= lcs[i][j + 1]) {
+			lines = append(lines, "-" + old_lines[i])
+			i++
+		} else {
+			lines = append(lines, "+" + new_lines[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// splitLines splits data on any end of line marker
+func splitLines(data []byte) []string {
+	lines := []string{}
+	if len(data) == 0 {
+		return lines
+	}
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	data = bytes.Replace(data, []byte("\r"), []byte("\n"), -1)
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// isText returns true if data does not contain control characters other than whitespace
+func isText(data []byte) bool {
+	for _, b := range data {
+		if b < 0x20 && bytes.IndexByte(whitespace[1:], b) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// describeData describes binary stream data by its size and md5
+func describeData(data []byte) string {
+	hash := md5.Sum(data)
+	return fmt.Sprintf("%d bytes md5 %s", len(data), hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,202 @@
+package pdf
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// DirectorySink writes everything found in a pdf to files in a directory
+type DirectorySink struct {
+	Commands *os.File
+	Directory string
+	DumpUncovered bool
+	Errors *os.File
+	Files *os.File
+	Javascript *os.File
+	Passwords *os.File
+	Raw *os.File
+	Report *Report
+	Text *os.File
+	URLs *os.File
+}
+
+// NewDirectorySink creates the output files in directory, existing files are overwritten
+func NewDirectorySink(directory string) (sink *DirectorySink, err error) {
+	// create new directory sink
+	sink = &DirectorySink{}
+	sink.Directory = directory
+	sink.Report = NewReport()
+
+	// create output dir
+	if err = os.MkdirAll(directory, 0755); err != nil {
+		return
+	}
+
+	// create commands file
+	if sink.Commands, err = os.Create(path.Join(directory, "commands.txt")); err != nil {
+		return
+	}
+
+	// create errors file
+	if sink.Errors, err = os.Create(path.Join(directory, "errors.txt")); err != nil {
+		return
+	}
+
+	// create manifest file
+	if sink.Files, err = os.Create(path.Join(directory, "files.txt")); err != nil {
+		return
+	}
+
+	// create javascript file
+	if sink.Javascript, err = os.Create(path.Join(directory, "javascript.js")); err != nil {
+		return
+	}
+
+	// create passwords file
+	if sink.Passwords, err = os.Create(path.Join(directory, "passwords.txt")); err != nil {
+		return
+	}
+
+	// create raw.pdf file
+	if sink.Raw, err = os.Create(path.Join(directory, "raw.pdf")); err != nil {
+		return
+	}
+
+	// create text content file in output dir
+	if sink.Text, err = os.Create(path.Join(directory, "contents.txt")); err != nil {
+		return
+	}
+
+	// create urls file
+	if sink.URLs, err = os.Create(path.Join(directory, "urls.txt")); err != nil {
+		return
+	}
+	return
+}
+
+// Close writes errors.txt and report.json and closes the output files
+func (sink *DirectorySink) Close() error {
+	if sink.Errors != nil {
+		for _, anomaly := range sink.Report.Anomalies {
+			fmt.Fprintln(sink.Errors, anomaly.String())
+		}
+	}
+	err := sink.WriteJSON("report.json", sink.Report)
+	if sink.Commands != nil {
+		sink.Commands.Close()
+	}
+	if sink.Errors != nil {
+		sink.Errors.Close()
+	}
+	if sink.Files != nil {
+		sink.Files.Close()
+	}
+	if sink.Javascript != nil {
+		sink.Javascript.Close()
+	}
+	if sink.Passwords != nil {
+		sink.Passwords.Close()
+	}
+	if sink.Raw != nil {
+		sink.Raw.Close()
+	}
+	if sink.Text != nil {
+		sink.Text.Close()
+	}
+	if sink.URLs != nil {
+		sink.URLs.Close()
+	}
+	return err
+}
+
+func (sink *DirectorySink) WriteFileSummary(summary FileSummary) {
+	sink.Report.File = summary
+}
+
+func (sink *DirectorySink) WriteFileInfo(info *FileInfo) {
+	sink.Report.Info = info
+}
+
+// WriteEncryption writes encryption.json
+func (sink *DirectorySink) WriteEncryption(info *EncryptionInfo) {
+	sink.WriteJSON("encryption.json", info)
+	sink.Report.Encryption = info
+}
+
+func (sink *DirectorySink) WritePassword(password_type string, password string) {
+	fmt.Fprintf(sink.Passwords, "%s:%s\n", password_type, password)
+	sink.Report.addPassword(password_type, password)
+}
+
+func (sink *DirectorySink) WriteURL(url string, location Location) {
+	fmt.Fprintln(sink.URLs, url)
+	sink.Report.addURL(url, location)
+}
+
+func (sink *DirectorySink) WriteCommand(command string, location Location) {
+	fmt.Fprintln(sink.Commands, command)
+	sink.Report.addCommand(command, location)
+}
+
+func (sink *DirectorySink) WriteFileName(name string, location Location) {
+	fmt.Fprintf(sink.Files, "%s:%s\n", unknownHash, name)
+	sink.Report.addFile(name, unknownHash, 0, false, location)
+}
+
+func (sink *DirectorySink) DumpFile(name string, data []byte, location Location) {
+	// get md5 hash of the file
+	hash := md5.New()
+	hash.Write(data)
+	md5sum := hex.EncodeToString(hash.Sum(nil))
+
+	// add to manifest
+	fmt.Fprintf(sink.Files, "%s:%s\n", md5sum, name)
+	sink.Report.addFile(name, md5sum, len(data), true, location)
+
+	// write file data to file in extract dir
+	ioutil.WriteFile(path.Join(sink.Directory, md5sum), data, 0644)
+}
+
+func (sink *DirectorySink) WriteScript(script string, location Location) {
+	fmt.Fprintln(sink.Javascript, script)
+	sink.Report.addScript(script, location)
+}
+
+func (sink *DirectorySink) WriteText(text string) {
+	fmt.Fprintln(sink.Text, text)
+}
+
+func (sink *DirectorySink) WriteObject(object *IndirectObject) {
+	fmt.Fprintln(sink.Raw, object.String())
+}
+
+// WriteUncovered adds the region to the report and writes its data to uncovered_OFFSET.bin if DumpUncovered is set
+func (sink *DirectorySink) WriteUncovered(region UncoveredRegion, data []byte) {
+	sink.Report.Uncovered = append(sink.Report.Uncovered, region)
+	if sink.DumpUncovered {
+		ioutil.WriteFile(path.Join(sink.Directory, fmt.Sprintf("uncovered_%d.bin", region.Offset)), data, 0644)
+	}
+}
+
+func (sink *DirectorySink) WriteFormat(format EmbeddedFormat) {
+	sink.Report.Formats = append(sink.Report.Formats, format)
+}
+
+// WriteAnomaly adds the anomaly to the report, errors.txt is written on close once anomalies are deduplicated
+func (sink *DirectorySink) WriteAnomaly(anomaly Anomaly) {
+	sink.Report.addAnomaly(anomaly)
+}
+
+// WriteJSON writes value as indented json to the named file in the output directory
+func (sink *DirectorySink) WriteJSON(name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(sink.Directory, name), data, 0644)
+}
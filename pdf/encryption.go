@@ -5,18 +5,33 @@ import (
 	"crypto/cipher"
 	"crypto/md5"
 	"crypto/rc4"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
 	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"math/big"
+	"strings"
 )
 
 var padding_string []byte = []byte("\x28\xBF\x4E\x5E\x4E\x75\x8A\x41\x64\x00\x4E\x56\xFF\xFA\x01\x08\x2E\x2E\x00\xB6\xD0\x68\x3E\x80\x2F\x0C\xA9\xFE\x64\x53\x69\x7A")
 var noFilter = &CryptFilterNone{}
 var noDecryptor = &DecryptorNone{}
+
+// types of password that can authenticate an encrypted pdf
+const (
+	PasswordTypeUser = "user"
+	PasswordTypeOwner = "owner"
+)
+
 type CryptFilter interface {
 	NewDecryptor(int, int) Decryptor
 }
 
 type Decryptor interface {
-	Decrypt([]byte)
+	Decrypt([]byte) []byte
 }
 
 // No encryption
@@ -28,7 +43,9 @@ func (c *CryptFilterNone) NewDecryptor(n int, g int) Decryptor {
 
 type DecryptorNone struct {}
 
-func (d *DecryptorNone) Decrypt(data []byte) {}
+func (d *DecryptorNone) Decrypt(data []byte) []byte {
+	return data
+}
 
 // AES
 type CryptFilterAES struct {
@@ -73,27 +90,45 @@ type DecryptorAES struct {
 	encryption_key []byte
 }
 
-func (d *DecryptorAES) Decrypt(data []byte) {
-	// catch crypt block panic
-	defer func() {
-		if err := recover(); err != nil {
-			Debug("recovered from panic: %s", err)
-		}
-	}()
-
+func (d *DecryptorAES) Decrypt(data []byte) []byte {
 	// create new cipher
-	block, _ := aes.NewCipher(d.encryption_key)
+	block, err := aes.NewCipher(d.encryption_key)
+	if err != nil {
+		Debug("failed to create aes cipher: %s", err)
+		return data
+	}
 
 	// no data to decrypt, first block is initialization vector
 	if len(data) <= aes.BlockSize {
-		return
+		return []byte{}
 	}
 
-	// set iv to first block and decrypt remaining blocks with cbc decryptor
+	// set iv to first block and ignore trailing partial block
 	iv := data[:aes.BlockSize]
 	data = data[aes.BlockSize:]
+	data = data[:len(data) - len(data) % aes.BlockSize]
+
+	// decrypt remaining blocks with cbc decryptor
 	cbc := cipher.NewCBCDecrypter(block, iv)
 	cbc.CryptBlocks(data, data)
+
+	// remove padding
+	if l := len(data); l > 0 {
+		padding := int(data[l-1])
+		if padding > 0 && padding <= aes.BlockSize && padding <= l {
+			data = data[:l - padding]
+		}
+	}
+	return data
+}
+
+// AES-256, the file encryption key is used directly for every object
+type CryptFilterAESV3 struct {
+	encryption_key []byte
+}
+
+func (c *CryptFilterAESV3) NewDecryptor(n int, g int) Decryptor {
+	return &DecryptorAES{c.encryption_key}
 }
 
 // RC4
@@ -136,9 +171,10 @@ type DecryptorRC4 struct {
 	encryption_key []byte
 }
 
-func (d *DecryptorRC4) Decrypt(data []byte) {
+func (d *DecryptorRC4) Decrypt(data []byte) []byte {
 	cipher, _ := rc4.NewCipher(d.encryption_key)
 	cipher.XORKeyStream(data, data)
+	return data
 }
 
 type SecurityHandler struct {
@@ -147,7 +183,11 @@ type SecurityHandler struct {
 	r int
 	o []byte
 	u []byte
+	oe []byte
+	ue []byte
 	p []byte
+	perms []byte
+	perms_valid bool
 	encrypt_meta_data bool
 	id []byte
 	stream_filter CryptFilter
@@ -155,6 +195,17 @@ type SecurityHandler struct {
 	file_filter CryptFilter
 	crypt_filters map[string]CryptFilter
 	encryption_key []byte
+	certificate *x509.Certificate
+	private_key *rsa.PrivateKey
+	encrypt Dictionary
+	known_key []byte
+
+	// PasswordType is the type of password that authenticated (user or owner)
+	PasswordType string
+
+	// UserPassword is the supplied or recovered user password, UserPasswordKnown is false if it could not be recovered
+	UserPassword []byte
+	UserPasswordKnown bool
 }
 
 func NewSecurityHandler() *SecurityHandler {
@@ -167,6 +218,155 @@ func NewSecurityHandler() *SecurityHandler {
 }
 
 func (sh *SecurityHandler) Init(password []byte, trailer Dictionary) error {
+	// get encryption dictionary
+	encrypt, ok := trailer.GetDictionary("Encrypt")
+	if !ok {
+		return EncryptionError
+	}
+
+	// use a known file encryption key instead of authenticating
+	if sh.known_key != nil {
+		return sh.initKnownKey(trailer)
+	}
+
+	// use the public-key security handler
+	if filter, _ := encrypt.GetName("Filter"); filter == "Adobe.PubSec" {
+		return sh.initPublicKey(encrypt)
+	}
+
+	// load the standard security handler encryption dictionary
+	if err := sh.LoadDictionary(trailer); err != nil {
+		return err
+	}
+
+	// compute and verify the encryption key
+	password_type, encryption_key, user_password, ok := sh.authenticate(password)
+	if !ok {
+		return EncryptionPasswordError
+	}
+	sh.PasswordType = password_type
+	sh.encryption_key = encryption_key
+	sh.UserPassword = user_password
+	sh.UserPasswordKnown = user_password != nil
+
+	// make sure the permissions have not been tampered with
+	if sh.r >= 5 {
+		sh.perms_valid = sh.checkPerms()
+	}
+
+	// crypt filter keys are computed from the user password
+	sh.initCryptFilters(user_password)
+	return nil
+}
+
+// SetEncryptionKey sets a known file encryption key so no password is needed to decrypt the pdf
+func (sh *SecurityHandler) SetEncryptionKey(encryption_key []byte) {
+	sh.known_key = encryption_key
+}
+
+// ParseEncryptionKey decodes a hex encoded file encryption key
+func ParseEncryptionKey(hex_key string) ([]byte, error) {
+	encryption_key, err := hex.DecodeString(strings.TrimSpace(hex_key))
+	if err != nil || len(encryption_key) < 5 || len(encryption_key) > 32 {
+		return nil, EncryptionKeyFormatError
+	}
+	return encryption_key, nil
+}
+
+// initKnownKey sets up the crypt filters using the known file encryption key
+func (sh *SecurityHandler) initKnownKey(trailer Dictionary) error {
+	encrypt, _ := trailer.GetDictionary("Encrypt")
+	if filter, _ := encrypt.GetName("Filter"); filter == "Standard" {
+		// load the standard encryption dictionary so the key can be checked
+		if err := sh.LoadDictionary(trailer); err != nil {
+			return err
+		}
+	} else {
+		// other security handlers only need the version
+		sh.encrypt = encrypt
+		sh.v, _ = encrypt.GetInt("V")
+		if sh.v != 1 && sh.v != 2 && sh.v != 4 && sh.v != 5 {
+			return EncryptionUnsupported
+		}
+		encrypt_meta_data, ok := encrypt.GetBool("EncryptMetadata")
+		sh.encrypt_meta_data = encrypt_meta_data || !ok
+	}
+
+	// the known key is used for every crypt filter
+	sh.encryption_key = sh.known_key
+	sh.initCryptFilters(nil)
+	return nil
+}
+
+// initCryptFilters creates the crypt filters from the encryption key
+// crypt filters with their own length are computed from the user password if it is known
+func (sh *SecurityHandler) initCryptFilters(password []byte) {
+	// set default crypt filters
+	if sh.v == 5 {
+		sh.stream_filter = &CryptFilterAESV3{sh.encryption_key}
+	} else {
+		sh.stream_filter = &CryptFilterRC4{sh.encryption_key}
+	}
+	sh.string_filter = sh.stream_filter
+	sh.file_filter = sh.stream_filter
+	sh.crypt_filters = map[string]CryptFilter{}
+	sh.crypt_filters["Identity"] = noFilter
+
+	// load additional crypt filters
+	if sh.v >= 4 {
+		cf, _ := sh.encrypt.GetDictionary("CF")
+		for k, entry := range cf {
+			if cfd, isDictionary := entry.(Dictionary); isDictionary {
+				if method, ok := cfd.GetName("CFM"); ok {
+					// get optional length
+					length, ok := cfd.GetInt("Length")
+					if !ok {
+						length = sh.length
+					}
+
+					// create filter entry
+					if method == "None" {
+						sh.crypt_filters[k] = noFilter
+					} else if method == "V2" {
+						sh.crypt_filters[k] = &CryptFilterRC4{sh.cryptFilterKey(password, length)}
+					} else if method == "AESV2" {
+						sh.crypt_filters[k] = &CryptFilterAES{sh.cryptFilterKey(password, length)}
+					} else if method == "AESV3" {
+						sh.crypt_filters[k] = &CryptFilterAESV3{sh.encryption_key}
+					}
+				}
+			}
+		}
+
+		// assign default filter overrides
+		if name, ok := sh.encrypt.GetName("StmF"); ok {
+			if filter, exists := sh.crypt_filters[name]; exists {
+				sh.stream_filter = filter
+			}
+		}
+		if name, ok := sh.encrypt.GetName("StrF"); ok {
+			if filter, exists := sh.crypt_filters[name]; exists {
+				sh.string_filter = filter
+			}
+		}
+		if name, ok := sh.encrypt.GetName("EEF"); ok {
+			if filter, exists := sh.crypt_filters[name]; exists {
+				sh.file_filter = filter
+			}
+		}
+	}
+}
+
+// cryptFilterKey returns the key of a crypt filter, the file encryption key is used if the password is not known
+func (sh *SecurityHandler) cryptFilterKey(password []byte, length int) []byte {
+	if password == nil || length == sh.length {
+		return sh.encryption_key
+	}
+	return sh.computeEncryptionKey(password, length)
+}
+
+// LoadDictionary reads the encryption dictionary of the standard security handler so passwords can be checked
+func (sh *SecurityHandler) LoadDictionary(trailer Dictionary) error {
 	var ok bool = false
 
 	// get encryption dictionary
@@ -174,6 +374,7 @@ func (sh *SecurityHandler) Init(password []byte, trailer Dictionary) error {
 	if !ok {
 		return EncryptionError
 	}
+	sh.encrypt = encrypt
 
 	// get filter
 	filter, _ := encrypt.GetName("Filter")
@@ -183,13 +384,13 @@ func (sh *SecurityHandler) Init(password []byte, trailer Dictionary) error {
 
 	// get V
 	sh.v, _ = encrypt.GetInt("V")
-	if sh.v != 1 && sh.v != 2 && sh.v != 4 {
+	if sh.v != 1 && sh.v != 2 && sh.v != 4 && sh.v != 5 {
 		return EncryptionUnsupported
 	}
 
 	// get R
 	sh.r, _ = encrypt.GetInt("R")
-	if sh.r < 2 || sh.r > 4 {
+	if sh.r < 2 || sh.r > 6 {
 		return EncryptionUnsupported
 	}
 
@@ -203,7 +404,9 @@ func (sh *SecurityHandler) Init(password []byte, trailer Dictionary) error {
 		}
 	}
 	sh.length = sh.length/8
-	if sh.length < 5 {
+	if sh.v == 5 {
+		sh.length = 32
+	} else if sh.length < 5 {
 		sh.length = 5
 	} else if sh.length > 16 {
 		sh.length = 16
@@ -235,100 +438,299 @@ func (sh *SecurityHandler) Init(password []byte, trailer Dictionary) error {
 		sh.encrypt_meta_data = true
 	}
 
-	// get ID[0] from trailer
-	ids, ok := trailer.GetArray("ID")
-	if !ok {
-		return EncryptionError
-	}
+	// get ID[0] from trailer, revision 5+ does not use the ID
+	ids, _ := trailer.GetArray("ID")
 	sh.id, ok = ids.GetBytes(0)
-	if !ok {
+	if !ok && sh.r < 5 {
 		return EncryptionError
 	}
 
+	// get OE, UE and Perms for revision 5+
+	if sh.r >= 5 {
+		if sh.oe, ok = encrypt.GetBytes("OE"); !ok {
+			return EncryptionError
+		}
+		if sh.ue, ok = encrypt.GetBytes("UE"); !ok {
+			return EncryptionError
+		}
+		sh.perms, _ = encrypt.GetBytes("Perms")
+	}
+
+	return nil
+}
+
+// CheckPassword returns the type of password if password authenticates
+// the security handler is not modified so it is safe to call concurrently after LoadDictionary
+func (sh *SecurityHandler) CheckPassword(password []byte) (string, bool) {
+	password_type, _, _, ok := sh.authenticate(password)
+	return password_type, ok
+}
+
+// authenticate tries password as the user password then as the owner password
+// returns the password type, the encryption key and the user password which is nil if it can not be recovered
+func (sh *SecurityHandler) authenticate(password []byte) (string, []byte, []byte, bool) {
+	if sh.r >= 5 {
+		// passwords are normalized utf-8 for revision 5+
+		password = []byte(SASLprep(string(password)))
+		if len(password) > 127 {
+			password = password[:127]
+		}
+
+		// the user password can not be recovered from the owner password
+		if encryption_key, ok := sh.authenticateUserPasswordAES256(password); ok {
+			return PasswordTypeUser, encryption_key, password, true
+		}
+		if encryption_key, ok := sh.authenticateOwnerPasswordAES256(password); ok {
+			return PasswordTypeOwner, encryption_key, nil, true
+		}
+		return "", nil, nil, false
+	}
+
+	if encryption_key, ok := sh.authenticateUserPassword(password); ok {
+		return PasswordTypeUser, encryption_key, append([]byte{}, password...), true
+	}
+	if encryption_key, user_password, ok := sh.authenticateOwnerPassword(password); ok {
+		return PasswordTypeOwner, encryption_key, user_password, true
+	}
+	return "", nil, nil, false
+}
+
+// authenticateUserPassword returns the encryption key if password is the user password (revision 2-4)
+func (sh *SecurityHandler) authenticateUserPassword(password []byte) ([]byte, bool) {
 	// compute encryption key from password
-	sh.encryption_key = sh.computeEncryptionKey(password, sh.length)
+	encryption_key := sh.computeEncryptionKey(password, sh.length)
+	if !sh.checkUserKey(encryption_key) {
+		return nil, false
+	}
+	return encryption_key, true
+}
 
-	// verify key
+// checkUserKey returns true if the encryption key produces the U entry (revision 2-4)
+func (sh *SecurityHandler) checkUserKey(encryption_key []byte) bool {
 	if sh.r == 2 { // if revision 2 use algorithm 4
 		u := make([]byte, 32)
-		cipher, _ := rc4.NewCipher(sh.encryption_key)
+		cipher, _ := rc4.NewCipher(encryption_key)
 		cipher.XORKeyStream(u, padding_string)
-		if string(u) != string(sh.u) {
-			return EncryptionPasswordError
+		return string(u) == string(sh.u)
+	}
+
+	// for revision 3+ use algorithm 5
+	// step b, c
+	hash := md5.New()
+	hash.Write(padding_string)
+	hash.Write(sh.id)
+	u := hash.Sum(nil)
+
+	// step d, e
+	temp_key := make([]byte, len(encryption_key))
+	for i := 0; i < 20; i++ {
+		for j := range encryption_key {
+			temp_key[j] = encryption_key[j] ^ byte(i)
 		}
-	} else if sh.r >= 3 { // for revision 3+ use algorithm 5
-		// step b, c
-		hash := md5.New()
-		hash.Write(padding_string)
-		hash.Write(sh.id)
-		u := hash.Sum(nil)
-
-		// step d, e
-		temp_key := make([]byte, len(sh.encryption_key))
-		for i := 0; i < 20; i++ {
-			for j := range sh.encryption_key {
-				temp_key[j] = sh.encryption_key[j] ^ byte(i)
+		cipher, _ := rc4.NewCipher(temp_key)
+		cipher.XORKeyStream(u, u)
+	}
+
+	// compare to first 16 bytes of U entry
+	return len(sh.u) >= 16 && string(u) == string(sh.u[:16])
+}
+
+// SetCertificate sets the recipient certificate and private key used by the public-key security handler
+func (sh *SecurityHandler) SetCertificate(certificate *x509.Certificate, private_key *rsa.PrivateKey) {
+	sh.certificate = certificate
+	sh.private_key = private_key
+}
+
+// Algorithm 7: Authenticating the owner password (revision 2-4), returns the encryption key and recovered user password
+func (sh *SecurityHandler) authenticateOwnerPassword(password []byte) ([]byte, []byte, bool) {
+	if len(sh.o) < 32 {
+		return nil, nil, false
+	}
+
+	// step a) compute rc4 key from owner password using algorithm 3 steps a-d
+	key := sh.computeOwnerKey(password)
+
+	// step b) decrypt O to get the padded user password
+	user_password := make([]byte, 32)
+	copy(user_password, sh.o[:32])
+	if sh.r == 2 {
+		cipher, _ := rc4.NewCipher(key)
+		cipher.XORKeyStream(user_password, user_password)
+	} else {
+		temp_key := make([]byte, len(key))
+		for i := 19; i >= 0; i-- {
+			for j := range key {
+				temp_key[j] = key[j] ^ byte(i)
 			}
 			cipher, _ := rc4.NewCipher(temp_key)
-			cipher.XORKeyStream(u, u)
+			cipher.XORKeyStream(user_password, user_password)
 		}
+	}
 
-		// compare to first 16 bytes of U entry
-		if string(u) != string(sh.u[:16]) {
-			return EncryptionPasswordError
-		}
+	// step c) authenticate the decrypted user password
+	encryption_key, ok := sh.authenticateUserPassword(user_password)
+	if !ok {
+		return nil, nil, false
 	}
 
-	// set default crypt filters
-	sh.stream_filter = &CryptFilterRC4{sh.encryption_key}
-	sh.string_filter = sh.stream_filter
-	sh.file_filter = sh.stream_filter
-	sh.crypt_filters = map[string]CryptFilter{}
-	sh.crypt_filters["Identity"] = noFilter
+	return encryption_key, unpadPassword(user_password), true
+}
 
-	// load additional crypt filters
-	if sh.r == 4 {
-		cf, _ := encrypt.GetDictionary("CF")
-		for k, entry := range cf {
-			if cfd, isDictionary := entry.(Dictionary); isDictionary {
-				if method, ok := cfd.GetName("CFM"); ok {
-					// get optional length
-					length, ok := cfd.GetInt("Length")
-					if !ok {
-						length = sh.length
-					}
+// Algorithm 3 steps a-d: Computing the rc4 key used to encrypt the O entry
+func (sh *SecurityHandler) computeOwnerKey(password []byte) []byte {
+	// step a) pad or truncate password to exactly 32 bytes
+	padded_password := make([]byte, 32)
+	copy(padded_password, password)
+	if len(password) < 32 {
+		copy(padded_password[len(password):], padding_string)
+	}
 
-					// create filter entry
-					if method == "None" {
-						sh.crypt_filters[k] = noFilter
-					} else if method == "V2" {
-						sh.crypt_filters[k] = &CryptFilterRC4{sh.computeEncryptionKey(password, length)}
-					} else if method == "AESV2" {
-						sh.crypt_filters[k] = &CryptFilterAES{sh.computeEncryptionKey(password, length)}
-					}
-				}
-			}
+	// step b) hash the padded password
+	hash := md5.New()
+	hash.Write(padded_password)
+	key := hash.Sum(nil)
+
+	// step c) for revision 3+, re-hash 50 times
+	if sh.r >= 3 {
+		for i := 0; i < 50; i++ {
+			hash = md5.New()
+			hash.Write(key)
+			key = hash.Sum(nil)
 		}
+	}
 
-		// assign default filter overrides
-		if name, ok := encrypt.GetName("StmF"); ok {
-			if filter, exists := sh.crypt_filters[name]; exists {
-				sh.stream_filter = filter
-			}
+	// step d) truncate to key length
+	if sh.r == 2 {
+		return key[:5]
+	}
+	return key[:sh.length]
+}
+
+// unpadPassword removes the padding string from the end of a padded password
+func unpadPassword(padded_password []byte) []byte {
+	for i := 0; i < len(padded_password); i++ {
+		if string(padded_password[i:]) == string(padding_string[:len(padded_password) - i]) {
+			return padded_password[:i]
 		}
-		if name, ok := encrypt.GetName("StrF"); ok {
-			if filter, exists := sh.crypt_filters[name]; exists {
-				sh.string_filter = filter
-			}
+	}
+	return padded_password
+}
+
+// Algorithm 11: Authenticating the user password (revision 5+)
+func (sh *SecurityHandler) authenticateUserPasswordAES256(password []byte) ([]byte, bool) {
+	if len(sh.u) < 48 || len(sh.ue) < 32 {
+		return nil, false
+	}
+
+	// hash password with user validation salt and compare to first 32 bytes of U
+	if string(sh.computeHashAES256(password, sh.u[32:40], nil)) != string(sh.u[:32]) {
+		return nil, false
+	}
+
+	// hash password with user key salt to get key for decrypting UE
+	return decryptKeyAES256(sh.computeHashAES256(password, sh.u[40:48], nil), sh.ue[:32]), true
+}
+
+// Algorithm 12: Authenticating the owner password (revision 5+)
+func (sh *SecurityHandler) authenticateOwnerPasswordAES256(password []byte) ([]byte, bool) {
+	if len(sh.o) < 48 || len(sh.oe) < 32 || len(sh.u) < 48 {
+		return nil, false
+	}
+
+	// hash password with owner validation salt and U then compare to first 32 bytes of O
+	if string(sh.computeHashAES256(password, sh.o[32:40], sh.u[:48])) != string(sh.o[:32]) {
+		return nil, false
+	}
+
+	// hash password with owner key salt and U to get key for decrypting OE
+	return decryptKeyAES256(sh.computeHashAES256(password, sh.o[40:48], sh.u[:48]), sh.oe[:32]), true
+}
+
+// Algorithm 2.B: Computing a hash (revision 5 uses a single sha-256)
+func (sh *SecurityHandler) computeHashAES256(password []byte, salt []byte, user_key []byte) []byte {
+	// initial hash
+	sha := sha256.New()
+	sha.Write(password)
+	sha.Write(salt)
+	sha.Write(user_key)
+	k := sha.Sum(nil)
+
+	// revision 5 does not harden the hash
+	if sh.r < 6 {
+		return k
+	}
+
+	for i := 0; true; i++ {
+		// step a) repeat password, k and user key 64 times
+		k1 := make([]byte, 0, 64 * (len(password) + len(k) + len(user_key)))
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, password...)
+			k1 = append(k1, k...)
+			k1 = append(k1, user_key...)
 		}
-		if name, ok := encrypt.GetName("EEF"); ok {
-			if filter, exists := sh.crypt_filters[name]; exists {
-				sh.file_filter = filter
-			}
+
+		// step b) encrypt k1 with aes-128 cbc using first 16 bytes of k as key and second 16 bytes as iv
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		// step c, d) select next hash function using first 16 bytes of e as a big endian number mod 3
+		var next hash.Hash
+		if m := new(big.Int).Mod(new(big.Int).SetBytes(e[:16]), big.NewInt(3)).Int64(); m == 0 {
+			next = sha256.New()
+		} else if m == 1 {
+			next = sha512.New384()
+		} else {
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		// step e, f) stop after at least 64 rounds once the last byte of e is small enough
+		if i >= 63 && int(e[len(e)-1]) <= i + 1 - 32 {
+			break
 		}
 	}
 
-	return nil
+	return k[:32]
+}
+
+// decryptKeyAES256 decrypts an encrypted file key (OE or UE) with aes-256 cbc, no padding and zero iv
+func decryptKeyAES256(key []byte, encrypted_key []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	encryption_key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encryption_key, encrypted_key[:32])
+	return encryption_key
+}
+
+// Algorithm 13: Validating the permissions (revision 5+)
+func (sh *SecurityHandler) checkPerms() bool {
+	perms, ok := sh.decryptPerms()
+	if !ok {
+		return false
+	}
+
+	// bytes 0-3 must match P
+	if string(perms[:4]) != string(sh.p) {
+		return false
+	}
+
+	// byte 8 must match EncryptMetadata
+	return (perms[8] == 'T') == sh.encrypt_meta_data
+}
+
+// decryptPerms decrypts perms with aes-256 ecb using the file encryption key, bytes 9-11 must be adb
+func (sh *SecurityHandler) decryptPerms() ([]byte, bool) {
+	if len(sh.perms) < 16 {
+		return nil, false
+	}
+	block, err := aes.NewCipher(sh.encryption_key)
+	if err != nil {
+		return nil, false
+	}
+	perms := make([]byte, 16)
+	block.Decrypt(perms, sh.perms[:16])
+	return perms, string(perms[9:12]) == "adb"
 }
 
 // Algorithm 2: Computing an encryption key
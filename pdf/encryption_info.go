@@ -0,0 +1,156 @@
+package pdf
+
+// EncryptionInfo describes how a pdf is encrypted
+type EncryptionInfo struct {
+	Filter string `json:"filter"`
+	SubFilter string `json:"sub_filter,omitempty"`
+	V int `json:"v"`
+	R int `json:"r,omitempty"`
+	Algorithm string `json:"algorithm"`
+	KeyLength int `json:"key_length"`
+	P int32 `json:"p"`
+	Permissions Permissions `json:"permissions"`
+	PermsValid *bool `json:"perms_valid,omitempty"`
+	EncryptMetadata bool `json:"encrypt_metadata"`
+	CryptFilters map[string]CryptFilterInfo `json:"crypt_filters,omitempty"`
+	StreamFilter string `json:"stream_filter,omitempty"`
+	StringFilter string `json:"string_filter,omitempty"`
+	EmbeddedFileFilter string `json:"embedded_file_filter,omitempty"`
+	PasswordType string `json:"password_type,omitempty"`
+}
+
+// Permissions are the decoded user access permission bits of /P
+type Permissions struct {
+	Print bool `json:"print"`
+	Modify bool `json:"modify"`
+	Copy bool `json:"copy"`
+	Annotate bool `json:"annotate"`
+	FillForms bool `json:"fill_forms"`
+	Extract bool `json:"extract"`
+	Assemble bool `json:"assemble"`
+	HighQualityPrint bool `json:"high_quality_print"`
+}
+
+// CryptFilterInfo describes an entry of the /CF crypt filter dictionary
+type CryptFilterInfo struct {
+	Method string `json:"method"`
+	Algorithm string `json:"algorithm"`
+	KeyLength int `json:"key_length"`
+	AuthEvent string `json:"auth_event,omitempty"`
+}
+
+// NewEncryptionInfo describes the encryption dictionary, no password is needed
+func NewEncryptionInfo(encrypt Dictionary) *EncryptionInfo {
+	info := &EncryptionInfo{}
+	info.Filter, _ = encrypt.GetName("Filter")
+	info.SubFilter, _ = encrypt.GetName("SubFilter")
+	info.V, _ = encrypt.GetInt("V")
+	info.R, _ = encrypt.GetInt("R")
+
+	// get EncryptMetadata
+	encrypt_meta_data, ok := encrypt.GetBool("EncryptMetadata")
+	info.EncryptMetadata = encrypt_meta_data || !ok
+
+	// decode permissions
+	if p, ok := encrypt.GetInt64("P"); ok {
+		info.SetPermissions(int32(p))
+	}
+
+	// get key length in bits
+	length, ok := encrypt.GetInt("Length")
+	if !ok || info.V == 1 {
+		length = 40
+	}
+
+	if info.V >= 4 {
+		// describe crypt filters
+		info.CryptFilters = map[string]CryptFilterInfo{}
+		cf, _ := encrypt.GetDictionary("CF")
+		for name := range cf {
+			if cfd, ok := cf.GetDictionary(name); ok {
+				info.CryptFilters[name] = newCryptFilterInfo(cfd, length)
+			}
+		}
+
+		// crypt filter assignments default to identity
+		info.StreamFilter = "Identity"
+		info.StringFilter = "Identity"
+		if name, ok := encrypt.GetName("StmF"); ok {
+			info.StreamFilter = name
+		}
+		if name, ok := encrypt.GetName("StrF"); ok {
+			info.StringFilter = name
+		}
+		info.EmbeddedFileFilter = info.StreamFilter
+		if name, ok := encrypt.GetName("EEF"); ok {
+			info.EmbeddedFileFilter = name
+		}
+
+		// the algorithm is the one used for streams
+		if filter, ok := info.CryptFilters[info.StreamFilter]; ok {
+			info.Algorithm = filter.Algorithm
+			info.KeyLength = filter.KeyLength
+		} else {
+			info.Algorithm = "None"
+		}
+	} else {
+		// rc4 is used for everything, there are no crypt filters to name before V 4
+		info.Algorithm = "RC4"
+		info.KeyLength = length
+	}
+
+	return info
+}
+
+// newCryptFilterInfo describes a crypt filter dictionary
+func newCryptFilterInfo(cfd Dictionary, default_length int) CryptFilterInfo {
+	info := CryptFilterInfo{}
+	info.Method, _ = cfd.GetName("CFM")
+	if info.Method == "" {
+		info.Method = "None"
+	}
+	info.AuthEvent, _ = cfd.GetName("AuthEvent")
+
+	// length may be in bits or bytes
+	length, ok := cfd.GetInt("Length")
+	if !ok {
+		length = default_length
+	} else if length <= 32 {
+		length *= 8
+	}
+
+	if info.Method == "V2" {
+		info.Algorithm = "RC4"
+		info.KeyLength = length
+	} else if info.Method == "AESV2" {
+		info.Algorithm = "AES-128"
+		info.KeyLength = 128
+	} else if info.Method == "AESV3" {
+		info.Algorithm = "AES-256"
+		info.KeyLength = 256
+	} else {
+		info.Algorithm = "None"
+	}
+	return info
+}
+
+// SetPermissions sets P and decodes the permission bits
+func (info *EncryptionInfo) SetPermissions(p int32) {
+	info.P = p
+	info.Permissions.Print = p & (1 << 2) != 0
+	info.Permissions.Modify = p & (1 << 3) != 0
+	info.Permissions.Copy = p & (1 << 4) != 0
+	info.Permissions.Annotate = p & (1 << 5) != 0
+	if info.R == 2 {
+		// revision 2 does not have bits 9-12 so they follow the older bits
+		info.Permissions.FillForms = info.Permissions.Annotate
+		info.Permissions.Extract = info.Permissions.Copy
+		info.Permissions.Assemble = info.Permissions.Modify
+		info.Permissions.HighQualityPrint = info.Permissions.Print
+	} else {
+		info.Permissions.FillForms = p & (1 << 8) != 0
+		info.Permissions.Extract = p & (1 << 9) != 0
+		info.Permissions.Assemble = p & (1 << 10) != 0
+		info.Permissions.HighQualityPrint = p & (1 << 11) != 0
+	}
+}
@@ -6,27 +6,85 @@ import (
 
 
 // errors
+var DecodeLimitError = errors.New("decode limit exceeded")
+var EncryptionCertificateError = errors.New("missing certificate or private key")
 var EncryptionError = errors.New("missing required encryption info")
+var EncryptionKeyError = errors.New("incorrect encryption key")
+var EncryptionKeyFormatError = errors.New("encryption key must be 5 to 32 hex encoded bytes")
 var EncryptionPasswordError = errors.New("incorrect password")
+var EncryptionRecipientError = errors.New("certificate is not a recipient")
 var EncryptionUnsupported = errors.New("unsupported encryption")
 var EndOfArray = errors.New("end of array")
 var EndOfDictionary = errors.New("end of dictionary")
 var EndOfHexString = errors.New("end of hex string")
 var EndOfString = errors.New("end of string")
+var FilterInvalidDataError = errors.New("invalid data")
+var FilterParmsError = errors.New("invalid decode parms")
+var FilterTruncatedError = errors.New("data is truncated")
+var JBIG2MissingPageError = errors.New("missing jbig2 page")
+var MissingCatalogError = errors.New("missing catalog")
+var MissingSinkError = errors.New("parser has no sink")
+var NotEncryptedError = errors.New("pdf is not encrypted")
+var PasswordNotFoundError = errors.New("password not found")
 var ReadError = errors.New("read failed")
+var RevisionNotFoundError = errors.New("revision not found")
+var SessionMismatchError = errors.New("session file belongs to a different pdf, wordlist or rules")
+
+// severities of anomalies
+const (
+	SeverityInfo = "info"
+	SeverityWarning = "warning"
+	SeverityError = "error"
+)
 
 // format errors and abnormalities
-var InvalidDictionaryKeyType = "invalid dictionary key type"
-var InvalidHexStringChar = "invalid hex string character"
-var InvalidNameEscapeChar = "invalid name escape character"
-var InvalidOctal = "invalid octal in string"
-var MissingDictionaryValue = "missing dictionary value"
-var UnclosedArray = "unclosed array"
-var UnclosedDictionary = "unclosed dictionary"
-var UnclosedHexString = "unclosed hex string"
-var UnclosedStream = "unclosed stream"
-var UnclosedString = "unclosed string"
-var UnclosedStringEscape = "unclosed escape in string"
-var UnclosedStringOctal = "unclosed octal in string"
-var UnnecessaryEscapeName = "unnecessary espace sequence in name"
-var UnnecessaryEscapeString = "unnecessary espace sequence in string"
+var AbbreviatedFilter = AnomalyType{"abbreviated_filter", "abbreviated stream filter name", SeverityWarning}
+var CatalogVersionIgnored = AnomalyType{"catalog_version_ignored", "catalog /Version is earlier than the header version", SeverityInfo}
+var CatalogVersionOverride = AnomalyType{"catalog_version_override", "catalog /Version overrides the header version", SeverityInfo}
+var DecodeLimitExceeded = AnomalyType{"decode_limit_exceeded", "stream decoding stopped at a decode limit", SeverityWarning}
+var DuplicateObject = AnomalyType{"duplicate_object", "object is defined more than once in the same revision", SeverityWarning}
+var EOFWithoutXref = AnomalyType{"eof_without_xref", "%%EOF marker without an xref section", SeverityWarning}
+var FilterDecodeError = AnomalyType{"filter_decode_error", "stream filter could not decode all of the data", SeverityError}
+var FlateChecksumMismatch = AnomalyType{"flate_checksum_mismatch", "flate data does not match its checksum", SeverityWarning}
+var FlateInvalidHeader = AnomalyType{"flate_invalid_header", "invalid zlib header in flate data", SeverityWarning}
+var FlateMissingChecksum = AnomalyType{"flate_missing_checksum", "flate data is missing its checksum", SeverityInfo}
+var HeaderNotAtStart = AnomalyType{"header_not_at_start", "header is not at the start of the file", SeverityWarning}
+var InvalidDictionaryKeyType = AnomalyType{"invalid_dictionary_key_type", "invalid dictionary key type", SeverityWarning}
+var InvalidEncryptionPerms = AnomalyType{"invalid_encryption_perms", "invalid encryption perms", SeverityError}
+var InvalidHexStringChar = AnomalyType{"invalid_hex_string_char", "invalid hex string character", SeverityWarning}
+var InvalidNameEscapeChar = AnomalyType{"invalid_name_escape_char", "invalid name escape character", SeverityWarning}
+var InvalidOctal = AnomalyType{"invalid_octal", "invalid octal in string", SeverityWarning}
+var InvalidStartXref = AnomalyType{"invalid_startxref", "startxref does not point to an xref section", SeverityWarning}
+var JBIG2InvalidSegment = AnomalyType{"jbig2_invalid_segment", "invalid jbig2 segment", SeverityError}
+var JBIG2OversizedBitmap = AnomalyType{"jbig2_oversized_bitmap", "jbig2 bitmap exceeds the size limit", SeverityError}
+var JBIG2SymbolOutOfRange = AnomalyType{"jbig2_symbol_out_of_range", "jbig2 symbol reference is out of range", SeverityError}
+var JBIG2TooManySymbols = AnomalyType{"jbig2_too_many_symbols", "jbig2 symbols exceed the symbol limit", SeverityError}
+var JBIG2UnknownSegment = AnomalyType{"jbig2_unknown_segment", "unknown jbig2 segment type", SeverityWarning}
+var JBIG2UnsupportedSegment = AnomalyType{"jbig2_unsupported_segment", "jbig2 segment is not decoded", SeverityInfo}
+var JBIG2UnusualSegment = AnomalyType{"jbig2_unusual_segment", "unusual jbig2 segment", SeverityWarning}
+var MissingDictionaryValue = AnomalyType{"missing_dictionary_value", "missing dictionary value", SeverityWarning}
+var MissingHeader = AnomalyType{"missing_header", "missing %PDF- header", SeverityWarning}
+var MissingStartXref = AnomalyType{"missing_startxref", "missing startxref at the end of the file", SeverityWarning}
+var PolyglotFormat = AnomalyType{"polyglot_format", "signature of another file format", SeverityWarning}
+var RedefinedObject = AnomalyType{"redefined_object", "object is redefined by an incremental update", SeverityInfo}
+var RepeatedFilter = AnomalyType{"repeated_filter", "stream filter is applied more than once", SeverityWarning}
+var StartXrefBeyondEOF = AnomalyType{"startxref_beyond_eof", "startxref points beyond the end of the file", SeverityError}
+var StreamLengthMismatch = AnomalyType{"stream_length_mismatch", "stream length does not match /Length", SeverityWarning}
+var TrailingData = AnomalyType{"trailing_data", "data after the last startxref marker", SeverityWarning}
+var UnclosedArray = AnomalyType{"unclosed_array", "unclosed array", SeverityError}
+var UnclosedDictionary = AnomalyType{"unclosed_dictionary", "unclosed dictionary", SeverityError}
+var UnclosedHexString = AnomalyType{"unclosed_hex_string", "unclosed hex string", SeverityError}
+var UnclosedStream = AnomalyType{"unclosed_stream", "unclosed stream", SeverityError}
+var UnclosedString = AnomalyType{"unclosed_string", "unclosed string", SeverityError}
+var UnclosedStringEscape = AnomalyType{"unclosed_string_escape", "unclosed escape in string", SeverityError}
+var UnclosedStringOctal = AnomalyType{"unclosed_string_octal", "unclosed octal in string", SeverityError}
+var UncoveredData = AnomalyType{"uncovered_data", "data does not belong to any object", SeverityWarning}
+var UnknownFilter = AnomalyType{"unknown_filter", "unknown stream filter", SeverityWarning}
+var UnknownVersion = AnomalyType{"unknown_version", "unknown pdf version", SeverityWarning}
+var UnnecessaryEscapeName = AnomalyType{"unnecessary_escape_name", "unnecessary espace sequence in name", SeverityInfo}
+var UnnecessaryEscapeString = AnomalyType{"unnecessary_escape_string", "unnecessary espace sequence in string", SeverityInfo}
+var XrefEmptyChain = AnomalyType{"xref_empty_chain", "startxref chain has no xref sections", SeverityWarning}
+var XrefMissingObject = AnomalyType{"xref_missing_object", "object is missing from the startxref chain", SeverityWarning}
+var XrefRepairedOffset = AnomalyType{"xref_repaired_offset", "object is not at the offset in the startxref chain", SeverityWarning}
+var XrefValueMismatch = AnomalyType{"xref_value_mismatch", "object value differs from the startxref chain", SeverityWarning}
+var XrefWrongObject = AnomalyType{"xref_wrong_object", "xref entry in the startxref chain points to the wrong object", SeverityWarning}
@@ -8,14 +8,14 @@ var unknownHash string = "00000000000000000000000000000000"
 
 type File Dictionary
 
-func (file File) Extract(output *Output, isCommand bool) {
+func (file File) Extract(sink Sink, location Location, isCommand bool) {
 	d := Dictionary(file)
 
 	// file specification can be a url or file
 	fs, _ := d.GetString("FS")
 	if fs == "URL" {
 		if f, ok := d.GetString("F"); ok {
-			fmt.Fprintln(output.URLs, f)
+			sink.WriteURL(f, location.child("F"))
 		}
 	} else if ef, ok := d.GetDictionary("EF"); ok {
 		// get the file data
@@ -28,16 +28,16 @@ func (file File) Extract(output *Output, isCommand bool) {
 		}
 
 		// dump file
-		output.DumpFile(f, file_data)
+		sink.DumpFile(f, file_data, location.child("EF").child("F"))
 	} else if p, ok := d.GetString("P"); ok {
 		if f, ok := d.GetString("F"); ok {
-			fmt.Fprintf(output.Files, "%s:%s\n", unknownHash, f)
-			fmt.Fprintf(output.Commands, "%s %s\n", f, p)
+			sink.WriteFileName(f, location.child("F"))
+			sink.WriteCommand(fmt.Sprintf("%s %s", f, p), location.child("F"))
 		}
 	} else if f, ok := d.GetString("F"); ok {
 		if isCommand {
-			fmt.Fprintf(output.Commands, "%s %s\n", f, p)
+			sink.WriteCommand(fmt.Sprintf("%s %s", f, p), location.child("F"))
 		}
-		fmt.Fprintf(output.Files, "%s:%s\n", unknownHash, f)
+		sink.WriteFileName(f, location.child("F"))
 	}
 }
@@ -0,0 +1,220 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pdf versions that have been published
+var known_versions = map[string]interface{}{"1.0": nil, "1.1": nil, "1.2": nil, "1.3": nil, "1.4": nil, "1.5": nil, "1.6": nil, "1.7": nil, "2.0": nil}
+
+// FileInfo describes the header and end of file markers of a pdf
+// header offset is -1 if there is no header, catalog version is the /Version of the catalog which overrides the header version when it is later
+// start xref is the offset the last startxref marker points to, start xref valid is true if an xref table or stream is there
+type FileInfo struct {
+	HeaderOffset int64 `json:"header_offset"`
+	Version string `json:"version"`
+	BinaryMarker bool `json:"binary_marker"`
+	CatalogVersion string `json:"catalog_version,omitempty"`
+	EOFCount int `json:"eof_count"`
+	EOFOffsets []int64 `json:"eof_offsets"`
+	StartXrefCount int `json:"startxref_count"`
+	StartXrefOffsets []int64 `json:"startxref_offsets"`
+	StartXref int64 `json:"startxref"`
+	StartXrefValid bool `json:"startxref_valid"`
+}
+
+// FileInfo describes the header and end of file markers, Load must be called first to find the catalog version
+func (parser *Parser) FileInfo() *FileInfo {
+	info := &FileInfo{-1, "", false, "", 0, []int64{}, 0, []int64{}, -1, false}
+
+	// get the header version and check for a binary marker comment on the next line
+	if offset, end, ok := parser.findHeader(); ok {
+		info.HeaderOffset = offset
+		if match := header_version_regexp.FindSubmatch(parser.ReadRange(offset, end - offset)); match != nil {
+			info.Version = string(match[1])
+		}
+		info.BinaryMarker = isBinaryMarker(bytes.TrimLeft(parser.ReadRange(end, 64), "\r\n"))
+	}
+
+	// get the catalog version without logging anomalies, the catalog is read again when extracted
+	sink := parser.sink
+	parser.sink = nil
+	if root, ok := parser.trailer.GetDictionary("Root"); ok {
+		info.CatalogVersion, _ = root.GetName("Version")
+	}
+	parser.sink = sink
+
+	// find every end of file and startxref marker
+	info.EOFOffsets = parser.findOffsets(eof_regexp)
+	info.EOFCount = len(info.EOFOffsets)
+	info.StartXrefOffsets = parser.findOffsets(start_xref_keyword_regexp)
+	info.StartXrefCount = len(info.StartXrefOffsets)
+
+	// check where the last startxref marker points
+	if start_xref_offset, ok := parser.getStartXrefOffset(); ok {
+		info.StartXref = start_xref_offset
+		info.StartXrefValid = parser.isXrefAt(start_xref_offset)
+	}
+
+	return info
+}
+
+// checkFileInfo describes the header and end of file markers and reports anything unusual about them
+func (parser *Parser) checkFileInfo() *FileInfo {
+	info := parser.FileInfo()
+
+	// check the header
+	if info.HeaderOffset < 0 {
+		parser.logErrorAt(0, MissingHeader)
+	} else {
+		if info.HeaderOffset > 0 {
+			parser.logErrorAt(info.HeaderOffset, HeaderNotAtStart.withDetail("offset %d", info.HeaderOffset))
+		}
+		if _, ok := known_versions[info.Version]; !ok {
+			parser.logErrorAt(info.HeaderOffset, UnknownVersion.withDetail("%s", info.Version))
+		}
+	}
+
+	// check the catalog version
+	if info.CatalogVersion != "" {
+		if _, ok := known_versions[info.CatalogVersion]; !ok {
+			parser.logErrorAt(0, UnknownVersion.withDetail("%s", info.CatalogVersion))
+		}
+		// the catalog version only overrides a header version that is earlier
+		if isLaterVersion(info.CatalogVersion, info.Version) {
+			parser.logErrorAt(0, CatalogVersionOverride.withDetail("%s overrides %s", info.CatalogVersion, info.Version))
+		} else if isLaterVersion(info.Version, info.CatalogVersion) {
+			parser.logErrorAt(0, CatalogVersionIgnored.withDetail("%s is ignored for %s", info.CatalogVersion, info.Version))
+		}
+	}
+
+	// check the last startxref marker, markers before data appended to the end of the file are not found
+	size, _ := parser.Seek(0, io.SeekEnd)
+	if info.StartXref < 0 && info.StartXrefCount == 0 {
+		parser.logErrorAt(size, MissingStartXref)
+	} else if info.StartXref < 0 {
+		trailing_offset := info.StartXrefOffsets[info.StartXrefCount - 1]
+		for _, eof := range info.EOFOffsets {
+			if eof > trailing_offset {
+				trailing_offset = eof + int64(len("%%EOF"))
+				break
+			}
+		}
+		for _, b := range parser.ReadRange(trailing_offset, 2) {
+			if b != '\r' && b != '\n' {
+				break
+			}
+			trailing_offset++
+		}
+		parser.logErrorAt(trailing_offset, TrailingData.withDetail("%d bytes", size - trailing_offset))
+	} else if info.StartXref >= size {
+		parser.logErrorAt(info.StartXrefOffsets[len(info.StartXrefOffsets) - 1], StartXrefBeyondEOF.withDetail("startxref %d, size %d", info.StartXref, size))
+	} else if !info.StartXrefValid {
+		parser.logErrorAt(info.StartXrefOffsets[len(info.StartXrefOffsets) - 1], InvalidStartXref.withDetail("startxref %d", info.StartXref))
+	}
+
+	// each end of file marker should end a revision with an xref table or stream
+	xref_offsets := parser.findXrefTableOffsets()
+	for _, definitions := range parser.definitions {
+		for _, definition := range definitions {
+			if definition.IsXrefStream {
+				xref_offsets = append(xref_offsets, definition.Offset)
+			}
+		}
+	}
+	for _, marker := range parser.findEOFMarkers() {
+		if parser.isXrefAt(marker.xref_offset) {
+			xref_offsets = append(xref_offsets, marker.xref_offset)
+		}
+	}
+	sort.Slice(xref_offsets, func(i, j int) bool { return xref_offsets[i] < xref_offsets[j] })
+	previous_eof := int64(-1)
+	for _, eof := range info.EOFOffsets {
+		i := sort.Search(len(xref_offsets), func(i int) bool { return xref_offsets[i] > previous_eof })
+		if i >= len(xref_offsets) || xref_offsets[i] > eof {
+			parser.logErrorAt(eof, EOFWithoutXref)
+		}
+		previous_eof = eof
+	}
+
+	return info
+}
+
+// isXrefAt returns true if there is an xref table or xref stream at offset
+// streams without a /Type are accepted if they have the /W array every xref stream needs
+func (parser *Parser) isXrefAt(offset int64) bool {
+	parser.Seek(offset, io.SeekStart)
+	if keyword := parser.ReadKeyword(); keyword == KEYWORD_XREF {
+		return true
+	}
+	parser.Seek(offset, io.SeekStart)
+	if _, _, ok := parser.ReadObjectHeader(); !ok {
+		return false
+	}
+	sink := parser.sink
+	parser.sink = nil
+	d := parser.ReadDictionary(noDecryptor)
+	parser.sink = sink
+	if t, ok := d.GetName("Type"); ok {
+		return t == "XRef"
+	}
+	_, ok := d.GetArray("W")
+	return ok
+}
+
+// isLaterVersion returns true if version is later than other, a version that can not be parsed is never later and any version is later than one that can not be parsed
+func isLaterVersion(version string, other string) bool {
+	major, minor, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	other_major, other_minor, ok := parseVersion(other)
+	if !ok {
+		return true
+	}
+	return major > other_major || major == other_major && minor > other_minor
+}
+
+// parseVersion returns the major and minor numbers of a version such as 1.7
+func parseVersion(version string) (int, int, bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// isBinaryMarker returns true if the line starts with a comment of at least 4 bytes above 127
+func isBinaryMarker(line []byte) bool {
+	if len(line) == 0 || line[0] != '%' {
+		return false
+	}
+	count := 0
+	for _, b := range line[1:lineEnd(line, 0)] {
+		if b > 127 {
+			count++
+		}
+	}
+	return count >= 4
+}
+
+// logErrorAt reports an anomaly at a file offset that is not in an object
+func (parser *Parser) logErrorAt(offset int64, anomaly_type AnomalyType) {
+	previous_location := parser.location
+	parser.location = Location{}
+	parser.Seek(offset, io.SeekStart)
+	parser.log_error(anomaly_type)
+	parser.location = previous_location
+}
@@ -2,48 +2,188 @@ package pdf
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/lzw"
 	"compress/zlib"
 	"encoding/binary"
+	"hash/adler32"
 	"io"
 	"math"
 	"strconv"
 	tiff_lzw "golang.org/x/image/tiff/lzw"
 )
 
+// statuses of the filters of a stream
+const (
+	FilterDecoded = "decoded"
+	FilterPartial = "partial"
+	FilterFailed = "failed"
+	FilterUndecoded = "undecoded"
+	FilterUnknown = "unknown"
+	FilterSkipped = "skipped"
+)
+
+// full names of the abbreviated filter names of inline images
+var filter_abbreviations = map[string]string{
+	"AHx": "ASCIIHexDecode",
+	"A85": "ASCII85Decode",
+	"LZW": "LZWDecode",
+	"Fl": "FlateDecode",
+	"RL": "RunLengthDecode",
+	"CCF": "CCITTFaxDecode",
+	"DCT": "DCTDecode",
+}
+
+// filters that are decoded
+var decoded_filters = map[string]interface{}{"ASCIIHexDecode": nil, "ASCII85Decode": nil, "LZWDecode": nil, "FlateDecode": nil, "RunLengthDecode": nil, "CCITTFaxDecode": nil, "JBIG2Decode": nil}
+
+// filters that are known but left encoded for the reader of the stream
+var undecoded_filters = map[string]interface{}{"Crypt": nil, "DCTDecode": nil, "JPXDecode": nil}
+
+// FilterResult is the outcome of applying a filter of a stream
+// name is the filter name in the stream dictionary and filter is the name it resolves to, which differs for abbreviated names
+// offset is where decoding stopped in the input of the filter, it is the size of the input if all of it was decoded
+// filters after a filter that failed or is unknown or undecoded are skipped
+type FilterResult struct {
+	Name string `json:"name"`
+	Filter string `json:"filter"`
+	Status string `json:"status"`
+	Offset int64 `json:"offset"`
+	Error string `json:"error,omitempty"`
+}
+
+// DecodeLimits bounds the size of decoded streams to stop decompression bombs, a limit of 0 is no limit
+// the document size is the total decoded size of the streams read by a parser
+// the ratio is the decoded size over the encoded size of a stream, it does not limit streams that decode to less than 1 MiB
+type DecodeLimits struct {
+	MaxStreamSize int64
+	MaxDocumentSize int64
+	MaxRatio float64
+}
+
+// DefaultDecodeLimits are the decode limits of new parsers and of the exported filter functions
+var DefaultDecodeLimits = DecodeLimits{256 << 20, 1 << 30, 4096}
+
+// decoded size below which the expansion ratio is not limited
+var decode_ratio_min_size int64 = 1 << 20
+
+// maxSize returns the maximum decoded size of a stream of encoded_size bytes and the name of the limit that sets it
+// document_size is the size already decoded from the document
+func (limits DecodeLimits) maxSize(encoded_size int64, document_size int64) (int64, string) {
+	max_size, limit := int64(math.MaxInt64), ""
+	if limits.MaxStreamSize > 0 {
+		max_size, limit = limits.MaxStreamSize, "stream size"
+	}
+	if limits.MaxDocumentSize > 0 && limits.MaxDocumentSize - document_size < max_size {
+		max_size, limit = limits.MaxDocumentSize - document_size, "document size"
+		if max_size < 0 {
+			max_size = 0
+		}
+	}
+	if limits.MaxRatio > 0 && limits.MaxRatio * float64(encoded_size) < float64(max_size) {
+		ratio_size := int64(limits.MaxRatio * float64(encoded_size))
+		if ratio_size < decode_ratio_min_size {
+			ratio_size = decode_ratio_min_size
+		}
+		if ratio_size < max_size {
+			max_size, limit = ratio_size, "expansion ratio"
+		}
+	}
+	return max_size, limit
+}
+
+// defaultMaxSize returns the maximum decoded size of data under the default decode limits
+func defaultMaxSize(data []byte) int64 {
+	max_size, _ := DefaultDecodeLimits.maxSize(int64(len(data)), 0)
+	return max_size
+}
+
+// filterName returns the full name of a filter, false if the filter is unknown
+func filterName(name string) (string, bool) {
+	if filter, ok := filter_abbreviations[name]; ok {
+		return filter, true
+	}
+	_, decoded := decoded_filters[name]
+	_, undecoded := undecoded_filters[name]
+	return name, decoded || undecoded
+}
+
 func DecodeStream(filter string, data []byte, decode_parms Dictionary) []byte {
+	filter, _ = filterName(filter)
+	decoded_data, _, err := decodeFilter(filter, data, decode_parms, defaultMaxSize(data), func(AnomalyType) {})
+	if err != nil && len(decoded_data) == 0 {
+		return data
+	}
+	return decoded_data
+}
+
+// decodeFilter applies a filter and returns where decoding stopped in data if it failed
+// decoding stops with DecodeLimitError once more than max_size bytes are decoded, the first max_size bytes are returned
+// unknown and undecoded filters return the data unchanged, jbig2 segment anomalies are reported
+func decodeFilter(filter string, data []byte, decode_parms Dictionary, max_size int64, report func(AnomalyType)) ([]byte, int64, error) {
 	// do nothing if data is empty
 	if len(data) == 0 {
-		return data
+		return data, 0, nil
 	}
 
 	// apply hex filter
 	if filter == "ASCIIHexDecode" {
-		return ASCIIHexDecode(data)
+		return limitSize(ASCIIHexDecode(data), int64(len(data)), nil, max_size)
 	}
 
 	// apply ascii 85 filter
 	if filter == "ASCII85Decode" {
-		return ASCII85Decode(data)
+		return limitSize(ASCII85Decode(data), int64(len(data)), nil, max_size)
 	}
 
 	// apply run length filter
 	if filter == "RunLengthDecode" {
-		return RunLengthDecode(data)
+		return runLengthDecode(data, max_size)
 	}
 
 	// apply zlib filter
 	if filter == "FlateDecode" {
-		return FlateDecode(data, decode_parms)
+		return flateDecode(data, decode_parms, max_size, report)
 	}
 
 	// apply lzw filter
 	if filter == "LZWDecode" {
-		return LZWDecode(data, decode_parms)
+		return lzwDecode(data, decode_parms, max_size)
+	}
+
+	// apply fax filter
+	if filter == "CCITTFaxDecode" {
+		return ccittFaxDecode(data, decode_parms, max_size)
+	}
+
+	// apply jbig2 filter
+	if filter == "JBIG2Decode" {
+		decoded_data, offset, err := decodeJBIG2(data, decode_parms, max_size, report)
+		return limitSize(decoded_data, offset, err, max_size)
 	}
 
 	// filter is not supported
-	return data
+	return data, 0, nil
+}
+
+// limitSize cuts decoded data that is larger than max_size
+func limitSize(decoded_data []byte, offset int64, err error, max_size int64) ([]byte, int64, error) {
+	if int64(len(decoded_data)) > max_size {
+		return decoded_data[:max_size], offset, DecodeLimitError
+	}
+	return decoded_data, offset, err
+}
+
+// readLimited reads until the end of the data of reader or until max_size bytes are read, it is an error if more data follows
+func readLimited(reader io.Reader, max_size int64) ([]byte, error) {
+	var decoded_data bytes.Buffer
+	_, err := decoded_data.ReadFrom(io.LimitReader(reader, max_size))
+	if err == nil && int64(decoded_data.Len()) == max_size {
+		if n, _ := io.ReadFull(reader, make([]byte, 1)); n > 0 {
+			err = DecodeLimitError
+		}
+	}
+	return decoded_data.Bytes(), err
 }
 
 func ASCIIHexDecode(data []byte) []byte {
@@ -163,8 +303,19 @@ func ASCII85Decode(data []byte) []byte {
 }
 
 func RunLengthDecode(data []byte) []byte {
+	decoded_data, _, _ := runLengthDecode(data, defaultMaxSize(data))
+	return decoded_data
+}
+
+// runLengthDecode decodes runs until the end of data marker, a run cut short by the end of the data is truncated
+func runLengthDecode(data []byte, max_size int64) ([]byte, int64, error) {
 	var decoded_data bytes.Buffer
 	for i := 0; i < len(data); {
+		// stop at the run that exceeds the maximum size
+		if int64(decoded_data.Len()) > max_size {
+			return decoded_data.Bytes()[:max_size], int64(i), DecodeLimitError
+		}
+
 		// get length byte
 		length := int(data[i])
 
@@ -178,13 +329,13 @@ func RunLengthDecode(data []byte) []byte {
 			// increment index
 			i++
 			if i >= len(data) {
-				break
+				return decoded_data.Bytes(), int64(i - 1), FilterTruncatedError
 			}
 
 			// copy as much data as we can up to length
 			if i + length > len(data) {
 				decoded_data.Write(data[i:])
-				break
+				return decoded_data.Bytes(), int64(i - 1), FilterTruncatedError
 			} else {
 				decoded_data.Write(data[i:i + length])
 				i += length
@@ -193,7 +344,7 @@ func RunLengthDecode(data []byte) []byte {
 			// increment index
 			i++
 			if i >= len(data) {
-				break
+				return decoded_data.Bytes(), int64(i - 1), FilterTruncatedError
 			}
 
 			// copy byte 257 - length times
@@ -204,52 +355,115 @@ func RunLengthDecode(data []byte) []byte {
 			i++
 		}
 	}
-	return decoded_data.Bytes()
+	return limitSize(decoded_data.Bytes(), int64(len(data)), nil, max_size)
 }
 
 func FlateDecode(data []byte, decode_parms Dictionary) []byte {
-	// create zlib reader from data
-	byte_reader := bytes.NewReader(data)
-	zlib_reader, err := zlib.NewReader(byte_reader)
-	if err != nil {
+	decoded_data, _, err := flateDecode(data, decode_parms, defaultMaxSize(data), func(AnomalyType) {})
+	if err != nil && len(decoded_data) == 0 {
 		return data
 	}
-	defer zlib_reader.Close()
+	return decoded_data
+}
 
-	// decode data with zlib reader and return
-	var decoded_data bytes.Buffer
-	bytes_read, err := decoded_data.ReadFrom(zlib_reader)
-	if bytes_read == 0 && err != nil {
-		return data
+// flateDecode inflates data and reverses the predictor, the offset of a failure is the number of bytes read before it
+// data with an invalid zlib header is inflated as raw deflate data and with its header skipped, whichever decodes more is kept
+// a checksum that is missing or does not match is reported and the data is kept
+func flateDecode(data []byte, decode_parms Dictionary, max_size int64, report func(AnomalyType)) ([]byte, int64, error) {
+	var decoded_data []byte
+	var offset int64
+	var err error
+	if zlibHeader(data) {
+		decoded_data, offset, err = inflate(data, 2, max_size)
+
+		// check the adler-32 checksum that follows the deflate data
+		if err == nil {
+			if offset + 4 > int64(len(data)) {
+				report(FlateMissingChecksum)
+			} else if binary.BigEndian.Uint32(data[offset:]) != adler32.Checksum(decoded_data) {
+				report(FlateChecksumMismatch)
+			} else {
+				offset += 4
+			}
+		}
+	} else {
+		// inflate as raw deflate data and with the header skipped
+		decoded_data, offset, err = inflate(data, 0, max_size)
+		recovery := "decoded as raw deflate data"
+		skipped_data, skipped_offset, skipped_err := inflate(data, 2, max_size)
+		if len(skipped_data) > len(decoded_data) || (len(skipped_data) == len(decoded_data) && err != nil && skipped_err == nil) {
+			decoded_data, offset, err = skipped_data, skipped_offset, skipped_err
+			recovery = "decoded after skipping the header"
+		}
+		if len(decoded_data) == 0 {
+			return nil, 0, zlib.ErrHeader
+		}
+		report(FlateInvalidHeader.withDetail("%s", recovery))
+	}
+
+	// the longest prefix that inflated is kept
+	if len(decoded_data) == 0 && err != nil {
+		return nil, offset, err
 	}
 
 	// reverse predictor
-	return ReversePredictor(decoded_data.Bytes(), decode_parms)
+	return ReversePredictor(decoded_data, decode_parms), offset, err
+}
+
+// zlibHeader returns true if data starts with a valid zlib header for deflate data without a preset dictionary
+func zlibHeader(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	cmf, flg := data[0], data[1]
+	return cmf & 0x0f == 8 && cmf >> 4 <= 7 && flg & 0x20 == 0 && (uint16(cmf) << 8 | uint16(flg)) % 31 == 0
+}
+
+// inflate inflates the raw deflate data at start up to max_size bytes and returns the number of bytes of data read
+// the data inflated before an error is returned with the error
+func inflate(data []byte, start int, max_size int64) ([]byte, int64, error) {
+	if start > len(data) {
+		return nil, int64(len(data)), io.ErrUnexpectedEOF
+	}
+	byte_reader := bytes.NewReader(data[start:])
+	flate_reader := flate.NewReader(byte_reader)
+	defer flate_reader.Close()
+	decoded_data, err := readLimited(flate_reader, max_size)
+	return decoded_data, int64(len(data) - byte_reader.Len()), err
 }
 
 func LZWDecode(data []byte, decode_parms Dictionary) []byte {
+	decoded_data, _, err := lzwDecode(data, decode_parms, defaultMaxSize(data))
+	if err != nil && len(decoded_data) == 0 {
+		return data
+	}
+	return decoded_data
+}
+
+// lzwDecode decompresses data and reverses the predictor, the offset of a failure is the number of bytes read before it
+func lzwDecode(data []byte, decode_parms Dictionary, max_size int64) ([]byte, int64, error) {
 	// create lzw reader from data using different implementation based on early change parm
+	byte_reader := bytes.NewReader(data)
 	var lzw_reader io.ReadCloser
 	early_change, ok := decode_parms.GetInt("EarlyChange")
 	if !ok {
 		early_change = 1
 	}
 	if early_change == 0 {
-		lzw_reader = lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8)
+		lzw_reader = lzw.NewReader(byte_reader, lzw.MSB, 8)
 	} else {
-		lzw_reader = tiff_lzw.NewReader(bytes.NewReader(data), tiff_lzw.MSB, 8)
+		lzw_reader = tiff_lzw.NewReader(byte_reader, tiff_lzw.MSB, 8)
 	}
 	defer lzw_reader.Close()
 
-	// decode data with lzw reader and return
-	var decoded_data bytes.Buffer
-	bytes_read, err := decoded_data.ReadFrom(lzw_reader)
-	if bytes_read == 0 && err != nil {
-		return data
+	// decode data with lzw reader
+	decoded_data, err := readLimited(lzw_reader, max_size)
+	if len(decoded_data) == 0 && err != nil {
+		return nil, int64(len(data) - byte_reader.Len()), err
 	}
 
 	// reverse predictor
-	return ReversePredictor(decoded_data.Bytes(), decode_parms)
+	return ReversePredictor(decoded_data, decode_parms), int64(len(data) - byte_reader.Len()), err
 }
 
 func ReversePredictor(data []byte, decode_parms Dictionary) []byte {
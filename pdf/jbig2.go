@@ -0,0 +1,461 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// largest page, region or symbol bitmap decoded in pixels, larger bitmaps are reported and not decoded
+var jbig2_max_bitmap_pixels int64 = 1 << 28
+
+// most symbols a symbol dictionary or text region may use
+var jbig2_max_symbols = 1 << 16
+
+// segment types
+const (
+	jbig2SymbolDictionary = 0
+	jbig2IntermediateTextRegion = 4
+	jbig2ImmediateTextRegion = 6
+	jbig2ImmediateLosslessTextRegion = 7
+	jbig2PatternDictionary = 16
+	jbig2IntermediateHalftoneRegion = 20
+	jbig2ImmediateHalftoneRegion = 22
+	jbig2ImmediateLosslessHalftoneRegion = 23
+	jbig2IntermediateGenericRegion = 36
+	jbig2ImmediateGenericRegion = 38
+	jbig2ImmediateLosslessGenericRegion = 39
+	jbig2IntermediateRefinementRegion = 40
+	jbig2ImmediateRefinementRegion = 42
+	jbig2ImmediateLosslessRefinementRegion = 43
+	jbig2PageInformation = 48
+	jbig2EndOfPage = 49
+	jbig2EndOfStripe = 50
+	jbig2EndOfFile = 51
+	jbig2Profiles = 52
+	jbig2Tables = 53
+	jbig2Extension = 62
+)
+
+var jbig2_segment_names = map[int]string{
+	jbig2SymbolDictionary: "symbol dictionary",
+	jbig2IntermediateTextRegion: "intermediate text region",
+	jbig2ImmediateTextRegion: "text region",
+	jbig2ImmediateLosslessTextRegion: "lossless text region",
+	jbig2PatternDictionary: "pattern dictionary",
+	jbig2IntermediateHalftoneRegion: "intermediate halftone region",
+	jbig2ImmediateHalftoneRegion: "halftone region",
+	jbig2ImmediateLosslessHalftoneRegion: "lossless halftone region",
+	jbig2IntermediateGenericRegion: "intermediate generic region",
+	jbig2ImmediateGenericRegion: "generic region",
+	jbig2ImmediateLosslessGenericRegion: "lossless generic region",
+	jbig2IntermediateRefinementRegion: "intermediate refinement region",
+	jbig2ImmediateRefinementRegion: "refinement region",
+	jbig2ImmediateLosslessRefinementRegion: "lossless refinement region",
+	jbig2PageInformation: "page information",
+	jbig2EndOfPage: "end of page",
+	jbig2EndOfStripe: "end of stripe",
+	jbig2EndOfFile: "end of file",
+	jbig2Profiles: "profiles",
+	jbig2Tables: "tables",
+	jbig2Extension: "extension",
+}
+
+// jbig2Segment is a segment of a jbig2 stream and the results of decoding it
+// symbols are the symbols exported by a symbol dictionary, bitmap is the result of an intermediate region and table is the huffman table of a tables segment
+// unknown length is set for generic regions that end with a row count instead of having a data length
+// failed is set if the segment could not be decoded so segments that refer to it are skipped
+type jbig2Segment struct {
+	number uint32
+	segment_type int
+	referred []uint32
+	page uint32
+	data []byte
+	unknown_length bool
+	symbols []*jbig2Bitmap
+	bitmap *jbig2Bitmap
+	table *jbig2HuffmanTable
+	generic_contexts []jbig2Context
+	refinement_contexts []jbig2Context
+	failed bool
+}
+
+// jbig2Decoder decodes the segments of a jbig2 stream onto a page and reports anything unusual about them
+type jbig2Decoder struct {
+	report func(AnomalyType)
+	segments map[uint32]*jbig2Segment
+	segment *jbig2Segment
+	page *jbig2Bitmap
+	page_striped bool
+	page_default_pixel int
+	done bool
+	max_size int64
+	allocated int64
+	limited bool
+}
+
+// JBIG2Decode decodes an embedded jbig2 stream using the symbols and tables in the /JBIG2Globals stream of the decode parms
+func JBIG2Decode(data []byte, decode_parms Dictionary) []byte {
+	decoded_data, _, err := decodeJBIG2(data, decode_parms, defaultMaxSize(data), func(AnomalyType) {})
+	if err != nil {
+		return data
+	}
+	return decoded_data
+}
+
+// decodeJBIG2 decodes an embedded jbig2 stream and reports anomalies in its segments
+// the page is 1 bit per pixel with black pixels 0, decoding fails if there is no page
+// decoding stops with DecodeLimitError once the page, region and symbol bitmaps together need more than max_size bytes
+func decodeJBIG2(data []byte, decode_parms Dictionary, max_size int64, report func(AnomalyType)) ([]byte, int64, error) {
+	decoder := &jbig2Decoder{report, map[uint32]*jbig2Segment{}, nil, nil, false, 0, false, max_size, 0, false}
+
+	// decode the global segments first, they are shared by every jbig2 stream that uses them
+	if globals, ok := decode_parms.GetStream("JBIG2Globals"); ok {
+		decoder.decodeSegments(globals, true)
+	}
+	decoder.done = decoder.limited
+	decoder.decodeSegments(data, false)
+
+	if decoder.limited {
+		if decoder.page == nil {
+			return nil, 0, DecodeLimitError
+		}
+		return decoder.page.pack(), 0, DecodeLimitError
+	}
+	if decoder.page == nil {
+		return nil, 0, JBIG2MissingPageError
+	}
+	return decoder.page.pack(), int64(len(data)), nil
+}
+
+// anomaly reports an anomaly in the current segment
+func (decoder *jbig2Decoder) anomaly(anomaly_type AnomalyType, format string, args ...interface{}) {
+	detail := fmt.Sprintf("segment %d", decoder.segment.number)
+	if format != "" {
+		detail += ", " + fmt.Sprintf(format, args...)
+	}
+	decoder.report(anomaly_type.withDetail("%s", detail))
+}
+
+// decodeSegments reads and decodes each segment of the data until the end of the page or file
+func (decoder *jbig2Decoder) decodeSegments(data []byte, globals bool) {
+	for position := 0; position < len(data) && !decoder.done; {
+		segment, next, ok := readJBIG2Segment(data, position)
+		if !ok {
+			decoder.segment = &jbig2Segment{}
+			decoder.report(JBIG2InvalidSegment.withDetail("truncated segment header at %d", position))
+			return
+		}
+		position = next
+		decoder.segments[segment.number] = segment
+		decoder.segment = segment
+
+		// the globals should only hold dictionaries and tables
+		if globals && segment.segment_type != jbig2SymbolDictionary && segment.segment_type != jbig2PatternDictionary && segment.segment_type != jbig2Tables && segment.segment_type != jbig2Extension {
+			decoder.anomaly(JBIG2UnusualSegment, "%s in globals", segment.name())
+		}
+
+		decoder.decodeSegment(segment)
+	}
+}
+
+// readJBIG2Segment reads the segment header and data at position, returns the position of the next segment
+func readJBIG2Segment(data []byte, position int) (*jbig2Segment, int, bool) {
+	if len(data) - position < 6 {
+		return nil, 0, false
+	}
+	segment := &jbig2Segment{}
+	segment.number = binary.BigEndian.Uint32(data[position:])
+	flags := data[position + 4]
+	segment.segment_type = int(flags & 0x3f)
+	position += 5
+
+	// the referred to segment count is in the top 3 bits, a count of 7 is followed by the long form count and retain bits
+	count := int(data[position] >> 5)
+	if count == 7 {
+		if len(data) - position < 4 {
+			return nil, 0, false
+		}
+		count = int(binary.BigEndian.Uint32(data[position:]) & 0x1fffffff)
+		position += 4 + (count + 8) / 8
+	} else if count > 4 {
+		return nil, 0, false
+	} else {
+		position++
+	}
+
+	// referred to segment numbers are as small as the segment number allows
+	number_size := 4
+	if segment.number <= 256 {
+		number_size = 1
+	} else if segment.number <= 65536 {
+		number_size = 2
+	}
+	if count > (len(data) - position) / number_size {
+		return nil, 0, false
+	}
+	for i := 0; i < count; i++ {
+		if number_size == 1 {
+			segment.referred = append(segment.referred, uint32(data[position]))
+		} else if number_size == 2 {
+			segment.referred = append(segment.referred, uint32(binary.BigEndian.Uint16(data[position:])))
+		} else {
+			segment.referred = append(segment.referred, binary.BigEndian.Uint32(data[position:]))
+		}
+		position += number_size
+	}
+
+	// page association and data length
+	page_size := 1
+	if flags & 0x40 != 0 {
+		page_size = 4
+	}
+	if len(data) - position < page_size + 4 {
+		return nil, 0, false
+	}
+	if page_size == 1 {
+		segment.page = uint32(data[position])
+	} else {
+		segment.page = binary.BigEndian.Uint32(data[position:])
+	}
+	position += page_size
+	length := binary.BigEndian.Uint32(data[position:])
+	position += 4
+
+	// immediate generic regions may have an unknown length
+	if length == 0xffffffff && segment.segment_type == jbig2ImmediateGenericRegion {
+		size, ok := jbig2UnknownLength(data[position:])
+		if !ok {
+			return nil, 0, false
+		}
+		length = uint32(size)
+		segment.unknown_length = true
+	}
+	if int64(length) > int64(len(data) - position) {
+		return nil, 0, false
+	}
+	segment.data = data[position:position + int(length)]
+	return segment, position + int(length), true
+}
+
+// jbig2UnknownLength returns the length of generic region data that ends with an end marker and a row count
+func jbig2UnknownLength(data []byte) (int, bool) {
+	if len(data) < 18 {
+		return 0, false
+	}
+	marker := []byte{0xff, 0xac}
+	if data[17] & 1 != 0 {
+		marker = []byte{0x00, 0x00}
+	}
+	index := bytes.Index(data[18:], marker)
+	if index < 0 || len(data) < 18 + index + 6 {
+		return 0, false
+	}
+	return 18 + index + 6, true
+}
+
+func (segment *jbig2Segment) name() string {
+	if name, ok := jbig2_segment_names[segment.segment_type]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", segment.segment_type)
+}
+
+// decodeSegment decodes a segment according to its type
+func (decoder *jbig2Decoder) decodeSegment(segment *jbig2Segment) {
+	segment_type := segment.segment_type
+
+	// intermediate regions are only useful to refine them again, encoders do not write them
+	if segment_type == jbig2IntermediateTextRegion || segment_type == jbig2IntermediateHalftoneRegion || segment_type == jbig2IntermediateGenericRegion || segment_type == jbig2IntermediateRefinementRegion {
+		decoder.anomaly(JBIG2UnusualSegment, "%s", segment.name())
+	}
+
+	if segment_type == jbig2SymbolDictionary {
+		segment.failed = !decoder.decodeSymbolDictionary(segment)
+	} else if segment_type == jbig2IntermediateTextRegion || segment_type == jbig2ImmediateTextRegion || segment_type == jbig2ImmediateLosslessTextRegion {
+		decoder.decodeRegion(segment, decoder.decodeTextRegion)
+	} else if segment_type == jbig2IntermediateGenericRegion || segment_type == jbig2ImmediateGenericRegion || segment_type == jbig2ImmediateLosslessGenericRegion {
+		decoder.decodeRegion(segment, decoder.decodeGenericRegion)
+	} else if segment_type == jbig2IntermediateRefinementRegion || segment_type == jbig2ImmediateRefinementRegion || segment_type == jbig2ImmediateLosslessRefinementRegion {
+		decoder.decodeRegion(segment, decoder.decodeRefinementRegion)
+	} else if segment_type == jbig2PatternDictionary || segment_type == jbig2IntermediateHalftoneRegion || segment_type == jbig2ImmediateHalftoneRegion || segment_type == jbig2ImmediateLosslessHalftoneRegion {
+		segment.failed = true
+		decoder.anomaly(JBIG2UnsupportedSegment, "%s", segment.name())
+	} else if segment_type == jbig2Tables {
+		segment.failed = !decoder.decodeTables(segment)
+	} else if segment_type == jbig2PageInformation {
+		decoder.decodePageInformation(segment)
+	} else if segment_type == jbig2EndOfStripe {
+		if len(segment.data) < 4 {
+			decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		} else if decoder.page != nil && decoder.page_striped {
+			decoder.growPage(int64(binary.BigEndian.Uint32(segment.data)) + 1)
+		}
+	} else if segment_type == jbig2EndOfPage || segment_type == jbig2EndOfFile {
+		decoder.done = decoder.page != nil || segment_type == jbig2EndOfFile
+	} else if segment_type != jbig2Profiles && segment_type != jbig2Extension {
+		decoder.anomaly(JBIG2UnknownSegment, "%s", segment.name())
+	}
+}
+
+// decodePageInformation creates the page, only the first page of the stream is decoded
+func (decoder *jbig2Decoder) decodePageInformation(segment *jbig2Segment) {
+	if len(segment.data) < 19 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return
+	}
+	if decoder.page != nil {
+		decoder.anomaly(JBIG2UnusualSegment, "second page")
+		decoder.done = true
+		return
+	}
+
+	// pages of unknown height grow with each stripe
+	width := int64(binary.BigEndian.Uint32(segment.data))
+	height := int64(binary.BigEndian.Uint32(segment.data[4:]))
+	decoder.page_striped = height == 0xffffffff
+	if decoder.page_striped {
+		height = 0
+	}
+	decoder.page_default_pixel = int(segment.data[16] >> 2 & 1)
+	page, ok := decoder.newBitmap(width, height)
+	if !ok {
+		decoder.done = true
+		return
+	}
+	page.fill(decoder.page_default_pixel)
+	decoder.page = page
+}
+
+// growPage extends a striped page to height
+func (decoder *jbig2Decoder) growPage(height int64) bool {
+	if height <= int64(decoder.page.height) {
+		return true
+	}
+	page, ok := decoder.newBitmap(int64(decoder.page.width), height)
+	if !ok {
+		return false
+	}
+	page.fill(decoder.page_default_pixel)
+	copy(page.data, decoder.page.data)
+	decoder.page = page
+	return true
+}
+
+// newBitmap creates a bitmap if it is within the size limit, otherwise it is reported
+// decoding stops once the bitmaps created together exceed the maximum decoded size
+func (decoder *jbig2Decoder) newBitmap(width int64, height int64) (*jbig2Bitmap, bool) {
+	if width < 0 || height < 0 || width > jbig2_max_bitmap_pixels || height > jbig2_max_bitmap_pixels || width * height > jbig2_max_bitmap_pixels {
+		decoder.anomaly(JBIG2OversizedBitmap, "%dx%d", width, height)
+		return nil, false
+	}
+	decoder.allocated += (width + 7) / 8 * height
+	if decoder.allocated > decoder.max_size {
+		decoder.limited = true
+		decoder.done = true
+		return nil, false
+	}
+	return newJBIG2Bitmap(int(width), int(height)), true
+}
+
+// jbig2RegionInfo is the size, location and combination operator of a region
+type jbig2RegionInfo struct {
+	width int64
+	height int64
+	x int64
+	y int64
+	combination_operator int
+}
+
+func readJBIG2RegionInfo(data []byte) (jbig2RegionInfo, bool) {
+	if len(data) < 17 {
+		return jbig2RegionInfo{}, false
+	}
+	return jbig2RegionInfo{
+		int64(binary.BigEndian.Uint32(data)),
+		int64(binary.BigEndian.Uint32(data[4:])),
+		int64(binary.BigEndian.Uint32(data[8:])),
+		int64(binary.BigEndian.Uint32(data[12:])),
+		int(data[16] & 7),
+	}, true
+}
+
+// decodeRegion decodes a region segment and keeps the result of intermediate regions or combines it with the page
+func (decoder *jbig2Decoder) decodeRegion(segment *jbig2Segment, decode func(*jbig2Segment, jbig2RegionInfo) (*jbig2Bitmap, bool)) {
+	info, ok := readJBIG2RegionInfo(segment.data)
+	if !ok {
+		segment.failed = true
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return
+	}
+
+	// the height of a region of unknown length is the row count at the end of its data
+	if segment.unknown_length {
+		info.height = int64(binary.BigEndian.Uint32(segment.data[len(segment.data) - 4:]))
+	}
+
+	// regions of a striped page extend it
+	intermediate := segment.segment_type == jbig2IntermediateTextRegion || segment.segment_type == jbig2IntermediateGenericRegion || segment.segment_type == jbig2IntermediateRefinementRegion
+	if !intermediate {
+		if decoder.page == nil {
+			segment.failed = true
+			decoder.anomaly(JBIG2InvalidSegment, "%s without a page", segment.name())
+			return
+		}
+		if decoder.page_striped && !decoder.growPage(info.y + info.height) {
+			segment.failed = true
+			return
+		}
+	}
+
+	// a partly decoded region is still used
+	bitmap, ok := decode(segment, info)
+	segment.failed = !ok
+	if bitmap == nil {
+		segment.failed = true
+		return
+	}
+	if intermediate {
+		segment.bitmap = bitmap
+	} else {
+		decoder.page.compose(bitmap, info.x, info.y, info.combination_operator)
+	}
+}
+
+// referredSegments returns the segments the segment refers to, false if one is missing or could not be decoded
+func (decoder *jbig2Decoder) referredSegments(segment *jbig2Segment) ([]*jbig2Segment, bool) {
+	referred := []*jbig2Segment{}
+	for _, number := range segment.referred {
+		referred_segment, ok := decoder.segments[number]
+		if !ok || number >= segment.number {
+			decoder.anomaly(JBIG2InvalidSegment, "refers to missing segment %d", number)
+			return nil, false
+		}
+		if referred_segment.failed {
+			return nil, false
+		}
+		referred = append(referred, referred_segment)
+	}
+	return referred, true
+}
+
+// referredSymbols returns the symbols exported by the symbol dictionaries the segment refers to
+func (decoder *jbig2Decoder) referredSymbols(segment *jbig2Segment) ([]*jbig2Bitmap, *jbig2Segment, bool) {
+	referred, ok := decoder.referredSegments(segment)
+	if !ok {
+		return nil, nil, false
+	}
+	symbols := []*jbig2Bitmap{}
+	var last_dictionary *jbig2Segment
+	for _, referred_segment := range referred {
+		if referred_segment.segment_type == jbig2SymbolDictionary {
+			if len(referred_segment.symbols) > jbig2_max_symbols - len(symbols) {
+				decoder.anomaly(JBIG2TooManySymbols, "more than %d", jbig2_max_symbols)
+				return nil, nil, false
+			}
+			symbols = append(symbols, referred_segment.symbols...)
+			last_dictionary = referred_segment
+		}
+	}
+	return symbols, last_dictionary, true
+}
@@ -0,0 +1,239 @@
+package pdf
+
+// number of bytes past the end of the data or its end marker an arithmetic decoder may read before the data is considered truncated
+var jbig2_max_overrun = 32
+
+// jbig2QeEntry is a probability estimate of the arithmetic decoder and the states that follow it
+type jbig2QeEntry struct {
+	qe uint32
+	nmps uint8
+	nlps uint8
+	switch_mps bool
+}
+
+var jbig2_qe_table = []jbig2QeEntry{
+	jbig2QeEntry{0x5601, 1, 1, true},
+	jbig2QeEntry{0x3401, 2, 6, false},
+	jbig2QeEntry{0x1801, 3, 9, false},
+	jbig2QeEntry{0x0AC1, 4, 12, false},
+	jbig2QeEntry{0x0521, 5, 29, false},
+	jbig2QeEntry{0x0221, 38, 33, false},
+	jbig2QeEntry{0x5601, 7, 6, true},
+	jbig2QeEntry{0x5401, 8, 14, false},
+	jbig2QeEntry{0x4801, 9, 14, false},
+	jbig2QeEntry{0x3801, 10, 14, false},
+	jbig2QeEntry{0x3001, 11, 17, false},
+	jbig2QeEntry{0x2401, 12, 18, false},
+	jbig2QeEntry{0x1C01, 13, 20, false},
+	jbig2QeEntry{0x1601, 29, 21, false},
+	jbig2QeEntry{0x5601, 15, 14, true},
+	jbig2QeEntry{0x5401, 16, 14, false},
+	jbig2QeEntry{0x5101, 17, 15, false},
+	jbig2QeEntry{0x4801, 18, 16, false},
+	jbig2QeEntry{0x3801, 19, 17, false},
+	jbig2QeEntry{0x3401, 20, 18, false},
+	jbig2QeEntry{0x3001, 21, 19, false},
+	jbig2QeEntry{0x2801, 22, 19, false},
+	jbig2QeEntry{0x2401, 23, 20, false},
+	jbig2QeEntry{0x2201, 24, 21, false},
+	jbig2QeEntry{0x1C01, 25, 22, false},
+	jbig2QeEntry{0x1801, 26, 23, false},
+	jbig2QeEntry{0x1601, 27, 24, false},
+	jbig2QeEntry{0x1401, 28, 25, false},
+	jbig2QeEntry{0x1201, 29, 26, false},
+	jbig2QeEntry{0x1101, 30, 27, false},
+	jbig2QeEntry{0x0AC1, 31, 28, false},
+	jbig2QeEntry{0x09C1, 32, 29, false},
+	jbig2QeEntry{0x08A1, 33, 30, false},
+	jbig2QeEntry{0x0521, 34, 31, false},
+	jbig2QeEntry{0x0441, 35, 32, false},
+	jbig2QeEntry{0x02A1, 36, 33, false},
+	jbig2QeEntry{0x0221, 37, 34, false},
+	jbig2QeEntry{0x0141, 38, 35, false},
+	jbig2QeEntry{0x0111, 39, 36, false},
+	jbig2QeEntry{0x0085, 40, 37, false},
+	jbig2QeEntry{0x0049, 41, 38, false},
+	jbig2QeEntry{0x0025, 42, 39, false},
+	jbig2QeEntry{0x0015, 43, 40, false},
+	jbig2QeEntry{0x0009, 44, 41, false},
+	jbig2QeEntry{0x0005, 45, 42, false},
+	jbig2QeEntry{0x0001, 45, 43, false},
+	jbig2QeEntry{0x5601, 46, 46, false},
+}
+
+// jbig2Context is the state of an arithmetic decoding context, the index into the qe table and the more probable symbol
+type jbig2Context struct {
+	index uint8
+	mps int
+}
+
+// jbig2ArithDecoder is the MQ arithmetic decoder of T.88 Annex E
+type jbig2ArithDecoder struct {
+	data []byte
+	position int
+	c uint32
+	a uint32
+	ct int
+	overrun int
+}
+
+func newJBIG2ArithDecoder(data []byte) *jbig2ArithDecoder {
+	decoder := &jbig2ArithDecoder{data, 0, 0, 0x8000, 0, 0}
+	decoder.c = uint32(decoder.byteAt(0) ^ 0xff) << 16
+	decoder.byteIn()
+	decoder.c <<= 7
+	decoder.ct -= 7
+	return decoder
+}
+
+// byteAt returns the byte at position, the data is padded with 0xff
+func (decoder *jbig2ArithDecoder) byteAt(position int) byte {
+	if position < len(decoder.data) {
+		return decoder.data[position]
+	}
+	return 0xff
+}
+
+// exhausted returns true if the decoder has read far beyond the end of the data
+func (decoder *jbig2ArithDecoder) exhausted() bool {
+	return decoder.overrun > jbig2_max_overrun
+}
+
+func (decoder *jbig2ArithDecoder) byteIn() {
+	if decoder.position >= len(decoder.data) {
+		decoder.overrun++
+	}
+	if decoder.byteAt(decoder.position) == 0xff {
+		b1 := decoder.byteAt(decoder.position + 1)
+		if b1 > 0x8f {
+			// a marker ends the data, the decoder reads 1 bits past it
+			decoder.ct = 8
+			decoder.overrun++
+		} else {
+			decoder.position++
+			decoder.c += 0xfe00 - uint32(b1) << 9
+			decoder.ct = 7
+		}
+	} else {
+		decoder.position++
+		decoder.c += 0xff00 - uint32(decoder.byteAt(decoder.position)) << 8
+		decoder.ct = 8
+	}
+}
+
+func (decoder *jbig2ArithDecoder) renormalize() {
+	for {
+		if decoder.ct == 0 {
+			decoder.byteIn()
+		}
+		decoder.a <<= 1
+		decoder.c <<= 1
+		decoder.ct--
+		if decoder.a & 0x8000 != 0 {
+			break
+		}
+	}
+}
+
+// decode decodes a bit in a context
+func (decoder *jbig2ArithDecoder) decode(context *jbig2Context) int {
+	entry := jbig2_qe_table[context.index]
+	decoder.a -= entry.qe
+	d := context.mps
+	if decoder.c >> 16 < decoder.a {
+		if decoder.a & 0x8000 != 0 {
+			return d
+		}
+
+		// mps exchange
+		if decoder.a < entry.qe {
+			d = 1 - d
+			if entry.switch_mps {
+				context.mps = 1 - context.mps
+			}
+			context.index = entry.nlps
+		} else {
+			context.index = entry.nmps
+		}
+	} else {
+		decoder.c -= decoder.a << 16
+
+		// lps exchange
+		if decoder.a < entry.qe {
+			context.index = entry.nmps
+		} else {
+			d = 1 - d
+			if entry.switch_mps {
+				context.mps = 1 - context.mps
+			}
+			context.index = entry.nlps
+		}
+		decoder.a = entry.qe
+	}
+	decoder.renormalize()
+	return d
+}
+
+// jbig2IntDecoder decodes integers with the contexts of T.88 Annex A.2
+type jbig2IntDecoder struct {
+	contexts []jbig2Context
+}
+
+func newJBIG2IntDecoder() *jbig2IntDecoder {
+	return &jbig2IntDecoder{make([]jbig2Context, 512)}
+}
+
+// jbig2_int_ranges is the number of bits and offset of each range of integer values
+var jbig2_int_ranges = [][2]int{{2, 0}, {4, 4}, {6, 20}, {8, 84}, {12, 340}, {32, 4436}}
+
+// decode decodes an integer, false if it is the out of band value
+func (int_decoder *jbig2IntDecoder) decode(decoder *jbig2ArithDecoder) (int, bool) {
+	prev := 1
+	bit := func() int {
+		d := decoder.decode(&int_decoder.contexts[prev])
+		if prev < 256 {
+			prev = prev << 1 | d
+		} else {
+			prev = (prev << 1 | d) & 511 | 256
+		}
+		return d
+	}
+
+	// the sign is followed by a prefix that selects the range of the value
+	s := bit()
+	r := 0
+	for r < len(jbig2_int_ranges) - 1 && bit() == 1 {
+		r++
+	}
+	v := 0
+	for i := 0; i < jbig2_int_ranges[r][0]; i++ {
+		v = v << 1 | bit()
+	}
+	v += jbig2_int_ranges[r][1]
+
+	if s == 1 {
+		if v == 0 {
+			return 0, false
+		}
+		return -v, true
+	}
+	return v, true
+}
+
+// jbig2IDDecoder decodes symbol ids of a fixed number of bits with the contexts of T.88 Annex A.3
+type jbig2IDDecoder struct {
+	code_length uint
+	contexts []jbig2Context
+}
+
+func newJBIG2IDDecoder(code_length uint) *jbig2IDDecoder {
+	return &jbig2IDDecoder{code_length, make([]jbig2Context, 1 << (code_length + 1))}
+}
+
+func (id_decoder *jbig2IDDecoder) decode(decoder *jbig2ArithDecoder) int {
+	prev := 1
+	for i := uint(0); i < id_decoder.code_length; i++ {
+		prev = prev << 1 | decoder.decode(&id_decoder.contexts[prev])
+	}
+	return prev - 1 << id_decoder.code_length
+}
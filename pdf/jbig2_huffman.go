@@ -0,0 +1,477 @@
+package pdf
+
+import (
+	"encoding/binary"
+)
+
+// jbig2HuffmanLine is a line of a huffman table, the values from range low coded by a prefix and range length bits
+// lower lines count down from range low and out of band lines code no value
+type jbig2HuffmanLine struct {
+	prefix_length int
+	range_length int
+	range_low int
+	lower bool
+	oob bool
+}
+
+// standard huffman tables of T.88 Annex B, the lower and upper range lines and the out of band line are last
+var jbig2_standard_tables = map[int][]jbig2HuffmanLine{
+	1: []jbig2HuffmanLine{
+		jbig2HuffmanLine{1, 4, 0, false, false},
+		jbig2HuffmanLine{2, 8, 16, false, false},
+		jbig2HuffmanLine{3, 16, 272, false, false},
+		jbig2HuffmanLine{3, 32, 65808, false, false},
+	},
+	2: []jbig2HuffmanLine{
+		jbig2HuffmanLine{1, 0, 0, false, false},
+		jbig2HuffmanLine{2, 0, 1, false, false},
+		jbig2HuffmanLine{3, 0, 2, false, false},
+		jbig2HuffmanLine{4, 3, 3, false, false},
+		jbig2HuffmanLine{5, 6, 11, false, false},
+		jbig2HuffmanLine{6, 32, 75, false, false},
+		jbig2HuffmanLine{6, 0, 0, false, true},
+	},
+	3: []jbig2HuffmanLine{
+		jbig2HuffmanLine{8, 8, -256, false, false},
+		jbig2HuffmanLine{1, 0, 0, false, false},
+		jbig2HuffmanLine{2, 0, 1, false, false},
+		jbig2HuffmanLine{3, 0, 2, false, false},
+		jbig2HuffmanLine{4, 3, 3, false, false},
+		jbig2HuffmanLine{5, 6, 11, false, false},
+		jbig2HuffmanLine{8, 32, -257, true, false},
+		jbig2HuffmanLine{7, 32, 75, false, false},
+		jbig2HuffmanLine{6, 0, 0, false, true},
+	},
+	4: []jbig2HuffmanLine{
+		jbig2HuffmanLine{1, 0, 1, false, false},
+		jbig2HuffmanLine{2, 0, 2, false, false},
+		jbig2HuffmanLine{3, 0, 3, false, false},
+		jbig2HuffmanLine{4, 3, 4, false, false},
+		jbig2HuffmanLine{5, 6, 12, false, false},
+		jbig2HuffmanLine{5, 32, 76, false, false},
+	},
+	5: []jbig2HuffmanLine{
+		jbig2HuffmanLine{7, 8, -255, false, false},
+		jbig2HuffmanLine{1, 0, 1, false, false},
+		jbig2HuffmanLine{2, 0, 2, false, false},
+		jbig2HuffmanLine{3, 0, 3, false, false},
+		jbig2HuffmanLine{4, 3, 4, false, false},
+		jbig2HuffmanLine{5, 6, 12, false, false},
+		jbig2HuffmanLine{7, 32, -256, true, false},
+		jbig2HuffmanLine{6, 32, 76, false, false},
+	},
+	6: []jbig2HuffmanLine{
+		jbig2HuffmanLine{5, 10, -2048, false, false},
+		jbig2HuffmanLine{4, 9, -1024, false, false},
+		jbig2HuffmanLine{4, 8, -512, false, false},
+		jbig2HuffmanLine{4, 7, -256, false, false},
+		jbig2HuffmanLine{5, 6, -128, false, false},
+		jbig2HuffmanLine{5, 5, -64, false, false},
+		jbig2HuffmanLine{4, 5, -32, false, false},
+		jbig2HuffmanLine{2, 7, 0, false, false},
+		jbig2HuffmanLine{3, 7, 128, false, false},
+		jbig2HuffmanLine{3, 8, 256, false, false},
+		jbig2HuffmanLine{4, 9, 512, false, false},
+		jbig2HuffmanLine{4, 10, 1024, false, false},
+		jbig2HuffmanLine{6, 32, -2049, true, false},
+		jbig2HuffmanLine{6, 32, 2048, false, false},
+	},
+	7: []jbig2HuffmanLine{
+		jbig2HuffmanLine{4, 9, -1024, false, false},
+		jbig2HuffmanLine{3, 8, -512, false, false},
+		jbig2HuffmanLine{4, 7, -256, false, false},
+		jbig2HuffmanLine{5, 6, -128, false, false},
+		jbig2HuffmanLine{5, 5, -64, false, false},
+		jbig2HuffmanLine{4, 5, -32, false, false},
+		jbig2HuffmanLine{4, 5, 0, false, false},
+		jbig2HuffmanLine{5, 5, 32, false, false},
+		jbig2HuffmanLine{5, 6, 64, false, false},
+		jbig2HuffmanLine{4, 7, 128, false, false},
+		jbig2HuffmanLine{3, 8, 256, false, false},
+		jbig2HuffmanLine{3, 9, 512, false, false},
+		jbig2HuffmanLine{3, 10, 1024, false, false},
+		jbig2HuffmanLine{5, 32, -1025, true, false},
+		jbig2HuffmanLine{5, 32, 2048, false, false},
+	},
+	8: []jbig2HuffmanLine{
+		jbig2HuffmanLine{8, 3, -15, false, false},
+		jbig2HuffmanLine{9, 1, -7, false, false},
+		jbig2HuffmanLine{8, 1, -5, false, false},
+		jbig2HuffmanLine{9, 0, -3, false, false},
+		jbig2HuffmanLine{7, 0, -2, false, false},
+		jbig2HuffmanLine{4, 0, -1, false, false},
+		jbig2HuffmanLine{2, 1, 0, false, false},
+		jbig2HuffmanLine{5, 0, 2, false, false},
+		jbig2HuffmanLine{6, 0, 3, false, false},
+		jbig2HuffmanLine{3, 4, 4, false, false},
+		jbig2HuffmanLine{6, 1, 20, false, false},
+		jbig2HuffmanLine{4, 4, 22, false, false},
+		jbig2HuffmanLine{4, 5, 38, false, false},
+		jbig2HuffmanLine{5, 6, 70, false, false},
+		jbig2HuffmanLine{5, 7, 134, false, false},
+		jbig2HuffmanLine{6, 7, 262, false, false},
+		jbig2HuffmanLine{7, 8, 390, false, false},
+		jbig2HuffmanLine{6, 10, 646, false, false},
+		jbig2HuffmanLine{9, 32, -16, true, false},
+		jbig2HuffmanLine{9, 32, 1670, false, false},
+		jbig2HuffmanLine{2, 0, 0, false, true},
+	},
+	9: []jbig2HuffmanLine{
+		jbig2HuffmanLine{8, 4, -31, false, false},
+		jbig2HuffmanLine{9, 2, -15, false, false},
+		jbig2HuffmanLine{8, 2, -11, false, false},
+		jbig2HuffmanLine{9, 1, -7, false, false},
+		jbig2HuffmanLine{7, 1, -5, false, false},
+		jbig2HuffmanLine{4, 1, -3, false, false},
+		jbig2HuffmanLine{3, 1, -1, false, false},
+		jbig2HuffmanLine{3, 1, 1, false, false},
+		jbig2HuffmanLine{5, 1, 3, false, false},
+		jbig2HuffmanLine{6, 1, 5, false, false},
+		jbig2HuffmanLine{3, 5, 7, false, false},
+		jbig2HuffmanLine{6, 2, 39, false, false},
+		jbig2HuffmanLine{4, 5, 43, false, false},
+		jbig2HuffmanLine{4, 6, 75, false, false},
+		jbig2HuffmanLine{5, 7, 139, false, false},
+		jbig2HuffmanLine{5, 8, 267, false, false},
+		jbig2HuffmanLine{6, 8, 523, false, false},
+		jbig2HuffmanLine{7, 9, 779, false, false},
+		jbig2HuffmanLine{6, 11, 1291, false, false},
+		jbig2HuffmanLine{9, 32, -32, true, false},
+		jbig2HuffmanLine{9, 32, 3339, false, false},
+		jbig2HuffmanLine{2, 0, 0, false, true},
+	},
+	10: []jbig2HuffmanLine{
+		jbig2HuffmanLine{7, 4, -21, false, false},
+		jbig2HuffmanLine{8, 0, -5, false, false},
+		jbig2HuffmanLine{7, 0, -4, false, false},
+		jbig2HuffmanLine{5, 0, -3, false, false},
+		jbig2HuffmanLine{2, 2, -2, false, false},
+		jbig2HuffmanLine{5, 0, 2, false, false},
+		jbig2HuffmanLine{6, 0, 3, false, false},
+		jbig2HuffmanLine{7, 0, 4, false, false},
+		jbig2HuffmanLine{8, 0, 5, false, false},
+		jbig2HuffmanLine{2, 6, 6, false, false},
+		jbig2HuffmanLine{5, 5, 70, false, false},
+		jbig2HuffmanLine{6, 5, 102, false, false},
+		jbig2HuffmanLine{6, 6, 134, false, false},
+		jbig2HuffmanLine{6, 7, 198, false, false},
+		jbig2HuffmanLine{6, 8, 326, false, false},
+		jbig2HuffmanLine{6, 9, 582, false, false},
+		jbig2HuffmanLine{6, 10, 1094, false, false},
+		jbig2HuffmanLine{7, 11, 2118, false, false},
+		jbig2HuffmanLine{8, 32, -22, true, false},
+		jbig2HuffmanLine{8, 32, 4166, false, false},
+		jbig2HuffmanLine{2, 0, 0, false, true},
+	},
+	11: []jbig2HuffmanLine{
+		jbig2HuffmanLine{1, 0, 1, false, false},
+		jbig2HuffmanLine{2, 1, 2, false, false},
+		jbig2HuffmanLine{4, 0, 4, false, false},
+		jbig2HuffmanLine{4, 1, 5, false, false},
+		jbig2HuffmanLine{5, 1, 7, false, false},
+		jbig2HuffmanLine{5, 2, 9, false, false},
+		jbig2HuffmanLine{6, 2, 13, false, false},
+		jbig2HuffmanLine{7, 2, 17, false, false},
+		jbig2HuffmanLine{7, 3, 21, false, false},
+		jbig2HuffmanLine{7, 4, 29, false, false},
+		jbig2HuffmanLine{7, 5, 45, false, false},
+		jbig2HuffmanLine{7, 6, 77, false, false},
+		jbig2HuffmanLine{7, 32, 141, false, false},
+	},
+	12: []jbig2HuffmanLine{
+		jbig2HuffmanLine{1, 0, 1, false, false},
+		jbig2HuffmanLine{2, 0, 2, false, false},
+		jbig2HuffmanLine{3, 1, 3, false, false},
+		jbig2HuffmanLine{5, 0, 5, false, false},
+		jbig2HuffmanLine{5, 1, 6, false, false},
+		jbig2HuffmanLine{6, 1, 8, false, false},
+		jbig2HuffmanLine{7, 0, 10, false, false},
+		jbig2HuffmanLine{7, 1, 11, false, false},
+		jbig2HuffmanLine{7, 2, 13, false, false},
+		jbig2HuffmanLine{7, 3, 17, false, false},
+		jbig2HuffmanLine{7, 4, 25, false, false},
+		jbig2HuffmanLine{8, 5, 41, false, false},
+		jbig2HuffmanLine{8, 32, 73, false, false},
+	},
+	13: []jbig2HuffmanLine{
+		jbig2HuffmanLine{1, 0, 1, false, false},
+		jbig2HuffmanLine{3, 0, 2, false, false},
+		jbig2HuffmanLine{4, 0, 3, false, false},
+		jbig2HuffmanLine{5, 0, 4, false, false},
+		jbig2HuffmanLine{4, 1, 5, false, false},
+		jbig2HuffmanLine{3, 3, 7, false, false},
+		jbig2HuffmanLine{6, 1, 15, false, false},
+		jbig2HuffmanLine{6, 2, 17, false, false},
+		jbig2HuffmanLine{6, 3, 21, false, false},
+		jbig2HuffmanLine{6, 4, 29, false, false},
+		jbig2HuffmanLine{6, 5, 45, false, false},
+		jbig2HuffmanLine{7, 6, 77, false, false},
+		jbig2HuffmanLine{7, 32, 141, false, false},
+	},
+	14: []jbig2HuffmanLine{
+		jbig2HuffmanLine{3, 0, -2, false, false},
+		jbig2HuffmanLine{3, 0, -1, false, false},
+		jbig2HuffmanLine{1, 0, 0, false, false},
+		jbig2HuffmanLine{3, 0, 1, false, false},
+		jbig2HuffmanLine{3, 0, 2, false, false},
+	},
+	15: []jbig2HuffmanLine{
+		jbig2HuffmanLine{7, 4, -24, false, false},
+		jbig2HuffmanLine{6, 2, -8, false, false},
+		jbig2HuffmanLine{5, 1, -4, false, false},
+		jbig2HuffmanLine{4, 0, -2, false, false},
+		jbig2HuffmanLine{3, 0, -1, false, false},
+		jbig2HuffmanLine{1, 0, 0, false, false},
+		jbig2HuffmanLine{3, 0, 1, false, false},
+		jbig2HuffmanLine{4, 0, 2, false, false},
+		jbig2HuffmanLine{5, 1, 3, false, false},
+		jbig2HuffmanLine{6, 2, 5, false, false},
+		jbig2HuffmanLine{7, 4, 9, false, false},
+		jbig2HuffmanLine{7, 32, -25, true, false},
+		jbig2HuffmanLine{7, 32, 25, false, false},
+	},
+}
+
+// jbig2HuffmanCode is a prefix code and its length in bits
+type jbig2HuffmanCode struct {
+	length int
+	code uint32
+}
+
+// jbig2HuffmanTable decodes the values of huffman coded segments
+type jbig2HuffmanTable struct {
+	codes map[jbig2HuffmanCode]jbig2HuffmanLine
+	max_length int
+}
+
+// newJBIG2HuffmanTable assigns the canonical prefix codes of T.88 B.3 to the lines, false if they do not fit their lengths
+func newJBIG2HuffmanTable(lines []jbig2HuffmanLine) (*jbig2HuffmanTable, bool) {
+	table := &jbig2HuffmanTable{map[jbig2HuffmanCode]jbig2HuffmanLine{}, 0}
+	for _, line := range lines {
+		if line.prefix_length < 0 || line.prefix_length > 32 {
+			return nil, false
+		}
+		if line.prefix_length > table.max_length {
+			table.max_length = line.prefix_length
+		}
+	}
+
+	// the codes of each length follow the codes of the length before, lines without a prefix have no code
+	counts := make([]int, table.max_length + 1)
+	for _, line := range lines {
+		counts[line.prefix_length]++
+	}
+	counts[0] = 0
+	first_code := uint64(0)
+	for length := 1; length <= table.max_length; length++ {
+		first_code = (first_code + uint64(counts[length - 1])) << 1
+		code := first_code
+		for _, line := range lines {
+			if line.prefix_length == length {
+				if code >= 1 << uint(length) {
+					return nil, false
+				}
+				table.codes[jbig2HuffmanCode{length, uint32(code)}] = line
+				code++
+			}
+		}
+	}
+	return table, true
+}
+
+// jbig2StandardTable returns the standard table B.n
+func jbig2StandardTable(n int) *jbig2HuffmanTable {
+	table, _ := newJBIG2HuffmanTable(jbig2_standard_tables[n])
+	return table
+}
+
+// decode decodes a value, false if it is the out of band value or the code is not in the table
+func (table *jbig2HuffmanTable) decode(reader *jbig2BitReader) (int, bool) {
+	code := uint32(0)
+	for length := 1; length <= table.max_length; length++ {
+		code = code << 1 | uint32(reader.readBit())
+		if line, ok := table.codes[jbig2HuffmanCode{length, code}]; ok {
+			if line.oob {
+				return 0, false
+			}
+			value := int(reader.readBits(line.range_length))
+			if line.lower {
+				return line.range_low - value, true
+			}
+			return line.range_low + value, true
+		}
+	}
+	return 0, false
+}
+
+// jbig2BitReader reads the bits of huffman coded data from the most significant bit of each byte
+type jbig2BitReader struct {
+	data []byte
+	position int
+}
+
+func newJBIG2BitReader(data []byte) *jbig2BitReader {
+	return &jbig2BitReader{data, 0}
+}
+
+// readBit reads a bit, the bits past the end of the data are 0
+func (reader *jbig2BitReader) readBit() int {
+	bit := 0
+	if reader.position / 8 < len(reader.data) {
+		bit = int(reader.data[reader.position / 8] >> uint(7 - reader.position % 8)) & 1
+	}
+	reader.position++
+	return bit
+}
+
+// readBits reads a number of up to 32 bits
+func (reader *jbig2BitReader) readBits(count int) uint32 {
+	value := uint32(0)
+	for i := 0; i < count; i++ {
+		value = value << 1 | uint32(reader.readBit())
+	}
+	return value
+}
+
+// align skips the rest of the current byte
+func (reader *jbig2BitReader) align() {
+	reader.position = (reader.position + 7) / 8 * 8
+}
+
+// readBytes reads count bytes from the next byte boundary, false if the data ends first
+func (reader *jbig2BitReader) readBytes(count int) ([]byte, bool) {
+	reader.align()
+	start := reader.position / 8
+	if count < 0 || start > len(reader.data) || count > len(reader.data) - start {
+		return nil, false
+	}
+	reader.position += count * 8
+	return reader.data[start:start + count], true
+}
+
+// exhausted returns true if the reader has read past the end of the data
+func (reader *jbig2BitReader) exhausted() bool {
+	return reader.position > len(reader.data) * 8
+}
+
+// decodeTables decodes a tables segment, a custom huffman table used by the segments that refer to it
+func (decoder *jbig2Decoder) decodeTables(segment *jbig2Segment) bool {
+	data := segment.data
+	if len(data) < 9 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return false
+	}
+	oob := data[0] & 1 != 0
+	prefix_size := int(data[0] >> 1 & 7) + 1
+	range_size := int(data[0] >> 4 & 7) + 1
+	low := int64(int32(binary.BigEndian.Uint32(data[1:])))
+	high := int64(int32(binary.BigEndian.Uint32(data[5:])))
+
+	// the lines cover the values from low to high, then come the lower and upper range lines and the out of band line
+	reader := newJBIG2BitReader(data[9:])
+	lines := []jbig2HuffmanLine{}
+	for current := low; current < high; {
+		prefix_length := int(reader.readBits(prefix_size))
+		range_length := int(reader.readBits(range_size))
+		if range_length > 32 || reader.exhausted() {
+			decoder.anomaly(JBIG2InvalidSegment, "invalid %s", segment.name())
+			return false
+		}
+		lines = append(lines, jbig2HuffmanLine{prefix_length, range_length, int(current), false, false})
+		current += 1 << uint(range_length)
+	}
+	lines = append(lines, jbig2HuffmanLine{int(reader.readBits(prefix_size)), 32, int(low - 1), true, false})
+	lines = append(lines, jbig2HuffmanLine{int(reader.readBits(prefix_size)), 32, int(high), false, false})
+	if oob {
+		lines = append(lines, jbig2HuffmanLine{int(reader.readBits(prefix_size)), 0, 0, false, true})
+	}
+	table, ok := newJBIG2HuffmanTable(lines)
+	if !ok || reader.exhausted() {
+		decoder.anomaly(JBIG2InvalidSegment, "invalid %s", segment.name())
+		return false
+	}
+	segment.table = table
+	return true
+}
+
+// selectTables returns a huffman table for each selection of a segment, the standard table numbered by the selection or the next custom table it refers to for 0
+// a selection of -1 is not valid
+func (decoder *jbig2Decoder) selectTables(segment *jbig2Segment, selections ...int) ([]*jbig2HuffmanTable, bool) {
+	referred, ok := decoder.referredSegments(segment)
+	if !ok {
+		return nil, false
+	}
+	custom := []*jbig2HuffmanTable{}
+	for _, referred_segment := range referred {
+		if referred_segment.segment_type == jbig2Tables {
+			custom = append(custom, referred_segment.table)
+		}
+	}
+	tables := []*jbig2HuffmanTable{}
+	for _, selection := range selections {
+		if selection < 0 {
+			decoder.anomaly(JBIG2InvalidSegment, "invalid table selection")
+			return nil, false
+		}
+		if selection > 0 {
+			tables = append(tables, jbig2StandardTable(selection))
+		} else if len(custom) > 0 {
+			tables = append(tables, custom[0])
+			custom = custom[1:]
+		} else {
+			decoder.anomaly(JBIG2InvalidSegment, "missing custom table")
+			return nil, false
+		}
+	}
+	return tables, true
+}
+
+// readJBIG2SymbolIDTable reads the huffman table of the symbol ids of a text region, the code lengths are themselves coded by run codes
+func readJBIG2SymbolIDTable(reader *jbig2BitReader, symbol_count int) (*jbig2HuffmanTable, bool) {
+	run_lines := make([]jbig2HuffmanLine, 35)
+	for i := range run_lines {
+		run_lines[i] = jbig2HuffmanLine{int(reader.readBits(4)), 0, i, false, false}
+	}
+	run_table, ok := newJBIG2HuffmanTable(run_lines)
+	if !ok {
+		return nil, false
+	}
+
+	// run codes below 32 are lengths, the others repeat the previous length or zero lengths
+	lengths := []int{}
+	for len(lengths) < symbol_count {
+		run_code, ok := run_table.decode(reader)
+		if !ok || reader.exhausted() {
+			return nil, false
+		}
+		if run_code < 32 {
+			lengths = append(lengths, run_code)
+			continue
+		}
+		length, repeat := 0, 0
+		if run_code == 32 {
+			if len(lengths) == 0 {
+				return nil, false
+			}
+			length = lengths[len(lengths) - 1]
+			repeat = 3 + int(reader.readBits(2))
+		} else if run_code == 33 {
+			repeat = 3 + int(reader.readBits(3))
+		} else {
+			repeat = 11 + int(reader.readBits(7))
+		}
+		if repeat > symbol_count - len(lengths) {
+			return nil, false
+		}
+		for i := 0; i < repeat; i++ {
+			lengths = append(lengths, length)
+		}
+	}
+	reader.align()
+
+	lines := make([]jbig2HuffmanLine, symbol_count)
+	for i, length := range lengths {
+		lines[i] = jbig2HuffmanLine{length, 0, i, false, false}
+	}
+	return newJBIG2HuffmanTable(lines)
+}
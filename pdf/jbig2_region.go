@@ -0,0 +1,938 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// combination operators of regions and text region symbols
+const (
+	jbig2CombineOr = 0
+	jbig2CombineAnd = 1
+	jbig2CombineXor = 2
+	jbig2CombineXnor = 3
+	jbig2CombineReplace = 4
+)
+
+// reference corners of text region symbols
+const (
+	jbig2CornerBottomLeft = 0
+	jbig2CornerTopLeft = 1
+	jbig2CornerBottomRight = 2
+	jbig2CornerTopRight = 3
+)
+
+// contexts of the typical prediction bit of each generic template and each refinement template
+var jbig2_generic_tpgdon_contexts = []int{0x9b25, 0x0795, 0x00e5, 0x0195}
+var jbig2_refinement_tpgron_contexts = []int{0x0100, 0x0080}
+
+// jbig2Bitmap is a bitmap of 1 bit per pixel with black pixels 1
+type jbig2Bitmap struct {
+	width int
+	height int
+	stride int
+	data []byte
+}
+
+func newJBIG2Bitmap(width int, height int) *jbig2Bitmap {
+	stride := (width + 7) / 8
+	return &jbig2Bitmap{width, height, stride, make([]byte, stride * height)}
+}
+
+// get returns the pixel at x, y, pixels outside the bitmap are 0
+func (bitmap *jbig2Bitmap) get(x int, y int) int {
+	if x < 0 || y < 0 || x >= bitmap.width || y >= bitmap.height {
+		return 0
+	}
+	return int(bitmap.data[y * bitmap.stride + x / 8] >> uint(7 - x % 8)) & 1
+}
+
+func (bitmap *jbig2Bitmap) set(x int, y int, value int) {
+	if x < 0 || y < 0 || x >= bitmap.width || y >= bitmap.height {
+		return
+	}
+	if value != 0 {
+		bitmap.data[y * bitmap.stride + x / 8] |= 0x80 >> uint(x % 8)
+	} else {
+		bitmap.data[y * bitmap.stride + x / 8] &^= 0x80 >> uint(x % 8)
+	}
+}
+
+func (bitmap *jbig2Bitmap) fill(value int) {
+	b := byte(0)
+	if value != 0 {
+		b = 0xff
+	}
+	for i := range bitmap.data {
+		bitmap.data[i] = b
+	}
+}
+
+// copyRow copies the row above y to y
+func (bitmap *jbig2Bitmap) copyRow(y int) {
+	if y > 0 {
+		copy(bitmap.data[y * bitmap.stride:(y + 1) * bitmap.stride], bitmap.data[(y - 1) * bitmap.stride:y * bitmap.stride])
+	}
+}
+
+// crop returns a copy of the part of the bitmap at x, y
+func (bitmap *jbig2Bitmap) crop(x int64, y int64, width int, height int) *jbig2Bitmap {
+	cropped := newJBIG2Bitmap(width, height)
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			cropped.set(i, j, bitmap.get(int(x) + i, int(y) + j))
+		}
+	}
+	return cropped
+}
+
+// compose combines a bitmap with this one at x, y, the parts outside this bitmap are clipped
+func (bitmap *jbig2Bitmap) compose(source *jbig2Bitmap, x int64, y int64, combination_operator int) {
+	for j := 0; j < source.height; j++ {
+		if y + int64(j) < 0 || y + int64(j) >= int64(bitmap.height) {
+			continue
+		}
+		for i := 0; i < source.width; i++ {
+			if x + int64(i) < 0 || x + int64(i) >= int64(bitmap.width) {
+				continue
+			}
+			dx, dy := int(x) + i, int(y) + j
+			s, d := source.get(i, j), bitmap.get(dx, dy)
+			if combination_operator == jbig2CombineAnd {
+				d &= s
+			} else if combination_operator == jbig2CombineXor {
+				d ^= s
+			} else if combination_operator == jbig2CombineXnor {
+				d = 1 - (d ^ s)
+			} else if combination_operator == jbig2CombineReplace {
+				d = s
+			} else {
+				d |= s
+			}
+			bitmap.set(dx, dy, d)
+		}
+	}
+}
+
+// pack returns the rows of the bitmap with black pixels 0 and the padding at the end of each row 0
+func (bitmap *jbig2Bitmap) pack() []byte {
+	packed := make([]byte, len(bitmap.data))
+	for i, b := range bitmap.data {
+		packed[i] = ^b
+	}
+	if bitmap.width % 8 > 0 {
+		for y := 0; y < bitmap.height; y++ {
+			packed[(y + 1) * bitmap.stride - 1] &= 0xff << uint(8 - bitmap.width % 8)
+		}
+	}
+	return packed
+}
+
+// decodeGenericRegion decodes a generic region segment
+func (decoder *jbig2Decoder) decodeGenericRegion(segment *jbig2Segment, info jbig2RegionInfo) (*jbig2Bitmap, bool) {
+	data := segment.data[17:]
+	if len(data) < 1 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return nil, false
+	}
+	flags := data[0]
+	mmr := flags & 1 != 0
+	template := int(flags >> 1 & 3)
+	tpgdon := flags & 8 != 0
+	data = data[1:]
+	if flags & 0x10 != 0 {
+		decoder.anomaly(JBIG2UnsupportedSegment, "extended template")
+		return nil, false
+	}
+
+	if segment.unknown_length {
+		data = data[:len(data) - 4]
+	}
+	bitmap, ok := decoder.newBitmap(info.width, info.height)
+	if !ok {
+		return nil, false
+	}
+
+	if mmr {
+		return bitmap, decoder.decodeMMR(bitmap, data)
+	}
+
+	// read the adaptive template pixels
+	at_size := 2
+	if template == 0 {
+		at_size = 8
+	}
+	if len(data) < at_size {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return nil, false
+	}
+	at := make([]int, at_size)
+	for i := range at {
+		at[i] = int(int8(data[i]))
+	}
+
+	arith := newJBIG2ArithDecoder(data[at_size:])
+	contexts := make([]jbig2Context, 1 << 16)
+	return bitmap, decoder.decodeGeneric(arith, contexts, bitmap, template, tpgdon, at)
+}
+
+// decodeGeneric decodes the pixels of a bitmap with a generic template, false if the data ends first
+func (decoder *jbig2Decoder) decodeGeneric(arith *jbig2ArithDecoder, contexts []jbig2Context, bitmap *jbig2Bitmap, template int, tpgdon bool, at []int) bool {
+	ltp := 0
+	for y := 0; y < bitmap.height; y++ {
+		// typically predicted rows are the same as the row above
+		if tpgdon {
+			if arith.exhausted() {
+				decoder.anomaly(JBIG2InvalidSegment, "truncated data at row %d", y)
+				return false
+			}
+			ltp ^= arith.decode(&contexts[jbig2_generic_tpgdon_contexts[template]])
+			if ltp == 1 {
+				bitmap.copyRow(y)
+				continue
+			}
+		}
+
+		for x := 0; x < bitmap.width; x++ {
+			if arith.exhausted() {
+				decoder.anomaly(JBIG2InvalidSegment, "truncated data at row %d", y)
+				return false
+			}
+			context := jbig2GenericContext(bitmap, x, y, template, at)
+			if arith.decode(&contexts[context]) == 1 {
+				bitmap.set(x, y, 1)
+			}
+		}
+	}
+	return true
+}
+
+// jbig2GenericContext returns the context of the pixel at x, y from the pixels before it in the template
+func jbig2GenericContext(bitmap *jbig2Bitmap, x int, y int, template int, at []int) int {
+	get := bitmap.get
+	if template == 0 {
+		return get(x - 1, y) | get(x - 2, y) << 1 | get(x - 3, y) << 2 | get(x - 4, y) << 3 |
+			get(x + at[0], y + at[1]) << 4 |
+			get(x + 2, y - 1) << 5 | get(x + 1, y - 1) << 6 | get(x, y - 1) << 7 | get(x - 1, y - 1) << 8 | get(x - 2, y - 1) << 9 |
+			get(x + at[2], y + at[3]) << 10 | get(x + at[4], y + at[5]) << 11 |
+			get(x + 1, y - 2) << 12 | get(x, y - 2) << 13 | get(x - 1, y - 2) << 14 |
+			get(x + at[6], y + at[7]) << 15
+	} else if template == 1 {
+		return get(x - 1, y) | get(x - 2, y) << 1 | get(x - 3, y) << 2 |
+			get(x + at[0], y + at[1]) << 3 |
+			get(x + 2, y - 1) << 4 | get(x + 1, y - 1) << 5 | get(x, y - 1) << 6 | get(x - 1, y - 1) << 7 | get(x - 2, y - 1) << 8 |
+			get(x + 2, y - 2) << 9 | get(x + 1, y - 2) << 10 | get(x, y - 2) << 11 | get(x - 1, y - 2) << 12
+	} else if template == 2 {
+		return get(x - 1, y) | get(x - 2, y) << 1 |
+			get(x + at[0], y + at[1]) << 2 |
+			get(x + 1, y - 1) << 3 | get(x, y - 1) << 4 | get(x - 1, y - 1) << 5 | get(x - 2, y - 1) << 6 |
+			get(x + 1, y - 2) << 7 | get(x, y - 2) << 8 | get(x - 1, y - 2) << 9
+	}
+	return get(x - 1, y) | get(x - 2, y) << 1 | get(x - 3, y) << 2 | get(x - 4, y) << 3 |
+		get(x + at[0], y + at[1]) << 4 |
+		get(x + 1, y - 1) << 5 | get(x, y - 1) << 6 | get(x - 1, y - 1) << 7 | get(x - 2, y - 1) << 8 | get(x - 3, y - 1) << 9
+}
+
+// decodeMMR decodes the rows of a bitmap coded like group 4 fax with black pixels 1, false if the data ends first
+func (decoder *jbig2Decoder) decodeMMR(bitmap *jbig2Bitmap, data []byte) bool {
+	ccitt_decoder := &ccittDecoder{data, 0}
+	reference := []int{}
+	for y := 0; y < bitmap.height; y++ {
+		// an end of facsimile block ends the data early
+		if ccitt_decoder.isEOL() {
+			return true
+		}
+		changes, ok := ccitt_decoder.decode2D(reference, bitmap.width)
+		if !ok {
+			decoder.anomaly(JBIG2InvalidSegment, "invalid mmr data at row %d", y)
+			return false
+		}
+		for i := 0; i < len(changes); i += 2 {
+			end := bitmap.width
+			if i + 1 < len(changes) {
+				end = changes[i + 1]
+			}
+			for x := changes[i]; x < end; x++ {
+				bitmap.set(x, y, 1)
+			}
+		}
+		reference = changes
+	}
+	return true
+}
+
+// decodeRefinementRegion decodes a refinement region segment that refines an intermediate region or the page
+func (decoder *jbig2Decoder) decodeRefinementRegion(segment *jbig2Segment, info jbig2RegionInfo) (*jbig2Bitmap, bool) {
+	data := segment.data[17:]
+	if len(data) < 1 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return nil, false
+	}
+	template := int(data[0] & 1)
+	tpgron := data[0] & 2 != 0
+	data = data[1:]
+	at := []int{}
+	if template == 0 {
+		if len(data) < 4 {
+			decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+			return nil, false
+		}
+		at = []int{int(int8(data[0])), int(int8(data[1])), int(int8(data[2])), int(int8(data[3]))}
+		data = data[4:]
+	}
+
+	// the reference is the intermediate region referred to or the part of the page under the region
+	referred, ok := decoder.referredSegments(segment)
+	if !ok {
+		return nil, false
+	}
+	bitmap, ok := decoder.newBitmap(info.width, info.height)
+	if !ok {
+		return nil, false
+	}
+	var reference *jbig2Bitmap
+	for _, referred_segment := range referred {
+		if referred_segment.bitmap != nil {
+			reference = referred_segment.bitmap
+		}
+	}
+	if reference == nil {
+		if decoder.page == nil {
+			decoder.anomaly(JBIG2InvalidSegment, "%s without a page", segment.name())
+			return nil, false
+		}
+		reference = decoder.page.crop(info.x, info.y, bitmap.width, bitmap.height)
+	}
+
+	arith := newJBIG2ArithDecoder(data)
+	contexts := make([]jbig2Context, 1 << 13)
+	return bitmap, decoder.decodeRefinement(arith, contexts, bitmap, template, reference, 0, 0, tpgron, at)
+}
+
+// decodeRefinement decodes the pixels of a bitmap relative to a reference bitmap offset by dx, dy, false if the data ends first
+func (decoder *jbig2Decoder) decodeRefinement(arith *jbig2ArithDecoder, contexts []jbig2Context, bitmap *jbig2Bitmap, template int, reference *jbig2Bitmap, dx int, dy int, tpgron bool, at []int) bool {
+	ltp := 0
+	for y := 0; y < bitmap.height; y++ {
+		if tpgron {
+			ltp ^= arith.decode(&contexts[jbig2_refinement_tpgron_contexts[template]])
+		}
+		for x := 0; x < bitmap.width; x++ {
+			if arith.exhausted() {
+				decoder.anomaly(JBIG2InvalidSegment, "truncated data at row %d", y)
+				return false
+			}
+			// typically predicted pixels match the reference pixels around them when they are all the same
+			if ltp == 1 {
+				if value, ok := jbig2TypicalPixel(reference, x - dx, y - dy); ok {
+					bitmap.set(x, y, value)
+					continue
+				}
+			}
+			context := jbig2RefinementContext(bitmap, reference, x, y, template, dx, dy, at)
+			if arith.decode(&contexts[context]) == 1 {
+				bitmap.set(x, y, 1)
+			}
+		}
+	}
+	return true
+}
+
+// jbig2TypicalPixel returns the value of the 3x3 reference pixels around x, y if they are all the same
+func jbig2TypicalPixel(reference *jbig2Bitmap, x int, y int) (int, bool) {
+	value := reference.get(x, y)
+	for j := -1; j <= 1; j++ {
+		for i := -1; i <= 1; i++ {
+			if reference.get(x + i, y + j) != value {
+				return 0, false
+			}
+		}
+	}
+	return value, true
+}
+
+// jbig2RefinementContext returns the context of the pixel at x, y from the pixels before it and the reference pixels around it
+func jbig2RefinementContext(bitmap *jbig2Bitmap, reference *jbig2Bitmap, x int, y int, template int, dx int, dy int, at []int) int {
+	get := bitmap.get
+	ref := func(i int, j int) int {
+		return reference.get(x - dx + i, y - dy + j)
+	}
+	if template == 0 {
+		return get(x - 1, y) | get(x + 1, y - 1) << 1 | get(x, y - 1) << 2 | get(x + at[0], y + at[1]) << 3 |
+			ref(1, 1) << 4 | ref(0, 1) << 5 | ref(-1, 1) << 6 | ref(1, 0) << 7 | ref(0, 0) << 8 | ref(-1, 0) << 9 |
+			ref(1, -1) << 10 | ref(0, -1) << 11 | ref(at[2], at[3]) << 12
+	}
+	return get(x - 1, y) | get(x + 1, y - 1) << 1 | get(x, y - 1) << 2 | get(x - 1, y - 1) << 3 |
+		ref(1, 1) << 4 | ref(0, 1) << 5 | ref(1, 0) << 6 | ref(0, 0) << 7 | ref(-1, 0) << 8 | ref(0, -1) << 9
+}
+
+// jbig2TextDecoders are the integer decoders of text regions, symbol dictionaries share them with the text regions of aggregated symbols
+type jbig2TextDecoders struct {
+	dt *jbig2IntDecoder
+	fs *jbig2IntDecoder
+	ds *jbig2IntDecoder
+	it *jbig2IntDecoder
+	ri *jbig2IntDecoder
+	rdw *jbig2IntDecoder
+	rdh *jbig2IntDecoder
+	rdx *jbig2IntDecoder
+	rdy *jbig2IntDecoder
+	id *jbig2IDDecoder
+	refinement_contexts []jbig2Context
+}
+
+func newJBIG2TextDecoders(symbol_count int) *jbig2TextDecoders {
+	return &jbig2TextDecoders{
+		newJBIG2IntDecoder(), newJBIG2IntDecoder(), newJBIG2IntDecoder(), newJBIG2IntDecoder(), newJBIG2IntDecoder(),
+		newJBIG2IntDecoder(), newJBIG2IntDecoder(), newJBIG2IntDecoder(), newJBIG2IntDecoder(),
+		newJBIG2IDDecoder(jbig2SymbolCodeLength(symbol_count)),
+		make([]jbig2Context, 1 << 13),
+	}
+}
+
+// jbig2TextTables are the huffman tables of text regions, symbol ids without a table are a fixed number of bits
+type jbig2TextTables struct {
+	fs *jbig2HuffmanTable
+	ds *jbig2HuffmanTable
+	dt *jbig2HuffmanTable
+	rdw *jbig2HuffmanTable
+	rdh *jbig2HuffmanTable
+	rdx *jbig2HuffmanTable
+	rdy *jbig2HuffmanTable
+	rsize *jbig2HuffmanTable
+	id *jbig2HuffmanTable
+	id_length uint
+}
+
+// jbig2SymbolCodeLength returns the number of bits of the ids of symbol_count symbols
+func jbig2SymbolCodeLength(symbol_count int) uint {
+	if symbol_count <= 1 {
+		return 0
+	}
+	return uint(bits.Len(uint(symbol_count - 1)))
+}
+
+// jbig2TextRegion is the parameters of a text region
+type jbig2TextRegion struct {
+	instances int64
+	strips int
+	refine bool
+	reference_corner int
+	transposed bool
+	combination_operator int
+	default_pixel int
+	ds_offset int
+	refinement_template int
+	refinement_at []int
+	symbols []*jbig2Bitmap
+}
+
+// jbig2TextCoder reads the values of a text region and refines its symbols, the values are arithmetic or huffman coded
+type jbig2TextCoder struct {
+	dt func() (int, bool)
+	fs func() (int, bool)
+	ds func() (int, bool)
+	it func() (int, bool)
+	id func() (int, bool)
+	ri func() (int, bool)
+	rdw func() (int, bool)
+	rdh func() (int, bool)
+	rdx func() (int, bool)
+	rdy func() (int, bool)
+	refine func(*jbig2Bitmap, *jbig2Bitmap, int, int) bool
+	exhausted func() bool
+}
+
+// arithTextCoder returns a coder of the arithmetic coded values of a text region
+func (decoder *jbig2Decoder) arithTextCoder(arith *jbig2ArithDecoder, ints *jbig2TextDecoders, region *jbig2TextRegion) *jbig2TextCoder {
+	decode := func(int_decoder *jbig2IntDecoder) func() (int, bool) {
+		return func() (int, bool) {
+			return int_decoder.decode(arith)
+		}
+	}
+	return &jbig2TextCoder{
+		decode(ints.dt), decode(ints.fs), decode(ints.ds), decode(ints.it),
+		func() (int, bool) {
+			return ints.id.decode(arith), true
+		},
+		decode(ints.ri), decode(ints.rdw), decode(ints.rdh), decode(ints.rdx), decode(ints.rdy),
+		func(refined *jbig2Bitmap, reference *jbig2Bitmap, dx int, dy int) bool {
+			return decoder.decodeRefinement(arith, ints.refinement_contexts, refined, region.refinement_template, reference, dx, dy, false, region.refinement_at)
+		},
+		arith.exhausted,
+	}
+}
+
+// huffmanTextCoder returns a coder of the huffman coded values of a text region
+// the bitmaps of refined symbols are arithmetic coded in the number of bytes before them
+func (decoder *jbig2Decoder) huffmanTextCoder(reader *jbig2BitReader, tables *jbig2TextTables, refinement_contexts []jbig2Context, region *jbig2TextRegion) *jbig2TextCoder {
+	decode := func(table *jbig2HuffmanTable) func() (int, bool) {
+		return func() (int, bool) {
+			return table.decode(reader)
+		}
+	}
+	read := func(count int) func() (int, bool) {
+		return func() (int, bool) {
+			return int(reader.readBits(count)), true
+		}
+	}
+	id := read(int(tables.id_length))
+	if tables.id != nil {
+		id = decode(tables.id)
+	}
+	return &jbig2TextCoder{
+		decode(tables.dt), decode(tables.fs), decode(tables.ds), read(bits.Len(uint(region.strips)) - 1), id, read(1),
+		decode(tables.rdw), decode(tables.rdh), decode(tables.rdx), decode(tables.rdy),
+		func(refined *jbig2Bitmap, reference *jbig2Bitmap, dx int, dy int) bool {
+			size, ok := tables.rsize.decode(reader)
+			if !ok {
+				decoder.anomaly(JBIG2InvalidSegment, "invalid refinement size")
+				return false
+			}
+			data, ok := reader.readBytes(size)
+			if !ok {
+				decoder.anomaly(JBIG2InvalidSegment, "truncated refinement data")
+				return false
+			}
+			arith := newJBIG2ArithDecoder(data)
+			return decoder.decodeRefinement(arith, refinement_contexts, refined, region.refinement_template, reference, dx, dy, false, region.refinement_at)
+		},
+		reader.exhausted,
+	}
+}
+
+// decodeTextRegion decodes a text region segment that places the symbols of the symbol dictionaries it refers to
+func (decoder *jbig2Decoder) decodeTextRegion(segment *jbig2Segment, info jbig2RegionInfo) (*jbig2Bitmap, bool) {
+	data := segment.data[17:]
+	if len(data) < 2 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return nil, false
+	}
+	flags := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	huffman := flags & 1 != 0
+	region := &jbig2TextRegion{}
+	region.refine = flags & 2 != 0
+	region.strips = 1 << uint(flags >> 2 & 3)
+	region.reference_corner = flags >> 4 & 3
+	region.transposed = flags & 0x40 != 0
+	region.combination_operator = flags >> 7 & 3
+	region.default_pixel = flags >> 9 & 1
+	region.ds_offset = flags >> 10 & 0x1f
+	if region.ds_offset > 15 {
+		region.ds_offset -= 32
+	}
+	region.refinement_template = flags >> 15 & 1
+
+	// huffman coded regions select their tables
+	huffman_flags := 0
+	if huffman {
+		if len(data) < 2 {
+			decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+			return nil, false
+		}
+		huffman_flags = int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+	}
+
+	// refinement adaptive template pixels and the number of symbol instances
+	if region.refine && region.refinement_template == 0 {
+		if len(data) < 4 {
+			decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+			return nil, false
+		}
+		region.refinement_at = []int{int(int8(data[0])), int(int8(data[1])), int(int8(data[2])), int(int8(data[3]))}
+		data = data[4:]
+	}
+	if len(data) < 4 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return nil, false
+	}
+	region.instances = int64(binary.BigEndian.Uint32(data))
+	data = data[4:]
+
+	// the symbols are those exported by the referred symbol dictionaries
+	symbols, _, ok := decoder.referredSymbols(segment)
+	if !ok {
+		return nil, false
+	}
+	region.symbols = symbols
+
+	bitmap, ok := decoder.newBitmap(info.width, info.height)
+	if !ok {
+		return nil, false
+	}
+	if !huffman {
+		arith := newJBIG2ArithDecoder(data)
+		return bitmap, decoder.decodeText(decoder.arithTextCoder(arith, newJBIG2TextDecoders(len(symbols)), region), bitmap, region)
+	}
+
+	// the custom tables are used in the order of the values, the huffman table of the symbol ids comes before the instances
+	rd := []int{14, 15, -1, 0}
+	tables, ok := decoder.selectTables(segment, []int{6, 7, -1, 0}[huffman_flags & 3], []int{8, 9, 10, 0}[huffman_flags >> 2 & 3], []int{11, 12, 13, 0}[huffman_flags >> 4 & 3],
+		rd[huffman_flags >> 6 & 3], rd[huffman_flags >> 8 & 3], rd[huffman_flags >> 10 & 3], rd[huffman_flags >> 12 & 3], []int{1, 0}[huffman_flags >> 14 & 1])
+	if !ok {
+		return nil, false
+	}
+	reader := newJBIG2BitReader(data)
+	id_table, ok := readJBIG2SymbolIDTable(reader, len(symbols))
+	if !ok {
+		decoder.anomaly(JBIG2InvalidSegment, "invalid symbol id table")
+		return nil, false
+	}
+	text_tables := &jbig2TextTables{tables[0], tables[1], tables[2], tables[3], tables[4], tables[5], tables[6], tables[7], id_table, 0}
+	return bitmap, decoder.decodeText(decoder.huffmanTextCoder(reader, text_tables, make([]jbig2Context, 1 << 13), region), bitmap, region)
+}
+
+// decodeText places the symbol instances of a text region in a bitmap, false if the data ends first or a symbol is out of range
+func (decoder *jbig2Decoder) decodeText(coder *jbig2TextCoder, bitmap *jbig2Bitmap, region *jbig2TextRegion) bool {
+	bitmap.fill(region.default_pixel)
+
+	strip_t, ok := coder.dt()
+	if !ok {
+		decoder.anomaly(JBIG2InvalidSegment, "invalid strip")
+		return false
+	}
+	strip_t *= -region.strips
+	first_s := 0
+	for instance := int64(0); instance < region.instances; {
+		// each strip starts with the difference of its t from the previous strip
+		dt, ok := coder.dt()
+		if !ok {
+			decoder.anomaly(JBIG2InvalidSegment, "invalid strip")
+			return false
+		}
+		strip_t += dt * region.strips
+
+		// the instances of a strip are ordered by s, the strip ends with an out of band s
+		first := true
+		current_s := 0
+		for {
+			if coder.exhausted() {
+				decoder.anomaly(JBIG2InvalidSegment, "truncated data at instance %d", instance)
+				return false
+			}
+			if first {
+				dfs, ok := coder.fs()
+				if !ok {
+					decoder.anomaly(JBIG2InvalidSegment, "invalid first s")
+					return false
+				}
+				first_s += dfs
+				current_s = first_s
+				first = false
+			} else {
+				ids, ok := coder.ds()
+				if !ok {
+					break
+				}
+				if instance >= region.instances {
+					decoder.anomaly(JBIG2InvalidSegment, "more than %d instances", region.instances)
+					return false
+				}
+				current_s += ids + region.ds_offset
+			}
+			current_t := 0
+			if region.strips != 1 {
+				current_t, _ = coder.it()
+			}
+			t := strip_t + current_t
+
+			// get the symbol, refining it if needed
+			id, ok := coder.id()
+			if !ok {
+				decoder.anomaly(JBIG2InvalidSegment, "invalid symbol code at instance %d", instance)
+				return false
+			}
+			if id >= len(region.symbols) {
+				decoder.anomaly(JBIG2SymbolOutOfRange, "symbol %d of %d", id, len(region.symbols))
+				return false
+			}
+			symbol := region.symbols[id]
+			ri := 0
+			if region.refine {
+				ri, _ = coder.ri()
+			}
+			if ri != 0 {
+				rdw, _ := coder.rdw()
+				rdh, _ := coder.rdh()
+				rdx, _ := coder.rdx()
+				rdy, _ := coder.rdy()
+				refined, ok := decoder.newBitmap(int64(symbol.width + rdw), int64(symbol.height + rdh))
+				if !ok {
+					return false
+				}
+				if !coder.refine(refined, symbol, rdw >> 1 + rdx, rdh >> 1 + rdy) {
+					return false
+				}
+				symbol = refined
+			}
+
+			// place the symbol by its reference corner, s runs down the columns of transposed regions
+			width, height := symbol.width, symbol.height
+			if !region.transposed && (region.reference_corner == jbig2CornerTopRight || region.reference_corner == jbig2CornerBottomRight) {
+				current_s += width - 1
+			} else if region.transposed && (region.reference_corner == jbig2CornerBottomLeft || region.reference_corner == jbig2CornerBottomRight) {
+				current_s += height - 1
+			}
+			x, y := current_s, t
+			if region.transposed {
+				x, y = t, current_s
+			}
+			if region.reference_corner == jbig2CornerTopRight || region.reference_corner == jbig2CornerBottomRight {
+				x -= width - 1
+			}
+			if region.reference_corner == jbig2CornerBottomLeft || region.reference_corner == jbig2CornerBottomRight {
+				y -= height - 1
+			}
+			bitmap.compose(symbol, int64(x), int64(y), region.combination_operator)
+			if !region.transposed && (region.reference_corner == jbig2CornerTopLeft || region.reference_corner == jbig2CornerBottomLeft) {
+				current_s += width - 1
+			} else if region.transposed && (region.reference_corner == jbig2CornerTopLeft || region.reference_corner == jbig2CornerTopRight) {
+				current_s += height - 1
+			}
+			instance++
+		}
+	}
+	return true
+}
+
+// decodeSymbolDictionary decodes the symbols of a symbol dictionary segment and keeps the ones it exports
+func (decoder *jbig2Decoder) decodeSymbolDictionary(segment *jbig2Segment) bool {
+	data := segment.data
+	if len(data) < 2 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return false
+	}
+	flags := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	huffman := flags & 1 != 0
+	refine_aggregate := flags & 2 != 0
+	context_used := flags & 0x100 != 0
+	context_retained := flags & 0x200 != 0
+	template := flags >> 10 & 3
+	refinement_template := flags >> 12 & 1
+
+	// read the adaptive template pixels and the symbol counts, huffman coded dictionaries have no generic template
+	at_size := 2
+	if template == 0 {
+		at_size = 8
+	}
+	if huffman {
+		at_size = 0
+	}
+	refinement_at_size := 0
+	if refine_aggregate && refinement_template == 0 {
+		refinement_at_size = 4
+	}
+	if len(data) < at_size + refinement_at_size + 8 {
+		decoder.anomaly(JBIG2InvalidSegment, "truncated %s", segment.name())
+		return false
+	}
+	at := make([]int, at_size)
+	for i := range at {
+		at[i] = int(int8(data[i]))
+	}
+	refinement_at := make([]int, refinement_at_size)
+	for i := range refinement_at {
+		refinement_at[i] = int(int8(data[at_size + i]))
+	}
+	data = data[at_size + refinement_at_size:]
+	export_count := int64(binary.BigEndian.Uint32(data))
+	new_count := int64(binary.BigEndian.Uint32(data[4:]))
+	data = data[8:]
+
+	// the input symbols are those exported by the referred symbol dictionaries
+	symbols, last_dictionary, ok := decoder.referredSymbols(segment)
+	if !ok {
+		return false
+	}
+	if new_count > int64(jbig2_max_symbols - len(symbols)) {
+		decoder.anomaly(JBIG2TooManySymbols, "%d new symbols", new_count)
+		return false
+	}
+	input_count := len(symbols)
+	total_count := input_count + int(new_count)
+
+	// the contexts may continue from the last referred dictionary
+	generic_contexts := make([]jbig2Context, 1 << 16)
+	ints := newJBIG2TextDecoders(total_count)
+	if context_used && last_dictionary != nil && last_dictionary.generic_contexts != nil {
+		copy(generic_contexts, last_dictionary.generic_contexts)
+		copy(ints.refinement_contexts, last_dictionary.refinement_contexts)
+	}
+	if context_retained {
+		segment.generic_contexts = generic_contexts
+		segment.refinement_contexts = ints.refinement_contexts
+	}
+
+	// the sizes, instance counts and export flags are arithmetic or huffman coded
+	// aggregated symbols are coded like the text region with the standard tables of T.88 table 17
+	var decode_height, decode_width, decode_size, decode_instances, decode_export func() (int, bool)
+	var exhausted func() bool
+	var arith *jbig2ArithDecoder
+	var reader *jbig2BitReader
+	var coder *jbig2TextCoder
+	region := &jbig2TextRegion{0, 1, true, jbig2CornerTopLeft, false, jbig2CombineOr, 0, 0, refinement_template, refinement_at, nil}
+	if huffman {
+		tables, ok := decoder.selectTables(segment, []int{4, 5, -1, 0}[flags >> 2 & 3], []int{2, 3, -1, 0}[flags >> 4 & 3], []int{1, 0}[flags >> 6 & 1], []int{1, 0}[flags >> 7 & 1])
+		if !ok {
+			return false
+		}
+		reader = newJBIG2BitReader(data)
+		decode := func(table *jbig2HuffmanTable) func() (int, bool) {
+			return func() (int, bool) {
+				return table.decode(reader)
+			}
+		}
+		decode_height, decode_width, decode_size, decode_instances, decode_export = decode(tables[0]), decode(tables[1]), decode(tables[2]), decode(tables[3]), decode(jbig2StandardTable(1))
+		exhausted = reader.exhausted
+		text_tables := &jbig2TextTables{jbig2StandardTable(6), jbig2StandardTable(8), jbig2StandardTable(11), jbig2StandardTable(15), jbig2StandardTable(15), jbig2StandardTable(15), jbig2StandardTable(15), jbig2StandardTable(1), nil, jbig2SymbolCodeLength(total_count)}
+		coder = decoder.huffmanTextCoder(reader, text_tables, ints.refinement_contexts, region)
+	} else {
+		arith = newJBIG2ArithDecoder(data)
+		decode := func(int_decoder *jbig2IntDecoder) func() (int, bool) {
+			return func() (int, bool) {
+				return int_decoder.decode(arith)
+			}
+		}
+		decode_height, decode_width, decode_instances, decode_export = decode(newJBIG2IntDecoder()), decode(newJBIG2IntDecoder()), decode(newJBIG2IntDecoder()), decode(newJBIG2IntDecoder())
+		exhausted = arith.exhausted
+		coder = decoder.arithTextCoder(arith, ints, region)
+	}
+
+	// symbols are decoded in height classes of increasing width
+	pixels := int64(0)
+	height := 0
+	for len(symbols) < total_count {
+		dh, ok := decode_height()
+		if !ok || height + dh < 0 || exhausted() {
+			decoder.anomaly(JBIG2InvalidSegment, "invalid height class at symbol %d", len(symbols) - input_count)
+			return false
+		}
+		height += dh
+		width := 0
+		class := []*jbig2Bitmap{}
+		for {
+			dw, ok := decode_width()
+			if !ok {
+				break
+			}
+			width += dw
+			if width < 0 || len(symbols) >= total_count || exhausted() {
+				decoder.anomaly(JBIG2InvalidSegment, "invalid symbol %d", len(symbols) - input_count)
+				return false
+			}
+
+			// the symbols of a dictionary together are limited like one bitmap
+			pixels += int64(width) * int64(height)
+			symbol, ok := decoder.newBitmap(int64(width), int64(height))
+			if !ok || pixels > jbig2_max_bitmap_pixels {
+				if ok {
+					decoder.anomaly(JBIG2OversizedBitmap, "symbols exceed %d pixels", jbig2_max_bitmap_pixels)
+				}
+				return false
+			}
+
+			if !refine_aggregate {
+				// the symbols of a huffman coded height class are decoded together after it
+				if huffman {
+					class = append(class, symbol)
+				} else if !decoder.decodeGeneric(arith, generic_contexts, symbol, template, false, at) {
+					return false
+				}
+			} else {
+				instances, _ := decode_instances()
+				if instances == 1 {
+					// a refinement of one symbol
+					id, _ := coder.id()
+					rdx, _ := coder.rdx()
+					rdy, _ := coder.rdy()
+					if id >= len(symbols) {
+						decoder.anomaly(JBIG2SymbolOutOfRange, "symbol %d of %d", id, len(symbols))
+						return false
+					}
+					if !coder.refine(symbol, symbols[id], rdx, rdy) {
+						return false
+					}
+				} else {
+					// a text region of the symbols decoded so far
+					region.instances = int64(instances)
+					region.symbols = symbols
+					if !decoder.decodeText(coder, symbol, region) {
+						return false
+					}
+				}
+			}
+			symbols = append(symbols, symbol)
+		}
+		if huffman && !refine_aggregate && !decoder.decodeHeightClass(reader, decode_size, class, height) {
+			return false
+		}
+	}
+
+	// runs of symbols are alternately not exported and exported
+	exported := []*jbig2Bitmap{}
+	export := false
+	for i := 0; i < total_count; export = !export {
+		run, ok := decode_export()
+		if !ok || run < 0 || run > total_count - i || exhausted() {
+			decoder.anomaly(JBIG2InvalidSegment, "invalid export flags")
+			return false
+		}
+		if export {
+			exported = append(exported, symbols[i:i + run]...)
+		}
+		i += run
+	}
+	if int64(len(exported)) != export_count {
+		decoder.anomaly(JBIG2InvalidSegment, "exports %d symbols, declared %d", len(exported), export_count)
+	}
+	segment.symbols = exported
+	return true
+}
+
+// decodeHeightClass decodes the symbols of a height class of a huffman coded symbol dictionary from a bitmap of them side by side
+// the bitmap is uncompressed if its size is 0 and mmr coded otherwise
+func (decoder *jbig2Decoder) decodeHeightClass(reader *jbig2BitReader, decode_size func() (int, bool), class []*jbig2Bitmap, height int) bool {
+	width := 0
+	for _, symbol := range class {
+		width += symbol.width
+	}
+	size, ok := decode_size()
+	if !ok || reader.exhausted() {
+		decoder.anomaly(JBIG2InvalidSegment, "invalid height class size")
+		return false
+	}
+	collective, ok := decoder.newBitmap(int64(width), int64(height))
+	if !ok {
+		return false
+	}
+	if size == 0 {
+		data, ok := reader.readBytes(len(collective.data))
+		if !ok {
+			decoder.anomaly(JBIG2InvalidSegment, "truncated height class")
+			return false
+		}
+		copy(collective.data, data)
+	} else {
+		data, ok := reader.readBytes(size)
+		if !ok {
+			decoder.anomaly(JBIG2InvalidSegment, "truncated height class")
+			return false
+		}
+		if !decoder.decodeMMR(collective, data) {
+			return false
+		}
+	}
+
+	x := 0
+	for _, symbol := range class {
+		for j := 0; j < symbol.height; j++ {
+			for i := 0; i < symbol.width; i++ {
+				symbol.set(i, j, collective.get(x + i, j))
+			}
+		}
+		x += symbol.width
+	}
+	return true
+}
@@ -5,6 +5,7 @@ const (
 	KEYWORD_TRAILER = Keyword("trailer")
 	KEYWORD_OBJ = Keyword("obj")
 	KEYWORD_STREAM = Keyword("stream")
+	KEYWORD_ENDOBJ = Keyword("endobj")
 	KEYWORD_R = Keyword("R")
 	KEYWORD_N = Keyword("n")
 	KEYWORD_NULL = Keyword("null")
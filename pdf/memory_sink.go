@@ -0,0 +1,104 @@
+package pdf
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+)
+
+// Result holds everything found in a pdf
+type Result struct {
+	Report *Report
+
+	// Files maps the md5 of each embedded file to its data
+	Files map[string][]byte
+
+	// Text is the text content, one line per text command
+	Text string
+
+	// Objects are the decrypted and decoded objects
+	Objects []*IndirectObject
+}
+
+// MemorySink keeps everything found in a pdf in memory
+type MemorySink struct {
+	result *Result
+	text strings.Builder
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{&Result{NewReport(), map[string][]byte{}, "", []*IndirectObject{}}, strings.Builder{}}
+}
+
+// Result returns everything written to the sink
+func (sink *MemorySink) Result() *Result {
+	sink.result.Text = sink.text.String()
+	return sink.result
+}
+
+func (sink *MemorySink) WriteFileSummary(summary FileSummary) {
+	sink.result.Report.File = summary
+}
+
+func (sink *MemorySink) WriteFileInfo(info *FileInfo) {
+	sink.result.Report.Info = info
+}
+
+func (sink *MemorySink) WriteEncryption(info *EncryptionInfo) {
+	sink.result.Report.Encryption = info
+}
+
+func (sink *MemorySink) WritePassword(password_type string, password string) {
+	sink.result.Report.addPassword(password_type, password)
+}
+
+func (sink *MemorySink) WriteURL(url string, location Location) {
+	sink.result.Report.addURL(url, location)
+}
+
+func (sink *MemorySink) WriteCommand(command string, location Location) {
+	sink.result.Report.addCommand(command, location)
+}
+
+func (sink *MemorySink) WriteFileName(name string, location Location) {
+	sink.result.Report.addFile(name, unknownHash, 0, false, location)
+}
+
+func (sink *MemorySink) DumpFile(name string, data []byte, location Location) {
+	// get md5 hash of the file
+	hash := md5.New()
+	hash.Write(data)
+	md5sum := hex.EncodeToString(hash.Sum(nil))
+
+	sink.result.Files[md5sum] = data
+	sink.result.Report.addFile(name, md5sum, len(data), true, location)
+}
+
+func (sink *MemorySink) WriteScript(script string, location Location) {
+	sink.result.Report.addScript(script, location)
+}
+
+func (sink *MemorySink) WriteText(text string) {
+	sink.text.WriteString(text)
+	sink.text.WriteString("\n")
+}
+
+func (sink *MemorySink) WriteObject(object *IndirectObject) {
+	sink.result.Objects = append(sink.result.Objects, object)
+}
+
+func (sink *MemorySink) WriteUncovered(region UncoveredRegion, data []byte) {
+	sink.result.Report.Uncovered = append(sink.result.Report.Uncovered, region)
+}
+
+func (sink *MemorySink) WriteFormat(format EmbeddedFormat) {
+	sink.result.Report.Formats = append(sink.result.Report.Formats, format)
+}
+
+func (sink *MemorySink) WriteAnomaly(anomaly Anomaly) {
+	sink.result.Report.addAnomaly(anomaly)
+}
+
+func (sink *MemorySink) Close() error {
+	return nil
+}
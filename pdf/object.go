@@ -2,6 +2,7 @@ package pdf
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -14,10 +15,11 @@ type IndirectObject struct {
 	Generation int
 	Value Object
 	Stream []byte
+	Filters []FilterResult
 }
 
 func NewIndirectObject(number int) *IndirectObject {
-	return &IndirectObject{number, 0, KEYWORD_NULL, nil}
+	return &IndirectObject{number, 0, KEYWORD_NULL, nil, nil}
 }
 
 func (object *IndirectObject) String() string {
@@ -30,37 +32,37 @@ func (object *IndirectObject) String() string {
 	return sb.String()
 }
 
-func (object *IndirectObject) Extract(output *Output) {
+func (object *IndirectObject) Extract(sink Sink, location Location) {
 	// get object dictionary
 	if d, ok := object.Value.(Dictionary); ok {
-		extract(d, output)
+		extract(d, sink, location)
 	}
 }
 
-func extract(o Object, output *Output) {
+func extract(o Object, sink Sink, location Location) {
 	if d, ok := o.(Dictionary); ok {
 		// dump actions
 		if a, ok := d.GetDictionary("A"); ok {
-			Action(a).Extract(output)
+			Action(a).Extract(sink, location.child("A"))
 		}
 
 		// dump open action
 		if open_action, ok := d.GetDictionary("OpenAction"); ok {
-			Action(open_action).Extract(output)
+			Action(open_action).Extract(sink, location.child("OpenAction"))
 		}
 
 		// dump additional actions
 		if aa, ok := d.GetDictionary("AA"); ok {
 			for key := range aa {
 				if a, ok := aa.GetDictionary(key); ok {
-					Action(a).Extract(output)
+					Action(a).Extract(sink, location.child("AA").child(key))
 				}
 			}
 		}
 
 		// dump forms
 		if xfa, ok := d.GetStream("XFA"); ok {
-			output.DumpFile("form.xml", xfa)
+			sink.DumpFile("form.xml", xfa, location.child("XFA"))
 		} else if xfa, ok := d.GetArray("XFA"); ok {
 			var form_data strings.Builder
 			for i := range xfa {
@@ -68,39 +70,39 @@ func extract(o Object, output *Output) {
 					form_data.WriteString(string(s))
 				}
 			}
-			output.DumpFile("form.xml", []byte(form_data.String()))
+			sink.DumpFile("form.xml", []byte(form_data.String()), location.child("XFA"))
 		}
 
 		// dump Embedded Files
 		embedded_files := d.GetNameTreeMap("EmbeddedFiles")
 		for i := 1; i < len(embedded_files); i += 2 {
 			if f, ok := embedded_files.GetString(i); ok {
-				fmt.Fprintf(output.Files, "%s:%s\n", unknownHash, f)
+				sink.WriteFileName(f, location.child("EmbeddedFiles"))
 			} else if f, ok := embedded_files.GetDictionary(i); ok {
-				File(f).Extract(output, false)
+				File(f).Extract(sink, location.child("EmbeddedFiles"), false)
 			}
 		}
 
 		// dump javascript
 		if js, ok := d.GetString("JS"); ok {
-			fmt.Fprintln(output.Javascript, js)
+			sink.WriteScript(js, location.child("JS"))
 		} else if js, ok := d.GetStream("JS"); ok {
-			fmt.Fprintln(output.Javascript, string(js))
+			sink.WriteScript(string(js), location.child("JS"))
 		}
 
 		// dump page text
 		if pages, ok := d.GetPageTree("Pages"); ok {
 			for i := range pages {
-				Page(pages[i]).Extract(output)
+				Page(pages[i]).Extract(sink)
 			}
 		}
 
 		// dump URIs
 		if url, ok := d.GetString("URI"); ok {
-			fmt.Fprintln(output.URLs, string(url))
+			sink.WriteURL(string(url), location.child("URI"))
 		} else if url, ok := d.GetDictionary("URI"); ok {
 			if base, ok := url.GetString("Base"); ok {
-				fmt.Fprintln(output.URLs, string(base))
+				sink.WriteURL(string(base), location.child("URI").child("Base"))
 			}
 		}
 
@@ -108,16 +110,16 @@ func extract(o Object, output *Output) {
 		urls := d.GetNameTreeMap("URLS")
 		for i := 0; i < len(urls); i += 2 {
 			if url, ok := urls.GetString(i); ok {
-				fmt.Fprintln(output.URLs, string(url))
+				sink.WriteURL(string(url), location.child("URLS"))
 			}
 		}
 
 		for key := range d {
-			extract(d[key], output)
+			extract(d[key], sink, location.child(key))
 		}
 	} else if a, ok := o.(Array); ok {
 		for i := range a {
-			extract(a[i], output)
+			extract(a[i], sink, location.child(strconv.Itoa(i)))
 		}
 	}
 }
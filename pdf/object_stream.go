@@ -0,0 +1,164 @@
+package pdf
+
+import (
+	"bytes"
+)
+
+// ObjectStream holds the decoded contents of an object stream (/Type /ObjStm)
+type ObjectStream struct {
+	Number int
+	Numbers []int
+	Offsets []int64
+	Data []byte
+}
+
+// NewObjectStream parses the offset table of an object stream and returns the object stream
+func NewObjectStream(object *IndirectObject) (*ObjectStream, bool) {
+	// get the stream dictionary
+	d, ok := object.Value.(Dictionary)
+	if !ok {
+		return nil, false
+	}
+
+	// make sure this is an object stream
+	if t, ok := d.GetName("Type"); !ok || t != "ObjStm" {
+		return nil, false
+	}
+
+	// get the number of objects in the stream
+	n, ok := d.GetInt("N")
+	if !ok || n < 0 {
+		return nil, false
+	}
+
+	// get the offset of the first object
+	first, ok := d.GetInt64("First")
+	if !ok || first < 0 || first > int64(len(object.Stream)) {
+		return nil, false
+	}
+
+	// create the object stream
+	object_stream := &ObjectStream{object.Number, []int{}, []int64{}, object.Stream}
+
+	// read the object number and offset pairs
+	table_parser := NewParser(bytes.NewReader(object.Stream[:first]), nil)
+	for i := 0; i < n; i++ {
+		number, ok := table_parser.ReadInt()
+		if !ok {
+			break
+		}
+		offset, ok := table_parser.ReadInt64()
+		if !ok {
+			break
+		}
+
+		// skip offsets outside of the stream, including offsets that overflowed while they were read
+		if offset < 0 || offset > int64(len(object.Stream)) - first {
+			continue
+		}
+		object_stream.Numbers = append(object_stream.Numbers, number)
+		object_stream.Offsets = append(object_stream.Offsets, first + offset)
+	}
+
+	return object_stream, true
+}
+
+// Find returns the offset of the object with the given number, index is tried first
+func (object_stream *ObjectStream) Find(number int, index int) (int64, bool) {
+	// use index if it points to the right object
+	if index >= 0 && index < len(object_stream.Numbers) && object_stream.Numbers[index] == number {
+		return object_stream.Offsets[index], true
+	}
+
+	// otherwise search for the object number
+	for i := range object_stream.Numbers {
+		if object_stream.Numbers[i] == number {
+			return object_stream.Offsets[i], true
+		}
+	}
+	return 0, false
+}
+
+// getObjectStream loads and caches the object stream with the given object number
+func (parser *Parser) getObjectStream(number int) (*ObjectStream, bool) {
+	// use cached object stream if possible
+	if object_stream, ok := parser.object_streams[number]; ok {
+		return object_stream, object_stream != nil
+	}
+
+	// prevent loops while loading the object stream
+	parser.object_streams[number] = nil
+
+	// object streams must be stored as indirect objects
+	xref_entry, ok := parser.Xref[number]
+	if !ok || xref_entry.Type != XrefTypeIndirectObject {
+		return nil, false
+	}
+
+	// parse the object stream, it is decoded even while reading objects with raw streams
+	raw_streams := parser.raw_streams
+	parser.raw_streams = false
+	object_stream, ok := NewObjectStream(parser.GetObject(number))
+	parser.raw_streams = raw_streams
+	if !ok {
+		return nil, false
+	}
+
+	// cache the object stream
+	parser.object_streams[number] = object_stream
+	return object_stream, true
+}
+
+// readCompressedObject reads the value of an object stored in an object stream
+func (parser *Parser) readCompressedObject(xref_entry *XrefEntry, number int) Object {
+	// the xref offset of a compressed object is the object stream number
+	object_stream, ok := parser.getObjectStream(int(xref_entry.Offset))
+	if !ok {
+		return KEYWORD_NULL
+	}
+
+	// the xref generation of a compressed object is its index in the object stream
+	offset, ok := object_stream.Find(number, xref_entry.Generation)
+	if !ok || offset < 0 || offset >= int64(len(object_stream.Data)) {
+		return KEYWORD_NULL
+	}
+
+	// strings in object streams are not encrypted because the stream already was
+	object_parser := NewParser(bytes.NewReader(object_stream.Data[offset:]), parser.sink)
+	object_parser.location = parser.objectLocation(number)
+	value, _ := object_parser.ReadObject(noDecryptor)
+
+	// references must resolve through this parser instead of the object stream parser
+	bindReferences(value, parser)
+	return value
+}
+
+// objectLocation returns the location of an object, objects in object streams are located at their object stream
+func (parser *Parser) objectLocation(number int) Location {
+	xref_entry, ok := parser.Xref[number]
+	if !ok {
+		return Location{number, 0, 0, 0, nil}
+	}
+	if xref_entry.Type == XrefTypeCompressedObject {
+		object_stream_number := int(xref_entry.Offset)
+		offset := int64(0)
+		if object_stream_entry, ok := parser.Xref[object_stream_number]; ok && object_stream_entry.Type == XrefTypeIndirectObject {
+			offset = object_stream_entry.Offset
+		}
+		return Location{number, 0, object_stream_number, offset, nil}
+	}
+	return Location{number, xref_entry.Generation, 0, xref_entry.Offset, nil}
+}
+
+// indexObjectStream adds xref entries for objects in an object stream that are missing from the xref
+func (parser *Parser) indexObjectStream(number int) {
+	object_stream, ok := parser.getObjectStream(number)
+	if !ok {
+		return
+	}
+	for i, object_number := range object_stream.Numbers {
+		if _, ok := parser.Xref[object_number]; !ok {
+			parser.Xref[object_number] = NewXrefEntry(int64(number), i, XrefTypeCompressedObject)
+		}
+	}
+}
@@ -2,13 +2,12 @@ package pdf
 
 import (
 	"bytes"
-	"io"
 	"strings"
 )
 
 type Page Dictionary
 
-func (page Page) Extract(output *Output) {
+func (page Page) Extract(sink Sink) {
 	d := Dictionary(page)
 
 	// load fonts
@@ -22,17 +21,17 @@ func (page Page) Extract(output *Output) {
 
 	// get contents
 	if contents, ok := d.GetStream("Contents"); ok {
-		page.extract(output, font_map, contents)
+		page.extract(sink, font_map, contents)
 	} else if contents_array, ok := d.GetArray("Contents"); ok {
 		for i := range contents_array {
 			if contents, ok := contents_array.GetStream(i); ok {
-				page.extract(output, font_map, contents)
+				page.extract(sink, font_map, contents)
 			}
 		}
 	}
 }
 
-func (page Page) extract(output *Output, font_map map[string]*Font, contents []byte) {
+func (page Page) extract(sink Sink, font_map map[string]*Font, contents []byte) {
 	// create parser for parsing contents
 	page_parser := NewParser(bytes.NewReader(contents), nil)
 
@@ -66,8 +65,7 @@ func (page Page) extract(output *Output, font_map map[string]*Font, contents []b
 				} else if command == KEYWORD_TEXT_SHOW_1 || command == KEYWORD_TEXT_SHOW_2 || command == KEYWORD_TEXT_SHOW_3 {
 					// decode text with current font font
 					s, _ := operands.GetString(len(operands) - 1)
-					io.WriteString(output.Text, current_font.Decode([]byte(s)))
-					io.WriteString(output.Text, "\n")
+					sink.WriteText(current_font.Decode([]byte(s)))
 				} else if command == KEYWORD_TEXT_POSITION {
 					// decode positioned text with current font
 					var sb strings.Builder
@@ -76,8 +74,7 @@ func (page Page) extract(output *Output, font_map map[string]*Font, contents []b
 						s, _ := a.GetString(i)
 						sb.WriteString(string(s))
 					}
-					io.WriteString(output.Text, current_font.Decode([]byte(sb.String())))
-					io.WriteString(output.Text, "\n")
+					sink.WriteText(current_font.Decode([]byte(sb.String())))
 				}
 			}
 		}
@@ -3,7 +3,10 @@ package pdf
 import (
 	"bufio"
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"io"
+	"io/ioutil"
 	"regexp"
 	"sort"
 	"strconv"
@@ -14,20 +17,35 @@ var start_xref_scan_buffer_size int64 = 256
 var start_xref_regexp = regexp.MustCompile(`startxref\s*(\d+)\s*%%EOF`)
 var start_obj_regexp = regexp.MustCompile(`\d+([\s\x00]|(%[^\r\n]*))+\d+([\s\x00]|(%[^\r\n]*))+obj`)
 var xref_regexp = regexp.MustCompile(`xref`)
+var eof_regexp = regexp.MustCompile(`%%EOF`)
+var start_xref_keyword_regexp = regexp.MustCompile(`startxref`)
+var header_version_regexp = regexp.MustCompile(`^%PDF-(\d+\.\d+)`)
 var whitespace = []byte("\x00\t\n\f\r ")
 var delimiters = []byte("()<>[]/%")
 
+// a file encryption key is checked against up to check_key_streams encrypted flate streams, inflating at most check_key_max_size bytes of each
+var check_key_streams = 3
+var check_key_max_size int64 = 1 << 20
+
 type Parser struct {
 	*bufio.Reader
 	seeker io.ReadSeeker
 	Xref map[int]*XrefEntry
 	trailer Dictionary
 	security_handler *SecurityHandler
-	output *Output
+	sink Sink
+	object_streams map[int]*ObjectStream
+	definitions map[int][]*XrefEntry
+	EncryptionInfo *EncryptionInfo
+	location Location
+	DecodeLimits DecodeLimits
+	decoded_size int64
+	decoded_streams map[int64]int64
+	raw_streams bool
 }
 
-func NewParser(readSeeker io.ReadSeeker, output *Output) *Parser {
-	return &Parser{bufio.NewReader(readSeeker), readSeeker, map[int]*XrefEntry{}, Dictionary{}, NewSecurityHandler(), output}
+func NewParser(readSeeker io.ReadSeeker, sink Sink) *Parser {
+	return &Parser{bufio.NewReader(readSeeker), readSeeker, map[int]*XrefEntry{}, Dictionary{}, NewSecurityHandler(), sink, map[int]*ObjectStream{}, map[int][]*XrefEntry{}, nil, Location{}, DefaultDecodeLimits, 0, map[int64]int64{}, false}
 }
 
 func (parser *Parser) Load(password string) error {
@@ -36,6 +54,7 @@ func (parser *Parser) Load(password string) error {
 
 	// find location of all objects
 	objects := parser.findObjects()
+	parser.checkDefinitions()
 
 	// add xref stream offsets to xref offsets then sort first to last
 	for _, object := range objects {
@@ -58,9 +77,14 @@ func (parser *Parser) Load(password string) error {
 	// repair broken and missing xref entries
 	for object_number, object := range objects {
 		if xref_entry, ok := parser.Xref[object_number]; ok {
+			// compressed objects do not have an offset to repair
+			if xref_entry.Type == XrefTypeCompressedObject {
+				continue
+			}
+
 			// replace xref entry if it does not point to an object or points to the wrong object
 			parser.Seek(xref_entry.Offset, io.SeekStart)
-			if n, _, ok := parser.ReadObjectHeader(); ok || n != object_number {
+			if n, _, ok := parser.ReadObjectHeader(); !ok || n != object_number {
 				xref_entry.Offset = object.Offset
 			}
 		} else {
@@ -70,6 +94,22 @@ func (parser *Parser) Load(password string) error {
 	}
 
 	// setup security handler if pdf is encrypted
+	if err := parser.loadEncryption(password); err != nil {
+		return err
+	}
+
+	// index objects in object streams found by the object scan so they are found even if the xref is broken
+	for object_number, object := range objects {
+		if object.IsObjectStream {
+			parser.indexObjectStream(object_number)
+		}
+	}
+
+	return nil
+}
+
+// loadEncryption sets up the security handler if the trailer has an encryption dictionary
+func (parser *Parser) loadEncryption(password string) error {
 	if encrypt, ok := parser.trailer["Encrypt"]; ok {
 		// make sure we don't decrypt the encryption dictionary
 		if ref, ok := encrypt.(*Reference); ok {
@@ -78,29 +118,171 @@ func (parser *Parser) Load(password string) error {
 			}
 		}
 
+		// describe the encryption before the password is checked
+		if d, ok := parser.trailer.GetDictionary("Encrypt"); ok {
+			parser.EncryptionInfo = NewEncryptionInfo(d)
+		}
+
 		// set encryption password
 		if err := parser.SetPassword(password); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
 func (parser *Parser) SetPassword(password string) error {
-	return parser.security_handler.Init([]byte(password), parser.trailer)
+	if err := parser.security_handler.Init([]byte(password), parser.trailer); err != nil {
+		return err
+	}
+
+	// make sure a known encryption key decrypts the pdf
+	if parser.security_handler.known_key != nil {
+		if valid, checked := parser.CheckEncryptionKey(); checked && !valid {
+			return EncryptionKeyError
+		}
+	}
+
+	// report permissions that do not match the encryption dictionary
+	if parser.security_handler.r >= 5 && !parser.security_handler.perms_valid {
+		parser.log_error(InvalidEncryptionPerms)
+	}
+
+	// add authentication results to the encryption info
+	if info := parser.EncryptionInfo; info != nil {
+		info.PasswordType = parser.security_handler.PasswordType
+		if parser.security_handler.r >= 5 {
+			perms_valid := parser.security_handler.perms_valid
+			info.PermsValid = &perms_valid
+		}
+
+		// the public-key security handler stores the permissions in the recipient envelope
+		if info.Filter == "Adobe.PubSec" && len(parser.security_handler.p) == 4 {
+			info.SetPermissions(int32(binary.LittleEndian.Uint32(parser.security_handler.p)))
+		}
+	}
+	return nil
+}
+
+// CheckEncryptionKey returns true if the file encryption key decrypts the pdf
+// the second value is false if there was nothing the key could be checked against
+func (parser *Parser) CheckEncryptionKey() (bool, bool) {
+	security_handler := parser.security_handler
+
+	// the standard security handler stores values derived from the key
+	if filter, _ := security_handler.encrypt.GetName("Filter"); filter == "Standard" {
+		if security_handler.r < 5 {
+			return security_handler.checkUserKey(security_handler.encryption_key), true
+		}
+		if len(security_handler.perms) >= 16 {
+			_, valid := security_handler.decryptPerms()
+			return valid, true
+		}
+	}
+
+	// otherwise one of the first encrypted flate streams must inflate cleanly
+	numbers := []int{}
+	for number, xref_entry := range parser.Xref {
+		if xref_entry.Type == XrefTypeIndirectObject && xref_entry.IsEncrypted {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	checked := 0
+	for _, number := range numbers {
+		if data, ok := parser.readEncryptedFlateStream(number); ok {
+			if inflatesCleanly(data) {
+				return true, true
+			}
+			checked++
+			if checked >= check_key_streams {
+				break
+			}
+		}
+	}
+	return false, checked > 0
+}
+
+// inflatesCleanly returns true if data is zlib data that inflates to its checksum without errors, or to more than check_key_max_size bytes
+// data decrypted with a wrong key rarely has a valid header and almost never ends cleanly
+func inflatesCleanly(data []byte) bool {
+	zlib_reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(zlib_reader, check_key_max_size))
+	return n > 0 && err == nil
+}
+
+// readEncryptedFlateStream returns the decrypted but not decoded data of a flate stream that uses the default stream filter
+func (parser *Parser) readEncryptedFlateStream(number int) ([]byte, bool) {
+	xref_entry := parser.Xref[number]
+
+	// read the object value
+	parser.Seek(xref_entry.Offset, io.SeekStart)
+	if _, _, ok := parser.ReadObjectHeader(); !ok {
+		return nil, false
+	}
+	value, _ := parser.ReadObject(noDecryptor)
+	if parser.ReadKeyword() != KEYWORD_STREAM {
+		return nil, false
+	}
+	d, ok := value.(Dictionary)
+	if !ok {
+		return nil, false
+	}
+
+	// the first filter must be flate
+	filter, ok := d.GetName("Filter")
+	if !ok {
+		filter_list, _ := d.GetArray("Filter")
+		filter, _ = filter_list.GetName(0)
+	}
+	if filter != "FlateDecode" && filter != "Fl" {
+		return nil, false
+	}
+
+	// embedded files may use a different crypt filter
+	if t, _ := d.GetName("Type"); t == "EmbeddedFile" || t == "XRef" {
+		return nil, false
+	}
+
+	// decrypt the stream without decoding it
+	decryptor := parser.security_handler.stream_filter.NewDecryptor(number, xref_entry.Generation)
+	return parser.ReadStream(decryptor, parser.streamLength(d), Array{}, Array{}), true
+}
+
+// SecurityHandler returns the security handler used to decrypt the pdf
+func (parser *Parser) SecurityHandler() *SecurityHandler {
+	return parser.security_handler
 }
 
 // FindXrefOffsets locates all xref tables
 func (parser *Parser) findXrefOffsets() []int64 {
+	return parser.findOffsets(xref_regexp)
+}
+
+// findXrefTableOffsets locates all xref markers that are not part of a startxref marker
+func (parser *Parser) findXrefTableOffsets() []int64 {
+	offsets := []int64{}
+	for _, offset := range parser.findXrefOffsets() {
+		if offset < 5 || string(parser.ReadRange(offset - 5, 5)) != "start" {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+// findOffsets locates every match of a regular expression
+func (parser *Parser) findOffsets(marker_regexp *regexp.Regexp) []int64 {
 	offsets := []int64{}
 
 	// jump to start of file
 	offset, _ := parser.Seek(0, io.SeekStart)
 
 	for {
-		// scan for xref table marker
-		index := xref_regexp.FindReaderIndex(parser)
+		// scan for marker
+		index := marker_regexp.FindReaderIndex(parser)
 		if index == nil {
 			break
 		}
@@ -108,7 +290,7 @@ func (parser *Parser) findXrefOffsets() []int64 {
 		// add location to offsets
 		offsets = append(offsets, offset + int64(index[0]))
 
-		// seek to end of xref marker
+		// seek to end of marker
 		offset, _ = parser.Seek(offset + int64(index[1]), io.SeekStart)
 	}
 
@@ -136,14 +318,19 @@ func (parser *Parser) findObjects() map[int]*XrefEntry {
 		// get object number, generation
 		n, g, _ := parser.ReadObjectHeader()
 
-		// add xref entry
+		// add xref entry, later definitions shadow earlier ones but every definition is kept
 		objects[n] = NewXrefEntry(offset + int64(index[0]), g, XrefTypeIndirectObject)
+		parser.definitions[n] = append(parser.definitions[n], objects[n])
 
-		// determine if object is xref stream
+		// determine if object is xref stream, anomalies are reported at the object
+		parser.location = Location{n, g, 0, offset + int64(index[0]), nil}
 		d := parser.ReadDictionary(noDecryptor)
+		parser.location = Location{}
 		if t, ok := d.GetName("Type"); ok && t == "XRef" {
 			objects[n].IsXrefStream = true
 			objects[n].IsEncrypted = false
+		} else if ok && t == "ObjStm" {
+			objects[n].IsObjectStream = true
 		}
 
 		// seek to end of object start marker
@@ -197,18 +384,52 @@ func (parser *Parser) loadXref(offset int64, offsets map[int64]interface{}) {
 			// if xref is a stream
 			parser.Seek(offset, io.SeekStart)
 			if n, g, ok := parser.ReadObjectHeader(); ok {
-				// prevent decrypting xref streams
-				parser.Xref[n] = NewXrefEntry(offset, g, XrefTypeIndirectObject)
-				parser.Xref[n].IsEncrypted = false
-
-				// read the xref object
-				parser.loadXrefStream(n, offsets)
+				parser.loadXrefStream(n, g, offset, offsets)
 			}
 		}
 	}
 }
 
 func (parser *Parser) loadXrefTable(offsets map[int64]interface{}) {
+	// read the xref table
+	trailer, xrefs := parser.readXrefTable()
+
+	// load previous xref section if it exists
+	if prev, ok := trailer.GetInt64("Prev"); ok {
+		parser.loadXref(prev, offsets)
+	}
+
+	// load the supplemental xref stream of a hybrid-reference file, it is part of this section so it overrides previous sections
+	if xref_stm, ok := trailer.GetInt64("XRefStm"); ok {
+		xrefs = mergeXrefStm(xrefs, parser.loadXrefStm(xref_stm, offsets))
+	}
+
+	// merge trailer
+	for key, value := range trailer {
+		parser.trailer[key] = value
+	}
+
+	// merge xrefs
+	for key, value := range xrefs {
+		parser.Xref[key] = value
+	}
+}
+
+// readXrefTable reads the xref table after the xref keyword and returns its trailer and entries
+func (parser *Parser) readXrefTable() (Dictionary, map[int]*XrefEntry) {
+	xrefs := parser.readXrefEntries()
+
+	// read trailer keyword
+	parser.ReadKeyword();
+
+	// read in trailer dictionary
+	trailer := parser.ReadDictionary(noDecryptor);
+
+	return trailer, xrefs
+}
+
+// readXrefEntries reads the subsections of an xref table
+func (parser *Parser) readXrefEntries() map[int]*XrefEntry {
 	// read all xref entries
 	xrefs := map[int]*XrefEntry{}
 	for {
@@ -253,11 +474,48 @@ func (parser *Parser) loadXrefTable(offsets map[int64]interface{}) {
 		}
 	}
 
-	// read trailer keyword
-	parser.ReadKeyword();
+	return xrefs
+}
 
-	// read in trailer dictionary
-	trailer := parser.ReadDictionary(noDecryptor);
+// mergeXrefStm merges the entries of a supplemental xref stream into the entries of its xref table
+// the table takes precedence over the supplemental xref stream unless the table entry is free
+func mergeXrefStm(xrefs map[int]*XrefEntry, stream_xrefs map[int]*XrefEntry) map[int]*XrefEntry {
+	merged := map[int]*XrefEntry{}
+	for key, value := range stream_xrefs {
+		merged[key] = value
+	}
+	for key, value := range xrefs {
+		if _, ok := stream_xrefs[key]; ok && value.Type == XrefTypeFreeObject {
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// loadXrefStm reads the supplemental xref stream of a hybrid-reference file and returns its entries
+func (parser *Parser) loadXrefStm(offset int64, offsets map[int64]interface{}) map[int]*XrefEntry {
+	// dont load same xref twice
+	if _, ok := offsets[offset]; ok {
+		return map[int]*XrefEntry{}
+	}
+	offsets[offset] = nil
+
+	// read the xref stream object header
+	parser.Seek(offset, io.SeekStart)
+	n, g, ok := parser.ReadObjectHeader()
+	if !ok {
+		return map[int]*XrefEntry{}
+	}
+
+	// the dictionary of the supplemental xref stream is not part of the trailer
+	_, xrefs := parser.readXrefStream(n, g, offset)
+	return xrefs
+}
+
+func (parser *Parser) loadXrefStream(n int, g int, offset int64, offsets map[int64]interface{}) {
+	// read the xref stream
+	trailer, xrefs := parser.readXrefStream(n, g, offset)
 
 	// load previous xref section if it exists
 	if prev, ok := trailer.GetInt64("Prev"); ok {
@@ -275,26 +533,25 @@ func (parser *Parser) loadXrefTable(offsets map[int64]interface{}) {
 	}
 }
 
-func (parser *Parser) loadXrefStream(n int, offsets map[int64]interface{}) {
-	xref_stream_offset := parser.CurrentOffset()
+// readXrefStream reads the xref stream object n at offset and returns its dictionary and entries
+func (parser *Parser) readXrefStream(n int, g int, offset int64) (Dictionary, map[int]*XrefEntry) {
+	xrefs := map[int]*XrefEntry{}
+
+	// prevent decrypting xref streams
+	parser.Xref[n] = NewXrefEntry(offset, g, XrefTypeIndirectObject)
+	parser.Xref[n].IsEncrypted = false
 
 	// Get the xref stream object
 	object := parser.GetObject(n)
 
+	// dont decrypt xref streams
+	xrefs[n] = NewXrefEntry(offset, g, XrefTypeIndirectObject)
+	xrefs[n].IsEncrypted = false
+
 	// get the stream dictionary which is also the trailer dictionary
 	trailer, ok := object.Value.(Dictionary)
 	if !ok {
-		return
-	}
-
-	// load previous xref section if it exists
-	if prev, ok := trailer.GetInt64("Prev"); ok {
-		parser.loadXref(prev, offsets)
-	}
-
-	// merge trailer
-	for key, value := range trailer {
-		parser.trailer[key] = value
+		return Dictionary{}, xrefs
 	}
 
 	// get the index and width arrays
@@ -303,27 +560,27 @@ func (parser *Parser) loadXrefStream(n int, offsets map[int64]interface{}) {
 		// if there is no Index field then use default of [0 Size]
 		size, ok := trailer.GetNumber("Size")
 		if !ok {
-			return
+			return trailer, xrefs
 		}
 		index = Array{Number(0), size}
 	}
 	width, ok := trailer.GetArray("W")
 	if !ok {
-		return
+		return trailer, xrefs
 	}
 
 	// get widths of each field
 	type_width, ok := width.GetInt(0)
 	if !ok {
-		return
+		return trailer, xrefs
 	}
 	offset_width, ok := width.GetInt(1)
 	if !ok {
-		return
+		return trailer, xrefs
 	}
 	generation_width, ok := width.GetInt(2)
 	if !ok {
-		return
+		return trailer, xrefs
 	}
 
 	// parse xref subsections
@@ -332,131 +589,144 @@ func (parser *Parser) loadXrefStream(n int, offsets map[int64]interface{}) {
 		// get subsection start and length
 		subsection_start, ok := index.GetInt(i)
 		if !ok {
-			return
+			return trailer, xrefs
 		}
 		subsection_length, ok := index.GetInt(i + 1)
 		if !ok {
-			return
+			return trailer, xrefs
 		}
 
 		// read in each entry in subsection
 		for j := 0; j < subsection_length; j++ {
 			xref_type, ok := ReadInt(data_reader, type_width)
 			if !ok {
-				return
+				return trailer, xrefs
 			}
-			offset, ok := ReadInt64(data_reader, offset_width)
+			entry_offset, ok := ReadInt64(data_reader, offset_width)
 			if !ok {
-				return
+				return trailer, xrefs
 			}
 			generation, ok := ReadInt(data_reader, generation_width)
 			if !ok {
-				return
+				return trailer, xrefs
 			}
 
-			// determine object number from subsection_start
+			// determine object number from subsection_start, the xref stream entry is kept
 			object_number := subsection_start + j
-
-			// add the object to the xrefs
-			parser.Xref[object_number] = NewXrefEntry(offset, generation, xref_type)
+			if object_number != n {
+				xrefs[object_number] = NewXrefEntry(entry_offset, generation, xref_type)
+			}
 		}
 	}
 
-	// dont decrypt xref streams
-	parser.Xref[object.Number] = NewXrefEntry(xref_stream_offset, object.Generation, XrefTypeIndirectObject)
-	parser.Xref[object.Number].IsEncrypted = false
+	return trailer, xrefs
 }
 
 func (parser *Parser) GetObject(number int) *IndirectObject {
 	object := NewIndirectObject(number)
 
+	// anomalies found while reading the object are reported at the object
+	previous_location := parser.location
+	defer func() {
+		parser.location = previous_location
+	}()
+
 	if xref_entry, ok := parser.Xref[number]; ok {
 		if xref_entry.Type == XrefTypeIndirectObject {
-			// set generation number
-			object.Generation = xref_entry.Generation
+			parser.location = parser.objectLocation(number)
+			parser.readIndirectObject(object, xref_entry)
+		} else if xref_entry.Type == XrefTypeCompressedObject {
+			// read the object from its object stream
+			object.Value = parser.readCompressedObject(xref_entry, number)
+		}
+	}
 
-			// seek to start of object
-			parser.Seek(xref_entry.Offset, io.SeekStart)
+	return object
+}
 
-			// skip object header
-			parser.ReadObjectHeader()
+// readIndirectObject reads the value and decoded stream of the object at the xref entry offset
+func (parser *Parser) readIndirectObject(object *IndirectObject, xref_entry *XrefEntry) {
+	// set generation number
+	object.Generation = xref_entry.Generation
 
-			// initialize string decryption filter
-			var string_filter CryptFilter = noFilter
-			if parser.security_handler != nil && xref_entry.IsEncrypted {
-				string_filter = parser.security_handler.string_filter
-			}
-			string_decryptor := string_filter.NewDecryptor(number, object.Generation)
+	// seek to start of object
+	parser.Seek(xref_entry.Offset, io.SeekStart)
 
-			// get the value of the object
-			object.Value, _ = parser.ReadObject(string_decryptor)
+	// skip object header
+	parser.ReadObjectHeader()
 
-			// get next keyword
-			if keyword := parser.ReadKeyword(); keyword == KEYWORD_STREAM {
-				// get stream dictionary
-				d, ok := object.Value.(Dictionary)
-				if !ok {
-					d = Dictionary{}
-				}
+	// initialize string decryption filter
+	var string_filter CryptFilter = noFilter
+	if parser.security_handler != nil && xref_entry.IsEncrypted {
+		string_filter = parser.security_handler.string_filter
+	}
+	string_decryptor := string_filter.NewDecryptor(object.Number, object.Generation)
 
-				// create list of decode filters
-				filter_list, ok := d.GetArray("Filter")
-				if !ok {
-					if filter, ok := d.GetName("Filter"); ok {
-						filter_list = Array{Name(filter)}
-					} else {
-						filter_list = Array{}
-					}
-				}
+	// get the value of the object
+	object.Value, _ = parser.ReadObject(string_decryptor)
 
-				// create list of decode parms
-				decode_parms_list, ok := d.GetArray("DecodeParms")
-				if !ok {
-					if decode_parms, ok := d.GetDictionary("DecodeParms"); ok {
-						decode_parms_list = Array{decode_parms}
-					} else {
-						decode_parms_list = Array{}
-					}
-				}
+	// get next keyword
+	if keyword := parser.ReadKeyword(); keyword == KEYWORD_STREAM {
+		// get stream dictionary
+		d, ok := object.Value.(Dictionary)
+		if !ok {
+			d = Dictionary{}
+		}
 
-				// create a stream decryptor
-				var crypt_filter CryptFilter = noFilter
-				if parser.security_handler != nil && xref_entry.IsEncrypted {
-					// use stream filter by default
-					crypt_filter = parser.security_handler.stream_filter
+		// create list of decode filters
+		filter_list, ok := d.GetArray("Filter")
+		if !ok {
+			if filter, ok := d.GetName("Filter"); ok {
+				filter_list = Array{Name(filter)}
+			} else {
+				filter_list = Array{}
+			}
+		}
 
-					// use embedded file filter if object is an embedded file
-					if t, ok := d.GetName("Type"); ok && t == "EmbeddedFile" {
-						crypt_filter = parser.security_handler.file_filter
-					}
+		// create list of decode parms
+		decode_parms_list, ok := d.GetArray("DecodeParms")
+		if !ok {
+			if decode_parms, ok := d.GetDictionary("DecodeParms"); ok {
+				decode_parms_list = Array{decode_parms}
+			} else {
+				decode_parms_list = Array{}
+			}
+		}
+
+		// create a stream decryptor
+		var crypt_filter CryptFilter = noFilter
+		if parser.security_handler != nil && xref_entry.IsEncrypted {
+			// use stream filter by default
+			crypt_filter = parser.security_handler.stream_filter
+
+			// use embedded file filter if object is an embedded file
+			if t, ok := d.GetName("Type"); ok && t == "EmbeddedFile" {
+				crypt_filter = parser.security_handler.file_filter
+			}
 
-					// handle crypt filter override
-					if len(filter_list) > 0 {
-						if filter, _ := filter_list.GetName(0); filter == "Crypt" {
-							decode_parms, _ := decode_parms_list.GetDictionary(0)
-							filter_name, ok := decode_parms.GetName("Name")
-							if !ok {
-								filter_name = "Identity"
-							}
-							if cf, exists := parser.security_handler.crypt_filters[filter_name]; exists {
-								crypt_filter = cf
-							}
-							filter_list = filter_list[1:]
-							if len(decode_parms_list) > 0 {
-								decode_parms_list = decode_parms_list[1:]
-							}
-						}
+			// handle crypt filter override
+			if len(filter_list) > 0 {
+				if filter, _ := filter_list.GetName(0); filter == "Crypt" {
+					decode_parms, _ := decode_parms_list.GetDictionary(0)
+					filter_name, ok := decode_parms.GetName("Name")
+					if !ok {
+						filter_name = "Identity"
+					}
+					if cf, exists := parser.security_handler.crypt_filters[filter_name]; exists {
+						crypt_filter = cf
+					}
+					filter_list = filter_list[1:]
+					if len(decode_parms_list) > 0 {
+						decode_parms_list = decode_parms_list[1:]
 					}
 				}
-				stream_decryptor := crypt_filter.NewDecryptor(number, xref_entry.Generation)
-
-				// read the stream
-				object.Stream = parser.ReadStream(stream_decryptor, filter_list, decode_parms_list)
 			}
 		}
-	}
+		stream_decryptor := crypt_filter.NewDecryptor(object.Number, xref_entry.Generation)
 
-	return object
+		// read the stream
+		object.Stream, object.Filters = parser.readStream(stream_decryptor, parser.streamLength(d), filter_list, decode_parms_list)
+	}
 }
 
 func (parser *Parser) Seek(offset int64, whence int) (int64, error) {
@@ -690,9 +960,7 @@ func (parser *Parser) ReadHexString(decryptor Decryptor) String {
 					val, _ := strconv.ParseUint(string(code), 16, 8)
 					s.WriteByte(byte(val))
 				}
-				s_data := []byte(s.String())
-				decryptor.Decrypt(s_data)
-				return String(s_data)
+				return String(decryptor.Decrypt([]byte(s.String())))
 			}
 			if !IsHex(b) {
 				parser.log_error(InvalidHexStringChar)
@@ -904,36 +1172,251 @@ func (parser *Parser) ReadNumber() Number {
 	return number
 }
 
-func (parser *Parser) ReadStream(decryptor Decryptor, filter_list Array, decode_parms_list Array) []byte {
-	// create buffers for stream data
-	stream_data := bytes.NewBuffer([]byte{})
+// ReadStream reads, decrypts and decodes the stream data after the stream keyword
+// length is the /Length of the stream or -1 if it is unknown, the data is scanned for the endstream marker if it does not follow length bytes
+func (parser *Parser) ReadStream(decryptor Decryptor, length int64, filter_list Array, decode_parms_list Array) []byte {
+	stream_data, _ := parser.readStream(decryptor, length, filter_list, decode_parms_list)
+	return stream_data
+}
 
+// readStream reads, decrypts and decodes the stream data after the stream keyword and returns the result of each filter
+func (parser *Parser) readStream(decryptor Decryptor, length int64, filter_list Array, decode_parms_list Array) ([]byte, []FilterResult) {
 	// read until new line
+	if !parser.skipStreamEOL() {
+		return []byte{}, nil
+	}
+	start := parser.CurrentOffset()
+
+	// read exactly length bytes if the endstream marker follows them
+	stream_data, ok := parser.readStreamData(start, length)
+	if !ok {
+		// otherwise scan for the endstream marker
+		parser.Seek(start, io.SeekStart)
+		stream_data = parser.scanStreamData()
+
+		// report at the first end of the stream if the lengths disagree
+		if length >= 0 && int64(len(stream_data)) != length {
+			end := parser.CurrentOffset()
+			if length < int64(len(stream_data)) {
+				parser.Seek(start + length, io.SeekStart)
+			} else {
+				parser.Seek(start + int64(len(stream_data)), io.SeekStart)
+			}
+			parser.log_error(StreamLengthMismatch.withDetail("declared %d, found %d", length, len(stream_data)))
+			parser.Seek(end, io.SeekStart)
+		}
+	}
+
+	// decrypt stream
+	stream_data_bytes := decryptor.Decrypt(stream_data)
+
+	// decode stream unless only the encoded data is needed
+	if parser.raw_streams {
+		return stream_data_bytes, nil
+	}
+	stream_data_bytes, results := parser.decodeFilters(start, stream_data_bytes, filter_list, decode_parms_list)
+
+	// return the decrypted and decoded stream
+	return stream_data_bytes, results
+}
+
+// decodeFilters applies each filter of a stream until one fails or is not decoded and reports unknown and abbreviated filter names
+// each filter stops at the decode limits of the parser, the decoded size of the stream at start counts once towards the size decoded from the document
+func (parser *Parser) decodeFilters(start int64, data []byte, filter_list Array, decode_parms_list Array) ([]byte, []FilterResult) {
+	results := make([]FilterResult, len(filter_list))
+	if len(filter_list) == 0 {
+		return data, results
+	}
+
+	// filters applied more than once are used to hide content and to build decompression bombs
+	counts := map[string]int{}
+	for i := range filter_list {
+		name, ok := filter_list.GetName(i)
+		if !ok {
+			continue
+		}
+		filter, _ := filterName(name)
+		counts[filter]++
+		if counts[filter] == 2 {
+			parser.log_error(RepeatedFilter.withDetail("%s", filter))
+		}
+	}
+
+	// get the maximum decoded size of the stream
+	encoded_size := int64(len(data))
+	document_size := parser.decoded_size - parser.decoded_streams[start]
+	max_size, limit := parser.DecodeLimits.maxSize(encoded_size, document_size)
+
+	stopped := false
+	for i := 0; i < len(filter_list); i++ {
+		name, ok := filter_list.GetName(i)
+		if !ok {
+			name = filter_list[i].String()
+		}
+		filter, known := filterName(name)
+		result := &results[i]
+		*result = FilterResult{name, filter, FilterSkipped, 0, ""}
+		if stopped {
+			continue
+		}
+
+		// unknown filters and filters that are not decoded leave the data encoded for the filters after them
+		if !known {
+			parser.log_error(UnknownFilter.withDetail("%s", name))
+			result.Status = FilterUnknown
+			stopped = true
+			continue
+		}
+		if filter != name {
+			parser.log_error(AbbreviatedFilter.withDetail("%s for %s", name, filter))
+		}
+		if _, ok := undecoded_filters[filter]; ok {
+			result.Status = FilterUndecoded
+			stopped = true
+			continue
+		}
+
+		// jbig2 segments are checked for anomalies while they are decoded
+		decode_parms, _ := decode_parms_list.GetDictionary(i)
+		decoded_data, offset, err := decodeFilter(filter, data, decode_parms, max_size, parser.log_error)
+		result.Offset = offset
+		if err == nil {
+			result.Status = FilterDecoded
+			data = decoded_data
+			continue
+		}
+
+		// a filter that reached a decode limit keeps the data decoded up to the limit
+		if err == DecodeLimitError {
+			parser.log_error(DecodeLimitExceeded.withDetail("%s %s limit, %d bytes decoded to %d bytes, ratio %.1f", filter, limit, encoded_size, len(decoded_data), float64(len(decoded_data)) / float64(encoded_size)))
+		}
+
+		// a filter that decoded part of the data is kept, otherwise decoding stops
+		// the filters after a decode limit are skipped since their input was cut short by the limit and not by the file
+		result.Error = err.Error()
+		if len(decoded_data) > 0 {
+			result.Status = FilterPartial
+			if err != DecodeLimitError {
+				parser.log_error(FilterDecodeError.withDetail("%s stopped at %d of %d, %s", filter, offset, len(data), err))
+			} else {
+				stopped = true
+			}
+			data = decoded_data
+		} else {
+			result.Status = FilterFailed
+			stopped = true
+			if err != DecodeLimitError {
+				parser.log_error(FilterDecodeError.withDetail("%s failed at %d of %d, %s", filter, offset, len(data), err))
+			}
+		}
+	}
+	parser.decoded_streams[start] = int64(len(data))
+	parser.decoded_size = document_size + int64(len(data))
+	return data, results
+}
+
+// skipStreamEOL reads until the end of line after the stream keyword, false if the end of the file is reached
+func (parser *Parser) skipStreamEOL() bool {
 	for {
 		b, err := parser.ReadByte()
 		if err != nil {
-			return stream_data.Bytes()
+			return false
 		}
 
 		// if new line then we are at the start of the stream data
 		if b == '\n' {
-			break
+			return true
 		}
 
 		// if carriage return check if next byte is line feed
 		if b == '\r' {
 			b, err := parser.ReadByte()
 			if err != nil {
-				return stream_data.Bytes()
+				return false
 			}
 			// if not new line then put it back cause it is part of the stream data
 			if b != '\n' {
 				parser.UnreadByte()
 			}
+			return true
+		}
+	}
+}
+
+// streamLength returns the /Length of a stream dictionary or -1 if it is missing
+// indirect lengths are read without reading the stream of the length object so a length that refers to its own stream does not loop
+func (parser *Parser) streamLength(d Dictionary) int64 {
+	value, ok := d["Length"]
+	if !ok {
+		return -1
+	}
+
+	// read the value of an indirect length
+	if reference, ok := value.(*Reference); ok {
+		xref_entry, ok := parser.Xref[reference.Number]
+		if !ok {
+			return -1
+		}
+		current_offset := parser.CurrentOffset()
+		if xref_entry.Type == XrefTypeIndirectObject {
+			parser.Seek(xref_entry.Offset, io.SeekStart)
+			if _, _, ok := parser.ReadObjectHeader(); ok {
+				value, _ = parser.ReadObject(noDecryptor)
+			}
+		} else if xref_entry.Type == XrefTypeCompressedObject {
+			// an object stream is not loaded again while it is loading so a length in its own object stream is not found
+			value = parser.readCompressedObject(xref_entry, reference.Number)
+		}
+		parser.Seek(current_offset, io.SeekStart)
+	}
+
+	if length, ok := value.(Number); ok && length >= 0 {
+		return int64(length)
+	}
+	return -1
+}
+
+// readStreamData reads length bytes of stream data at start if the endstream marker follows them
+func (parser *Parser) readStreamData(start int64, length int64) ([]byte, bool) {
+	if length < 0 {
+		return nil, false
+	}
+
+	// skip the end of line before the endstream marker
+	parser.Seek(start + length, io.SeekStart)
+	for {
+		b, err := parser.ReadByte()
+		if err != nil {
+			return nil, false
+		}
+		if bytes.IndexByte(whitespace, b) < 0 {
+			parser.UnreadByte()
 			break
 		}
 	}
 
+	// check for the endstream marker
+	marker := make([]byte, 9)
+	if _, err := io.ReadFull(parser, marker); err != nil || string(marker) != "endstream" {
+		return nil, false
+	}
+	end := parser.CurrentOffset()
+
+	// read the stream data and return to the end of the stream
+	stream_data := make([]byte, length)
+	parser.Seek(start, io.SeekStart)
+	if _, err := io.ReadFull(parser, stream_data); err != nil {
+		return nil, false
+	}
+	parser.Seek(end, io.SeekStart)
+	return stream_data, true
+}
+
+// scanStreamData reads stream data until the endstream marker
+func (parser *Parser) scanStreamData() []byte {
+	// create buffers for stream data
+	stream_data := bytes.NewBuffer([]byte{})
+
 	// read first 9 bytes to get started
 	end_buff := bytes.NewBuffer([]byte{})
 	buff := make([]byte, 9)
@@ -976,19 +1459,8 @@ func (parser *Parser) ReadStream(decryptor Decryptor, filter_list Array, decode_
 		end_buff.WriteByte(b)
 	}
 
-	// decrypt stream
-	stream_data_bytes := stream_data.Bytes()
-	decryptor.Decrypt(stream_data_bytes)
-
-	// decode stream
-	for i := 0; i < len(filter_list); i++ {
-		filter, _ := filter_list.GetName(i)
-		decode_parms, _ := decode_parms_list.GetDictionary(i)
-		stream_data_bytes = DecodeStream(filter, stream_data_bytes, decode_parms)
-	}
 
-	// return the decrypted and decoded stream
-	return stream_data_bytes
+	return stream_data.Bytes()
 }
 
 func (parser *Parser) ReadString(decryptor Decryptor) String {
@@ -1013,9 +1485,7 @@ func (parser *Parser) ReadString(decryptor Decryptor) String {
 		b, err = parser.ReadByte()
 		if err != nil {
 			parser.log_error(UnclosedString)
-			s_data := []byte(s.String())
-			decryptor.Decrypt(s_data)
-			return String(s_data)
+			return String(decryptor.Decrypt([]byte(s.String())))
 		}
 
 		// if this is the start of an escape sequence
@@ -1025,9 +1495,7 @@ func (parser *Parser) ReadString(decryptor Decryptor) String {
 			if err != nil {
 				parser.log_error(UnclosedStringEscape)
 				s.WriteByte('\\')
-				s_data := []byte(s.String())
-				decryptor.Decrypt(s_data)
-				return String(s_data)
+				return String(decryptor.Decrypt([]byte(s.String())))
 			}
 
 			// ignore escaped line breaks \n or \r or \r\n
@@ -1039,9 +1507,7 @@ func (parser *Parser) ReadString(decryptor Decryptor) String {
 				b, err = parser.ReadByte()
 				if err != nil {
 					parser.log_error(UnclosedStringEscape)
-					s_data := []byte(s.String())
-					decryptor.Decrypt(s_data)
-					return String(s_data)
+					return String(decryptor.Decrypt([]byte(s.String())))
 				}
 				// if byte is not a new line then unread it
 				if b != '\n' {
@@ -1126,9 +1592,7 @@ func (parser *Parser) ReadString(decryptor Decryptor) String {
 	}
 
 	// return string
-	s_data := []byte(s.String())
-	decryptor.Decrypt(s_data)
-	return String(s_data)
+	return String(decryptor.Decrypt([]byte(s.String())))
 }
 
 // consumeWhitespace reads until end of whitespace/comments
@@ -1178,8 +1642,14 @@ func (parser *Parser) consumeComment() {
 	}
 }
 
-func (parser *Parser) log_error(message string) {
-	if parser.output != nil {
-		parser.output.Error(message)
+func (parser *Parser) log_error(anomaly_type AnomalyType) {
+	if parser.sink != nil {
+		// offsets in object streams are not file offsets so the offset of the object stream is kept
+		offset := parser.CurrentOffset()
+		location := parser.location
+		if location.ObjectStream == 0 {
+			location.Offset = offset
+		}
+		parser.sink.WriteAnomaly(NewAnomaly(anomaly_type, location, parser.anomalyContext(offset)))
 	}
 }
@@ -1,11 +1,38 @@
 package pdf
 
 import (
-	"fmt"
+	"crypto/rsa"
+	"crypto/x509"
+	"io"
 	"os"
+	"sort"
 )
 
 func Parse(file_path string, password string, output_dir string) error {
+	return ParseWithCertificate(file_path, password, nil, nil, output_dir)
+}
+
+// ParseWithCertificate parses a pdf that may be encrypted for the recipient of the certificate
+func ParseWithCertificate(file_path string, password string, certificate *x509.Certificate, private_key *rsa.PrivateKey, output_dir string) error {
+	return parse(file_path, password, output_dir, func(security_handler *SecurityHandler) {
+		security_handler.SetCertificate(certificate, private_key)
+	})
+}
+
+// ParseWithEncryptionKey parses a pdf that is decrypted with a known file encryption key instead of a password
+func ParseWithEncryptionKey(file_path string, encryption_key []byte, output_dir string) error {
+	return parse(file_path, "", output_dir, func(security_handler *SecurityHandler) {
+		security_handler.SetEncryptionKey(encryption_key)
+	})
+}
+
+// ParseReader parses the pdf read from reader and writes everything found to sink, the sink is not closed
+func ParseReader(reader io.ReadSeeker, password string, sink Sink) error {
+	return NewParser(reader, sink).Extract(password)
+}
+
+// parse extracts the contents of a pdf to the output directory after configuring the security handler
+func parse(file_path string, password string, output_dir string, configure func(*SecurityHandler)) error {
 	// open the pdf
 	file, err := os.Open(file_path)
 	if err != nil {
@@ -14,28 +41,92 @@ func Parse(file_path string, password string, output_dir string) error {
 	defer file.Close()
 
 	// create output directory and files
-	output, err := NewOutput(output_dir)
-	defer output.Close()
+	os.RemoveAll(output_dir)
+	sink, err := NewDirectorySink(output_dir)
+	defer sink.Close()
 	if err != nil {
 		return err
 	}
 
 	// create a new parser
-	parser := NewParser(file, output)
+	parser := NewParser(file, sink)
+	configure(parser.SecurityHandler())
+	return parser.Extract(password)
+}
+
+// Extract loads the pdf and writes everything found to the sink of the parser
+func (parser *Parser) Extract(password string) error {
+	if parser.sink == nil {
+		return MissingSinkError
+	}
+
+	// hash the pdf, files have their path in the summary
+	summary, err := NewFileSummary("", parser.seeker)
+	if err != nil {
+		return err
+	}
+	if file, ok := parser.seeker.(*os.File); ok {
+		summary.Path = file.Name()
+	}
+	parser.sink.WriteFileSummary(summary)
 
 	// load the pdf
 	Debug("Loading xref")
-	if err := parser.Load(password); err != nil {
+	err = parser.Load(password)
+
+	// describe the encryption even if the pdf could not be decrypted
+	if parser.EncryptionInfo != nil {
+		parser.sink.WriteEncryption(parser.EncryptionInfo)
+	}
+	if err != nil {
 		return err
 	}
 
-	// extract and dump all objects
-	for object_number, xref_entry := range parser.Xref {
-		if xref_entry.Type == XrefTypeIndirectObject {
+	// log the password that authenticated and the recovered user password
+	if security_handler := parser.SecurityHandler(); security_handler.PasswordType != "" {
+		parser.sink.WritePassword(security_handler.PasswordType, password)
+		if security_handler.PasswordType == PasswordTypeOwner && security_handler.UserPasswordKnown {
+			parser.sink.WritePassword(PasswordTypeUser, string(security_handler.UserPassword))
+		}
+	}
+
+	// describe the header and end of file markers
+	parser.sink.WriteFileInfo(parser.checkFileInfo())
+
+	// report objects that resolve differently using only the startxref chain
+	parser.logXrefDifferences(password)
+
+	// report data that does not belong to any object
+	coverage := parser.Coverage()
+	for _, region := range coverage.Uncovered {
+		data := parser.ReadRange(region.Offset, region.Size)
+		parser.sink.WriteUncovered(region, data)
+		parser.logErrorAt(region.Offset, UncoveredData.withDetail("%d bytes, entropy %.2f", region.Size, region.Entropy))
+	}
+
+	// report other file formats the pdf is or contains
+	for _, format := range parser.detectFormats(coverage.Uncovered) {
+		parser.sink.WriteFormat(format)
+		parser.logErrorAt(format.Offset, PolyglotFormat.withDetail("%s in %s", format.Format, format.Region))
+	}
+
+	// get the key path from the trailer to each object
+	paths := parser.ObjectPaths()
+
+	// extract and dump all objects in order
+	object_numbers := []int{}
+	for object_number := range parser.Xref {
+		object_numbers = append(object_numbers, object_number)
+	}
+	sort.Ints(object_numbers)
+	for _, object_number := range object_numbers {
+		if xref_entry := parser.Xref[object_number]; xref_entry.Type == XrefTypeIndirectObject || xref_entry.Type == XrefTypeCompressedObject {
 			Debug("Extracting object %d", object_number)
 			object := parser.GetObject(object_number)
-			object.Extract(output)
-			fmt.Fprintln(output.Raw, object.String())
+			location := parser.objectLocation(object_number)
+			location.Path = paths[object_number]
+			object.Extract(parser.sink, location)
+			parser.sink.WriteObject(object)
 		}
 	}
 
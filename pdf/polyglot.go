@@ -0,0 +1,211 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// number of bytes at the end of the file searched for a zip end of central directory record, the largest comment plus the record
+var polyglot_tail_size int64 = 65557
+
+// largest central directory read to check if a zip is a jar
+var max_central_directory_size int64 = 1048576
+
+// formats that can be found in the raw pdf
+const (
+	FormatHTML = "html"
+	FormatJAR = "jar"
+	FormatJPEG = "jpeg"
+	FormatOLE = "ole"
+	FormatPE = "pe"
+	FormatPNG = "png"
+	FormatScript = "script"
+	FormatZIP = "zip"
+)
+
+// regions of the raw pdf that are searched for other formats
+const (
+	RegionStart = "start"
+	RegionEnd = "end"
+	RegionUncovered = "uncovered"
+)
+
+// EmbeddedFormat is the signature of another file format found in the raw pdf
+// region is where it was found: before the header, at the end of the file or in a region that does not belong to any object
+type EmbeddedFormat struct {
+	Format string `json:"format"`
+	Offset int64 `json:"offset"`
+	Region string `json:"region"`
+}
+
+// formatSignature is the magic bytes of a format, html signatures are matched case insensitively
+type formatSignature struct {
+	format string
+	magic []byte
+}
+
+var format_signatures = []formatSignature{
+	formatSignature{FormatZIP, []byte("PK\x03\x04")},
+	formatSignature{FormatJPEG, []byte("\xff\xd8\xff")},
+	formatSignature{FormatPNG, []byte("\x89PNG\r\n\x1a\n")},
+	formatSignature{FormatOLE, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")},
+	formatSignature{FormatHTML, []byte("<!doctype html")},
+	formatSignature{FormatHTML, []byte("<html")},
+	formatSignature{FormatHTML, []byte("<body")},
+	formatSignature{FormatHTML, []byte("<iframe")},
+	formatSignature{FormatScript, []byte("<script")},
+}
+
+// DetectFormats searches the start and end of the file and the regions that do not belong to any object for other file formats
+// Load must be called first so the uncovered regions are known
+func (parser *Parser) DetectFormats() []EmbeddedFormat {
+	return parser.detectFormats(parser.Coverage().Uncovered)
+}
+
+// detectFormats searches the start and end of the file and each uncovered region for other file formats in order of offset
+func (parser *Parser) detectFormats(uncovered []UncoveredRegion) []EmbeddedFormat {
+	formats := []EmbeddedFormat{}
+	found := map[EmbeddedFormat]interface{}{}
+	add := func(format string, offset int64, region string) {
+		// a format found in more than one region is only reported in the first
+		key := EmbeddedFormat{format, offset, ""}
+		if _, ok := found[key]; !ok {
+			found[key] = nil
+			formats = append(formats, EmbeddedFormat{format, offset, region})
+		}
+	}
+
+	// search the start of the file up to the header
+	start_size := header_scan_buffer_size
+	if offset, _, ok := parser.findHeader(); ok {
+		start_size = offset
+	}
+	for _, format := range parser.scanFormats(0, parser.ReadRange(0, start_size)) {
+		add(format.Format, format.Offset, RegionStart)
+	}
+
+	// search each uncovered region
+	for _, region := range uncovered {
+		for _, format := range parser.scanFormats(region.Offset, parser.ReadRange(region.Offset, region.Size)) {
+			add(format.Format, format.Offset, RegionUncovered)
+		}
+	}
+
+	// zip readers look for the end of central directory record at the end of the file
+	if offset, format, ok := parser.findEndOfCentralDirectory(); ok {
+		add(format, offset, RegionEnd)
+	}
+
+	sort.SliceStable(formats, func(i, j int) bool { return formats[i].Offset < formats[j].Offset })
+	return formats
+}
+
+// scanFormats returns the signatures found in data that starts at offset
+func (parser *Parser) scanFormats(offset int64, data []byte) []EmbeddedFormat {
+	formats := []EmbeddedFormat{}
+	lower_data := asciiLower(data)
+
+	// find every signature
+	for _, signature := range format_signatures {
+		search_data := data
+		if signature.format == FormatHTML || signature.format == FormatScript {
+			search_data = lower_data
+		}
+		for i := 0; i < len(search_data); {
+			index := bytes.Index(search_data[i:], signature.magic)
+			if index < 0 {
+				break
+			}
+			format := signature.format
+			if format == FormatZIP && isJarEntry(data[i + index:]) {
+				format = FormatJAR
+			}
+			formats = append(formats, EmbeddedFormat{format, offset + int64(i + index), ""})
+			i += index + len(signature.magic)
+		}
+	}
+
+	// find dos headers that point to a pe header
+	for i := 0; i < len(data); {
+		index := bytes.Index(data[i:], []byte("MZ"))
+		if index < 0 {
+			break
+		}
+		if parser.isPEAt(offset + int64(i + index)) {
+			formats = append(formats, EmbeddedFormat{FormatPE, offset + int64(i + index), ""})
+		}
+		i += index + 2
+	}
+
+	return formats
+}
+
+// asciiLower returns a copy of data with ascii letters in lower case, other bytes are unchanged so offsets are kept
+func asciiLower(data []byte) []byte {
+	lower_data := make([]byte, len(data))
+	for i, b := range data {
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		lower_data[i] = b
+	}
+	return lower_data
+}
+
+// isPEAt returns true if there is a dos header at offset that points to a pe header
+func (parser *Parser) isPEAt(offset int64) bool {
+	dos_header := parser.ReadRange(offset, 64)
+	if len(dos_header) < 64 {
+		return false
+	}
+	pe_offset := int64(binary.LittleEndian.Uint32(dos_header[60:]))
+	return pe_offset >= 64 && pe_offset < 65536 && bytes.Equal(parser.ReadRange(offset + pe_offset, 4), []byte("PE\x00\x00"))
+}
+
+// isJarEntry returns true if data starts with a zip local file header of a file in META-INF
+func isJarEntry(data []byte) bool {
+	if len(data) < 30 {
+		return false
+	}
+	name_size := int(binary.LittleEndian.Uint16(data[26:]))
+	return name_size <= len(data) - 30 && bytes.HasPrefix(data[30:30 + name_size], []byte("META-INF/"))
+}
+
+// findEndOfCentralDirectory returns the offset of the last zip end of central directory record whose comment ends within the file
+// the format is jar if the central directory has a file in META-INF
+func (parser *Parser) findEndOfCentralDirectory() (int64, string, bool) {
+	size, _ := parser.Seek(0, io.SeekEnd)
+	start := size - polyglot_tail_size
+	if start < 0 {
+		start = 0
+	}
+	data := parser.ReadRange(start, size - start)
+
+	for end := len(data); end > 0; {
+		index := bytes.LastIndex(data[:end], []byte("PK\x05\x06"))
+		if index < 0 {
+			break
+		}
+		end = index
+
+		// the record and its comment must fit in the file
+		record := data[index:]
+		if len(record) < 22 || 22 + int(binary.LittleEndian.Uint16(record[20:])) > len(record) {
+			continue
+		}
+
+		// the central directory is just before the record, its recorded offset is wrong if data is prepended to the zip
+		offset := start + int64(index)
+		central_directory_size := int64(binary.LittleEndian.Uint32(record[12:]))
+		if central_directory_size <= offset && central_directory_size <= max_central_directory_size {
+			if bytes.Contains(parser.ReadRange(offset - central_directory_size, central_directory_size), []byte("META-INF/")) {
+				return offset, FormatJAR, true
+			}
+		}
+		return offset, FormatZIP, true
+	}
+
+	return 0, "", false
+}
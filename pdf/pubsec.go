@@ -0,0 +1,378 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+	"io/ioutil"
+	"math/big"
+)
+
+var oid_enveloped_data = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+var oid_rsa_encryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+var oid_rsa_oaep = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+var oid_des_cbc = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}
+var oid_des_ede3_cbc = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+var oid_aes_128_cbc = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+var oid_aes_192_cbc = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+var oid_aes_256_cbc = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+
+// pkcs#7 (cms) structures needed to decrypt the seed of a recipient
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type envelopedData struct {
+	Version int
+	OriginatorInfo asn1.RawValue `asn1:"optional,tag:0"`
+	RecipientInfos []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type keyTransRecipientInfo struct {
+	Version int
+	RecipientIdentifier asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type encryptedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// ReadCertificate reads a PEM or DER encoded X.509 certificate from a file
+func ReadCertificate(file_path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file_path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// ReadPrivateKey reads a PEM or DER encoded PKCS#1 or PKCS#8 RSA private key from a file
+func ReadPrivateKey(file_path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file_path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	rsa_key, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, EncryptionUnsupported
+	}
+	return rsa_key, nil
+}
+
+// initPublicKey sets up the crypt filters of the public-key security handler (Adobe.PubSec)
+func (sh *SecurityHandler) initPublicKey(encrypt Dictionary) error {
+	// a certificate and private key are needed to decrypt the seed
+	if sh.certificate == nil || sh.private_key == nil {
+		return EncryptionCertificateError
+	}
+
+	// get V
+	sh.v, _ = encrypt.GetInt("V")
+	if sh.v != 1 && sh.v != 2 && sh.v != 4 && sh.v != 5 {
+		return EncryptionUnsupported
+	}
+
+	// get Length
+	sh.length = 5
+	if length, ok := encrypt.GetInt("Length"); ok && sh.v > 1 {
+		sh.length = length/8
+	}
+	if sh.length < 5 {
+		sh.length = 5
+	} else if sh.length > 16 {
+		sh.length = 16
+	}
+
+	// get EncryptMetadata
+	encrypt_meta_data, ok := encrypt.GetBool("EncryptMetadata")
+	if !ok {
+		encrypt_meta_data = true
+	}
+	sh.encrypt_meta_data = encrypt_meta_data
+
+	// reset crypt filters
+	sh.crypt_filters = map[string]CryptFilter{}
+	sh.crypt_filters["Identity"] = noFilter
+
+	sub_filter, _ := encrypt.GetName("SubFilter")
+	if sub_filter == "adbe.pkcs7.s3" || sub_filter == "adbe.pkcs7.s4" {
+		// recipients are in the encryption dictionary and all data uses rc4
+		recipients, _ := encrypt.GetArray("Recipients")
+		key, ok := sh.computePublicKeyEncryptionKey(recipients, encrypt_meta_data, sha1.New(), sh.length)
+		if !ok {
+			return EncryptionRecipientError
+		}
+		sh.encryption_key = key
+		sh.stream_filter = &CryptFilterRC4{key}
+		sh.string_filter = sh.stream_filter
+		sh.file_filter = sh.stream_filter
+	} else if sub_filter == "adbe.pkcs7.s5" {
+		// recipients are in each crypt filter dictionary
+		cf, _ := encrypt.GetDictionary("CF")
+		for k, entry := range cf {
+			cfd, isDictionary := entry.(Dictionary)
+			if !isDictionary {
+				continue
+			}
+			method, _ := cfd.GetName("CFM")
+			if method == "None" {
+				sh.crypt_filters[k] = noFilter
+				continue
+			}
+
+			// get recipients which can be a single string or an array
+			recipients, ok := cfd.GetArray("Recipients")
+			if !ok {
+				if recipient, ok := cfd.GetString("Recipients"); ok {
+					recipients = Array{String(recipient)}
+				}
+			}
+
+			// get crypt filter EncryptMetadata
+			filter_encrypt_meta_data, ok := cfd.GetBool("EncryptMetadata")
+			if !ok {
+				filter_encrypt_meta_data = true
+			}
+
+			// get optional length which may be in bits or bytes
+			length, ok := cfd.GetInt("Length")
+			if !ok {
+				length = sh.length
+			} else if length > 32 {
+				length = length/8
+			}
+
+			// create filter entry
+			if method == "V2" {
+				if key, ok := sh.computePublicKeyEncryptionKey(recipients, filter_encrypt_meta_data, sha1.New(), length); ok {
+					sh.encryption_key = key
+					sh.crypt_filters[k] = &CryptFilterRC4{key}
+				}
+			} else if method == "AESV2" {
+				if key, ok := sh.computePublicKeyEncryptionKey(recipients, filter_encrypt_meta_data, sha1.New(), 16); ok {
+					sh.encryption_key = key
+					sh.crypt_filters[k] = &CryptFilterAES{key}
+				}
+			} else if method == "AESV3" {
+				if key, ok := sh.computePublicKeyEncryptionKey(recipients, filter_encrypt_meta_data, sha256.New(), 32); ok {
+					sh.encryption_key = key
+					sh.crypt_filters[k] = &CryptFilterAESV3{key}
+				}
+			}
+		}
+
+		// the certificate must be a recipient of at least one crypt filter
+		if sh.encryption_key == nil {
+			return EncryptionRecipientError
+		}
+
+		// assign default filters which are identity when missing
+		sh.stream_filter = noFilter
+		sh.string_filter = noFilter
+		if name, ok := encrypt.GetName("StmF"); ok {
+			if filter, exists := sh.crypt_filters[name]; exists {
+				sh.stream_filter = filter
+			}
+		}
+		if name, ok := encrypt.GetName("StrF"); ok {
+			if filter, exists := sh.crypt_filters[name]; exists {
+				sh.string_filter = filter
+			}
+		}
+		sh.file_filter = sh.stream_filter
+		if name, ok := encrypt.GetName("EEF"); ok {
+			if filter, exists := sh.crypt_filters[name]; exists {
+				sh.file_filter = filter
+			}
+		}
+	} else {
+		return EncryptionUnsupported
+	}
+
+	return nil
+}
+
+// computePublicKeyEncryptionKey hashes the seed, recipients and metadata flag to produce the file encryption key
+func (sh *SecurityHandler) computePublicKeyEncryptionKey(recipients Array, encrypt_meta_data bool, digest hash.Hash, key_length int) ([]byte, bool) {
+	// find the seed in the recipient envelope that matches the certificate
+	var seed []byte
+	for i := range recipients {
+		if recipient, ok := recipients.GetBytes(i); ok {
+			if seed, ok = sh.decryptRecipient(recipient); ok {
+				break
+			}
+		}
+	}
+	if len(seed) < 20 {
+		return nil, false
+	}
+
+	// the last 4 bytes of the envelope are the permissions
+	if len(seed) >= 24 {
+		sh.p = seed[20:24]
+	}
+
+	// hash seed, all recipients and the metadata flag
+	digest.Write(seed[:20])
+	for i := range recipients {
+		recipient, _ := recipients.GetBytes(i)
+		digest.Write(recipient)
+	}
+	if !encrypt_meta_data {
+		digest.Write([]byte("\xff\xff\xff\xff"))
+	}
+	key := digest.Sum(nil)
+	if key_length < len(key) {
+		key = key[:key_length]
+	}
+	return key, true
+}
+
+// decryptRecipient decrypts the content of a pkcs#7 enveloped data recipient with the private key
+func (sh *SecurityHandler) decryptRecipient(recipient []byte) ([]byte, bool) {
+	// parse the content info
+	var content_info contentInfo
+	if _, err := asn1.Unmarshal(recipient, &content_info); err != nil || !content_info.ContentType.Equal(oid_enveloped_data) {
+		return nil, false
+	}
+
+	// parse the enveloped data
+	var enveloped_data envelopedData
+	if _, err := asn1.Unmarshal(content_info.Content.Bytes, &enveloped_data); err != nil {
+		return nil, false
+	}
+
+	// find the recipient info that matches the certificate
+	for _, raw_recipient_info := range enveloped_data.RecipientInfos {
+		var recipient_info keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(raw_recipient_info.FullBytes, &recipient_info); err != nil {
+			continue
+		}
+		if !sh.matchesCertificate(recipient_info.RecipientIdentifier) {
+			continue
+		}
+
+		// decrypt the content encryption key
+		var content_key []byte
+		var err error
+		algorithm := recipient_info.KeyEncryptionAlgorithm.Algorithm
+		if algorithm.Equal(oid_rsa_encryption) {
+			content_key, err = rsa.DecryptPKCS1v15(nil, sh.private_key, recipient_info.EncryptedKey)
+		} else if algorithm.Equal(oid_rsa_oaep) {
+			content_key, err = rsa.DecryptOAEP(sha1.New(), nil, sh.private_key, recipient_info.EncryptedKey, nil)
+		} else {
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// decrypt the content
+		if content, ok := decryptContent(enveloped_data.EncryptedContentInfo, content_key); ok {
+			return content, true
+		}
+	}
+
+	return nil, false
+}
+
+// matchesCertificate returns true if the recipient identifier identifies the certificate
+func (sh *SecurityHandler) matchesCertificate(recipient_identifier asn1.RawValue) bool {
+	// subject key identifier
+	if recipient_identifier.Class == asn1.ClassContextSpecific && recipient_identifier.Tag == 0 {
+		return bytes.Equal(recipient_identifier.Bytes, sh.certificate.SubjectKeyId)
+	}
+
+	// issuer and serial number
+	var issuer_and_serial_number issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(recipient_identifier.FullBytes, &issuer_and_serial_number); err != nil {
+		return false
+	}
+	return bytes.Equal(issuer_and_serial_number.Issuer.FullBytes, sh.certificate.RawIssuer) &&
+		issuer_and_serial_number.SerialNumber.Cmp(sh.certificate.SerialNumber) == 0
+}
+
+// decryptContent decrypts pkcs#7 encrypted content with a cbc block cipher and removes the padding
+func decryptContent(encrypted_content_info encryptedContentInfo, key []byte) ([]byte, bool) {
+	// the content octet string may be split into multiple octet strings
+	content := encrypted_content_info.EncryptedContent.Bytes
+	if encrypted_content_info.EncryptedContent.IsCompound {
+		var joined []byte
+		for rest := content; len(rest) > 0; {
+			var part []byte
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &part); err != nil {
+				return nil, false
+			}
+			joined = append(joined, part...)
+		}
+		content = joined
+	}
+
+	// get iv from the algorithm parameters
+	var iv []byte
+	if _, err := asn1.Unmarshal(encrypted_content_info.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, false
+	}
+
+	// create block cipher
+	var block cipher.Block
+	var err error
+	algorithm := encrypted_content_info.ContentEncryptionAlgorithm.Algorithm
+	if algorithm.Equal(oid_des_cbc) {
+		block, err = des.NewCipher(key)
+	} else if algorithm.Equal(oid_des_ede3_cbc) {
+		block, err = des.NewTripleDESCipher(key)
+	} else if algorithm.Equal(oid_aes_128_cbc) || algorithm.Equal(oid_aes_192_cbc) || algorithm.Equal(oid_aes_256_cbc) {
+		block, err = aes.NewCipher(key)
+	} else {
+		return nil, false
+	}
+	if err != nil || len(iv) != block.BlockSize() || len(content) == 0 || len(content) % block.BlockSize() != 0 {
+		return nil, false
+	}
+
+	// decrypt content
+	data := make([]byte, len(content))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, content)
+
+	// remove padding
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > block.BlockSize() || padding > len(data) {
+		return nil, false
+	}
+	return data[:len(data) - padding], true
+}
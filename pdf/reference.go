@@ -65,3 +65,18 @@ func (reference *Reference) resolve(resolved_references map[int]interface{}) *In
 	// return the object
 	return object
 }
+
+// bindReferences makes all references in o resolve through parser
+func bindReferences(o Object, parser *Parser) {
+	if reference, ok := o.(*Reference); ok {
+		reference.parser = parser
+	} else if d, ok := o.(Dictionary); ok {
+		for key := range d {
+			bindReferences(d[key], parser)
+		}
+	} else if a, ok := o.(Array); ok {
+		for i := range a {
+			bindReferences(a[i], parser)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package pdf
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ReportVersion is the version of the report schema, it is incremented when fields are renamed, removed or change meaning
+const ReportVersion = 2
+
+// Report is the structured form of everything Parse finds
+type Report struct {
+	Version int `json:"version"`
+	File FileSummary `json:"file"`
+	Info *FileInfo `json:"info,omitempty"`
+	Encryption *EncryptionInfo `json:"encryption,omitempty"`
+	Passwords []PasswordRecord `json:"passwords"`
+	URLs []URLRecord `json:"urls"`
+	Commands []CommandRecord `json:"commands"`
+	Files []FileRecord `json:"files"`
+	Scripts []ScriptRecord `json:"scripts"`
+	Uncovered []UncoveredRegion `json:"uncovered"`
+	Formats []EmbeddedFormat `json:"formats"`
+	Anomalies []Anomaly `json:"anomalies"`
+	anomaly_indexes map[string]int
+}
+
+// FileSummary identifies the parsed pdf
+type FileSummary struct {
+	Path string `json:"path"`
+	Size int64 `json:"size"`
+	MD5 string `json:"md5"`
+	SHA256 string `json:"sha256"`
+}
+
+// Location is where a finding came from
+// object is 0 if the finding is not in an object, object_stream is set if the object is stored in an object stream
+// offset is the file offset of the anomaly or of the object (or object stream) holding the finding
+// path is the chain of keys (and array indexes) from the trailer to the finding, e.g. Root, OpenAction, JS
+type Location struct {
+	Object int `json:"object"`
+	Generation int `json:"generation"`
+	ObjectStream int `json:"object_stream,omitempty"`
+	Offset int64 `json:"offset"`
+	Path []string `json:"path"`
+}
+
+type PasswordRecord struct {
+	Type string `json:"type"`
+	Password string `json:"password"`
+}
+
+type URLRecord struct {
+	URL string `json:"url"`
+	Location
+}
+
+type CommandRecord struct {
+	Command string `json:"command"`
+	Location
+}
+
+// FileRecord is a referenced or embedded file, md5 is all zeros and extracted is false if the file data is not in the pdf
+type FileRecord struct {
+	Name string `json:"name"`
+	MD5 string `json:"md5"`
+	Size int `json:"size"`
+	Extracted bool `json:"extracted"`
+	Location
+}
+
+type ScriptRecord struct {
+	Script string `json:"script"`
+	Location
+}
+
+func NewReport() *Report {
+	return &Report{ReportVersion, FileSummary{}, nil, nil, []PasswordRecord{}, []URLRecord{}, []CommandRecord{}, []FileRecord{}, []ScriptRecord{}, []UncoveredRegion{}, []EmbeddedFormat{}, []Anomaly{}, map[string]int{}}
+}
+
+// NewFileSummary hashes the pdf file and returns to the start of the file
+func NewFileSummary(file_path string, file io.ReadSeeker) (FileSummary, error) {
+	md5_hash := md5.New()
+	sha256_hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5_hash, sha256_hash), file)
+	if err != nil {
+		return FileSummary{}, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return FileSummary{}, err
+	}
+	return FileSummary{file_path, size, hex.EncodeToString(md5_hash.Sum(nil)), hex.EncodeToString(sha256_hash.Sum(nil))}, nil
+}
+
+// copy returns a copy of the location that does not share the path
+func (location Location) copy() Location {
+	location.Path = append([]string{}, location.Path...)
+	return location
+}
+
+// child returns the location of the value of key
+func (location Location) child(key string) Location {
+	location.Path = append(append([]string{}, location.Path...), key)
+	return location
+}
+
+func (report *Report) addPassword(password_type string, password string) {
+	report.Passwords = append(report.Passwords, PasswordRecord{password_type, password})
+}
+
+func (report *Report) addURL(url string, location Location) {
+	report.URLs = append(report.URLs, URLRecord{url, location.copy()})
+}
+
+func (report *Report) addCommand(command string, location Location) {
+	report.Commands = append(report.Commands, CommandRecord{command, location.copy()})
+}
+
+func (report *Report) addFile(name string, md5sum string, size int, extracted bool, location Location) {
+	report.Files = append(report.Files, FileRecord{name, md5sum, size, extracted, location.copy()})
+}
+
+func (report *Report) addScript(script string, location Location) {
+	report.Scripts = append(report.Scripts, ScriptRecord{script, location.copy()})
+}
+
+// addAnomaly adds the anomaly or counts it if it was already found at the same location with the same details
+func (report *Report) addAnomaly(anomaly Anomaly) {
+	key := anomaly.key()
+	if i, ok := report.anomaly_indexes[key]; ok {
+		report.Anomalies[i].Count += anomaly.Count
+		return
+	}
+	report.anomaly_indexes[key] = len(report.Anomalies)
+	report.Anomalies = append(report.Anomalies, anomaly)
+}
+
+// ObjectPaths returns the shortest key path from the trailer to each object that can be reached from it
+func (parser *Parser) ObjectPaths() map[int][]string {
+	paths := map[int][]string{}
+	queue := []int{}
+
+	// objects are read again when extracted so anomalies are not logged here
+	sink := parser.sink
+	parser.sink = nil
+	defer func() {
+		parser.sink = sink
+	}()
+
+	// add the objects referenced by the trailer
+	parser.walkPaths(parser.trailer, []string{}, paths, &queue)
+
+	// add the objects referenced by each object breadth first
+	for len(queue) > 0 {
+		number := queue[0]
+		queue = queue[1:]
+		parser.walkPaths(parser.GetObject(number).Value, paths[number], paths, &queue)
+	}
+
+	return paths
+}
+
+// walkPaths records the path to each object referenced by o that does not have a path yet
+func (parser *Parser) walkPaths(o Object, path []string, paths map[int][]string, queue *[]int) {
+	if reference, ok := o.(*Reference); ok {
+		if _, ok := paths[reference.Number]; !ok {
+			paths[reference.Number] = path
+			*queue = append(*queue, reference.Number)
+		}
+	} else if d, ok := o.(Dictionary); ok {
+		// sort keys so paths do not depend on map order
+		keys := make([]string, 0, len(d))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			parser.walkPaths(d[key], append(append([]string{}, path...), key), paths, queue)
+		}
+	} else if a, ok := o.(Array); ok {
+		for i := range a {
+			parser.walkPaths(a[i], append(append([]string{}, path...), strconv.Itoa(i)), paths, queue)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Revision is the original document or one of its incremental updates
+// each revision ends with a startxref and %%EOF marker, revision 0 is the original document
+type Revision struct {
+	Number int
+
+	// XrefOffset is the offset of the xref section the startxref marker points to
+	XrefOffset int64
+
+	// EndOffset is the offset just past the %%EOF marker and its end of line
+	EndOffset int64
+
+	// Trailer and Xref are the trailer and entries of this revision's xref section, previous sections are not included
+	Trailer Dictionary
+	Xref map[int]*XrefEntry
+
+	// Added, Modified and Freed are the object numbers changed by this revision
+	Added []int
+	Modified []int
+	Freed []int
+}
+
+// Revisions returns the revisions of the pdf from first to last
+func (parser *Parser) Revisions() []*Revision {
+	revisions := []*Revision{}
+
+	// read xref sections with a separate parser so the xref of this parser is not changed
+	section_parser := NewParser(parser.seeker, nil)
+	defer parser.Seek(0, io.SeekStart)
+
+	// compare each revision to the objects in use before it
+	in_use := map[int]*XrefEntry{}
+	for _, marker := range parser.findEOFMarkers() {
+		revision := &Revision{len(revisions), marker.xref_offset, marker.end, nil, nil, []int{}, []int{}, []int{}}
+		revision.Trailer, revision.Xref = section_parser.readXrefSection(revision.XrefOffset)
+
+		// sort object numbers so changes are in order
+		numbers := make([]int, 0, len(revision.Xref))
+		for number := range revision.Xref {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+
+		for _, number := range numbers {
+			xref_entry := revision.Xref[number]
+			previous, ok := in_use[number]
+			if xref_entry.Type == XrefTypeFreeObject {
+				// the free list head and objects that were already free are not changes
+				if ok {
+					revision.Freed = append(revision.Freed, number)
+					delete(in_use, number)
+				}
+			} else if !ok {
+				revision.Added = append(revision.Added, number)
+				in_use[number] = xref_entry
+			} else if previous.Offset != xref_entry.Offset || previous.Generation != xref_entry.Generation || previous.Type != xref_entry.Type {
+				revision.Modified = append(revision.Modified, number)
+				in_use[number] = xref_entry
+			}
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions
+}
+
+// OpenRevision returns a parser that only sees the pdf up to the end of a revision
+// the parser uses the same sink and decryption settings, Load must be called before it is used
+func (parser *Parser) OpenRevision(number int) (*Parser, error) {
+	reader, err := parser.revisionReader(number)
+	if err != nil {
+		return nil, err
+	}
+	return parser.newView(reader, parser.sink), nil
+}
+
+// WriteRevision writes the pdf truncated at the end of a revision
+func (parser *Parser) WriteRevision(number int, writer io.Writer) error {
+	reader, err := parser.revisionReader(number)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, reader)
+	return err
+}
+
+// revisionReader returns a reader of the pdf truncated at the end of a revision
+func (parser *Parser) revisionReader(number int) (io.ReadSeeker, error) {
+	revisions := parser.Revisions()
+	if number < 0 || number >= len(revisions) {
+		return nil, RevisionNotFoundError
+	}
+	return parser.sectionReader(0, revisions[number].EndOffset)
+}
+
+// sectionReader returns a reader of size bytes of the pdf at offset
+func (parser *Parser) sectionReader(offset int64, size int64) (io.ReadSeeker, error) {
+	// share the underlying file if possible
+	if reader_at, ok := parser.seeker.(io.ReaderAt); ok {
+		return io.NewSectionReader(reader_at, offset, size), nil
+	}
+
+	// otherwise read the section into memory
+	data := make([]byte, size)
+	parser.Seek(offset, io.SeekStart)
+	if _, err := io.ReadFull(parser, data); err != nil {
+		return nil, ReadError
+	}
+	return bytes.NewReader(data), nil
+}
+
+// eofMarker is a startxref and %%EOF marker, end is the offset just past the end of line after %%EOF
+type eofMarker struct {
+	start int64
+	xref_offset int64
+	end int64
+}
+
+// findEOFMarkers returns each startxref and %%EOF marker in the order they appear in the file
+func (parser *Parser) findEOFMarkers() []eofMarker {
+	markers := []eofMarker{}
+
+	// jump to start of file
+	offset, _ := parser.Seek(0, io.SeekStart)
+
+	for {
+		// scan for startxref and %%EOF marker
+		index := start_xref_regexp.FindReaderSubmatchIndex(parser)
+		if index == nil {
+			break
+		}
+
+		// read the startxref offset
+		parser.Seek(offset + int64(index[2]), io.SeekStart)
+		buffer := make([]byte, index[3] - index[2])
+		io.ReadFull(parser, buffer)
+		xref_offset, parse_err := strconv.ParseInt(string(buffer), 10, 64)
+
+		// the revision includes the end of line after %%EOF
+		end := parser.eolEnd(offset + int64(index[1]))
+
+		if parse_err == nil {
+			markers = append(markers, eofMarker{offset + int64(index[0]), xref_offset, end})
+		}
+
+		// seek to end of marker
+		offset, _ = parser.Seek(end, io.SeekStart)
+	}
+
+	return markers
+}
+
+// eolEnd returns the offset just past the end of line at offset, or offset if there is no end of line
+func (parser *Parser) eolEnd(offset int64) int64 {
+	parser.Seek(offset, io.SeekStart)
+	if b, err := parser.ReadByte(); err == nil && b == '\r' {
+		offset++
+		b, err = parser.ReadByte()
+		if err == nil && b == '\n' {
+			offset++
+		}
+	} else if err == nil && b == '\n' {
+		offset++
+	}
+	return offset
+}
+
+// readXrefSection reads the xref table or stream at offset without following /Prev
+func (parser *Parser) readXrefSection(offset int64) (Dictionary, map[int]*XrefEntry) {
+	// if xref is a table
+	parser.Seek(offset, io.SeekStart)
+	if keyword := parser.ReadKeyword(); keyword == KEYWORD_XREF {
+		trailer, xrefs := parser.readXrefTable()
+
+		// include the supplemental xref stream of a hybrid-reference file
+		if xref_stm, ok := trailer.GetInt64("XRefStm"); ok {
+			xrefs = mergeXrefStm(xrefs, parser.loadXrefStm(xref_stm, map[int64]interface{}{offset: nil}))
+		}
+		return trailer, xrefs
+	}
+
+	// if xref is a stream
+	parser.Seek(offset, io.SeekStart)
+	if n, g, ok := parser.ReadObjectHeader(); ok {
+		return parser.readXrefStream(n, g, offset)
+	}
+	return Dictionary{}, map[int]*XrefEntry{}
+}
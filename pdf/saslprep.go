@@ -0,0 +1,35 @@
+package pdf
+
+import (
+	"strings"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SASLprep prepares a password using the SASLprep profile of stringprep (RFC 4013)
+// prohibited characters are kept since the result is only used to derive an encryption key
+func SASLprep(password string) string {
+	var s strings.Builder
+	for _, r := range password {
+		if isNonASCIISpace(r) {
+			// map non ascii space characters to space
+			s.WriteByte(' ')
+		} else if !isMappedToNothing(r) {
+			s.WriteRune(r)
+		}
+	}
+
+	// normalize with unicode normalization form KC
+	return norm.NFKC.String(s.String())
+}
+
+// isMappedToNothing returns true if r is in stringprep table B.1
+func isMappedToNothing(r rune) bool {
+	return r == 0x00AD || r == 0x034F || r == 0x1806 || (r >= 0x180B && r <= 0x180D) ||
+		(r >= 0x200B && r <= 0x200D) || r == 0x2060 || (r >= 0xFE00 && r <= 0xFE0F) || r == 0xFEFF
+}
+
+// isNonASCIISpace returns true if r is in stringprep table C.1.2
+func isNonASCIISpace(r rune) bool {
+	return r == 0x00A0 || r == 0x1680 || (r >= 0x2000 && r <= 0x200A) || r == 0x202F ||
+		r == 0x205F || r == 0x3000
+}
@@ -0,0 +1,147 @@
+package pdf
+
+// Sink receives everything found while parsing a pdf
+type Sink interface {
+	// WriteFileSummary receives the size and hashes of the pdf
+	WriteFileSummary(summary FileSummary)
+
+	// WriteFileInfo receives the description of the header and end of file markers
+	WriteFileInfo(info *FileInfo)
+
+	// WriteEncryption receives the description of the encryption, even if the pdf could not be decrypted
+	WriteEncryption(info *EncryptionInfo)
+
+	// WritePassword receives a password that decrypts the pdf
+	WritePassword(password_type string, password string)
+
+	WriteURL(url string, location Location)
+	WriteCommand(command string, location Location)
+
+	// WriteFileName receives the name of a file that is referenced but not embedded in the pdf
+	WriteFileName(name string, location Location)
+
+	// DumpFile receives a file embedded in the pdf
+	DumpFile(name string, data []byte, location Location)
+
+	WriteScript(script string, location Location)
+
+	// WriteText receives a line of text content
+	WriteText(text string)
+
+	// WriteObject receives each decrypted and decoded object
+	WriteObject(object *IndirectObject)
+
+	// WriteUncovered receives each region of the pdf that does not belong to any object and its data
+	WriteUncovered(region UncoveredRegion, data []byte)
+
+	// WriteFormat receives each signature of another file format found in the raw pdf
+	WriteFormat(format EmbeddedFormat)
+
+	// WriteAnomaly receives each anomaly found while parsing, the same anomaly may be written more than once
+	WriteAnomaly(anomaly Anomaly)
+
+	// Close is called once parsing is finished
+	Close() error
+}
+
+// MultiSink writes everything to each of its sinks
+type MultiSink []Sink
+
+func NewMultiSink(sinks ...Sink) MultiSink {
+	return MultiSink(sinks)
+}
+
+func (sinks MultiSink) WriteFileSummary(summary FileSummary) {
+	for _, sink := range sinks {
+		sink.WriteFileSummary(summary)
+	}
+}
+
+func (sinks MultiSink) WriteFileInfo(info *FileInfo) {
+	for _, sink := range sinks {
+		sink.WriteFileInfo(info)
+	}
+}
+
+func (sinks MultiSink) WriteEncryption(info *EncryptionInfo) {
+	for _, sink := range sinks {
+		sink.WriteEncryption(info)
+	}
+}
+
+func (sinks MultiSink) WritePassword(password_type string, password string) {
+	for _, sink := range sinks {
+		sink.WritePassword(password_type, password)
+	}
+}
+
+func (sinks MultiSink) WriteURL(url string, location Location) {
+	for _, sink := range sinks {
+		sink.WriteURL(url, location)
+	}
+}
+
+func (sinks MultiSink) WriteCommand(command string, location Location) {
+	for _, sink := range sinks {
+		sink.WriteCommand(command, location)
+	}
+}
+
+func (sinks MultiSink) WriteFileName(name string, location Location) {
+	for _, sink := range sinks {
+		sink.WriteFileName(name, location)
+	}
+}
+
+func (sinks MultiSink) DumpFile(name string, data []byte, location Location) {
+	for _, sink := range sinks {
+		sink.DumpFile(name, data, location)
+	}
+}
+
+func (sinks MultiSink) WriteScript(script string, location Location) {
+	for _, sink := range sinks {
+		sink.WriteScript(script, location)
+	}
+}
+
+func (sinks MultiSink) WriteText(text string) {
+	for _, sink := range sinks {
+		sink.WriteText(text)
+	}
+}
+
+func (sinks MultiSink) WriteObject(object *IndirectObject) {
+	for _, sink := range sinks {
+		sink.WriteObject(object)
+	}
+}
+
+func (sinks MultiSink) WriteUncovered(region UncoveredRegion, data []byte) {
+	for _, sink := range sinks {
+		sink.WriteUncovered(region, data)
+	}
+}
+
+func (sinks MultiSink) WriteFormat(format EmbeddedFormat) {
+	for _, sink := range sinks {
+		sink.WriteFormat(format)
+	}
+}
+
+func (sinks MultiSink) WriteAnomaly(anomaly Anomaly) {
+	for _, sink := range sinks {
+		sink.WriteAnomaly(anomaly)
+	}
+}
+
+// Close closes every sink and returns the first error
+func (sinks MultiSink) Close() error {
+	var first_err error
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil && first_err == nil {
+			first_err = err
+		}
+	}
+	return first_err
+}
@@ -1,22 +1,852 @@
 package pdf
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
 
-func openTestPdf(pdf_name string) (*os.File, error) {
+func testPdfPath(pdf_name string) string {
 	_, test_path, _, _ := runtime.Caller(0)
 	test_dir := filepath.Dir(test_path)
-	return os.Open(filepath.Join(test_dir, "test", pdf_name))
+	return filepath.Join(test_dir, "test", pdf_name)
+}
+
+func openTestPdf(pdf_name string) (*os.File, error) {
+	return os.Open(testPdfPath(pdf_name))
+}
+
+func TestCarve(test *testing.T) {
+	// open the data
+	f, err := openTestPdf("carve.bin")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// assert the pdf with incremental updates, the following pdf and the truncated pdf are found
+	carved := []string{}
+	for _, carved_pdf := range CarveReader(f, "") {
+		carved = append(carved, fmt.Sprintf("%d:%d:%d:%t:%t:%s", carved_pdf.Start, carved_pdf.End, carved_pdf.EOFCount, carved_pdf.Truncated, carved_pdf.Parsed, carved_pdf.Error))
+	}
+	if c := strings.Join(carved, ","); c != "100:730:3:false:true:,794:1321:1:false:true:,1371:1433:0:true:false:missing catalog" {
+		test.Fatalf("incorrect carved pdfs %s", c)
+	}
+
+	// assert each pdf is written to the output directory
+	output_dir, err := ioutil.TempDir("", "carve")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(output_dir)
+	if _, err = Carve(testPdfPath("carve.bin"), "", output_dir); err != nil {
+		test.Fatal(err)
+	}
+	carved_data, err := ioutil.ReadFile(filepath.Join(output_dir, "carved_100.pdf"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	revisions_data, err := ioutil.ReadFile(testPdfPath("revisions.pdf"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Equal(carved_data, revisions_data) {
+		test.Fatalf("incorrect carved pdf")
+	}
+}
+
+func TestComments(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("comments.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// read the object
+	object := parser.GetObject(1)
+
+	// assert value is correct
+	if object.Value.String() != "(%this is not a comment)" {
+		test.Fatalf("incorrect value %s", object.Value.String())
+	}
+}
+
+func TestCoverage(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("coverage.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the header, comment, objects, xref, trailer and startxref marker are covered
+	coverage := parser.Coverage()
+	kinds := []string{}
+	for _, covered := range coverage.Ranges {
+		kinds = append(kinds, covered.Kind)
+	}
+	if k := strings.Join(kinds, ","); k != "header,comment,object,object,xref,trailer,startxref" {
+		test.Fatalf("incorrect ranges %s", k)
+	}
+
+	// assert data before the header, between objects and after the end of the file is not covered
+	regions := []string{}
+	for _, region := range coverage.Uncovered {
+		regions = append(regions, fmt.Sprintf("%d:%d", region.Offset, region.Size))
+	}
+	if r := strings.Join(regions, ","); r != "0:10,73:36,278:20" {
+		test.Fatalf("incorrect uncovered regions %s", r)
+	}
+	if region := coverage.Uncovered[2]; region.Preview != "504b0304617070656e646564207061796c6f6164" || region.Entropy != 3.51 {
+		test.Fatalf("incorrect uncovered region %v", region)
+	}
+
+	// assert uncovered regions are reported and dumped
+	output_dir, err := ioutil.TempDir("", "coverage")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(output_dir)
+	sink, err := NewDirectorySink(output_dir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	sink.DumpUncovered = true
+	if err = ParseReader(f, "", sink); err != nil {
+		test.Fatal(err)
+	}
+	sink.Close()
+	codes := []string{}
+	for _, anomaly := range sink.Report.Anomalies {
+		codes = append(codes, anomaly.Code)
+	}
+	if len(sink.Report.Uncovered) != 3 || strings.Count(strings.Join(codes, ","), "uncovered_data") != 3 {
+		test.Fatalf("incorrect report %v", sink.Report)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(output_dir, "uncovered_278.bin")); err != nil || string(data) != "PK\x03\x04appended payload" {
+		test.Fatalf("incorrect dumped region %q", data)
+	}
+}
+
+func TestCoverageComments(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("coverage_comments.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the binary marker and text comments are covered
+	coverage := parser.Coverage()
+	comments := []string{}
+	for _, covered := range coverage.Ranges {
+		if covered.Kind == CoverageComment {
+			comments = append(comments, fmt.Sprintf("%d:%d", covered.Offset, covered.Size))
+		}
+	}
+	if c := strings.Join(comments, ","); c != "9:5,15:11,321:18" {
+		test.Fatalf("incorrect comments %s", c)
+	}
+
+	// assert another document, a script and control bytes that start with % are not covered
+	regions := []string{}
+	for _, region := range coverage.Uncovered {
+		regions = append(regions, fmt.Sprintf("%d:%d", region.Offset, region.Size))
+	}
+	if r := strings.Join(regions, ","); r != "240:79" {
+		test.Fatalf("incorrect uncovered regions %s", r)
+	}
+	if formats := parser.DetectFormats(); len(formats) != 1 || formats[0].Format != FormatScript || formats[0].Offset != 283 {
+		test.Fatalf("incorrect formats %v", formats)
+	}
+}
+
+func TestCrack(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("encrypted_owner.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the encryption dictionary
+	parser := NewParser(f, nil)
+	if err = parser.Load(""); err != EncryptionPasswordError {
+		test.Fatalf("expected password error got %v", err)
+	}
+
+	// assert password is not found without mangling rules
+	cracker := NewCracker(parser.SecurityHandler(), []string{}, 2)
+	if _, _, err = cracker.Run(strings.NewReader("User\nOWNER\n")); err != PasswordNotFoundError {
+		test.Fatalf("expected password not found got %v", err)
+	}
+
+	// assert password is found with case rule
+	cracker = NewCracker(parser.SecurityHandler(), []string{CrackRuleCase}, 2)
+	password, password_type, err := cracker.Run(strings.NewReader("User\nOWNER\n"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if password != "user" || password_type != PasswordTypeUser {
+		test.Fatalf("incorrect password %s:%s", password_type, password)
+	}
+
+	// assert session resumes after the first word
+	session, err := ioutil.TempFile("", "session")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(session.Name())
+	session.WriteString("inputs\n1\n")
+	session.Close()
+	cracker = NewCracker(parser.SecurityHandler(), []string{CrackRuleCase}, 2)
+	cracker.SessionPath = session.Name()
+	cracker.Fingerprint = "inputs"
+	password, password_type, err = cracker.Run(strings.NewReader("User\nOWNER\n"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if password != "owner" || password_type != PasswordTypeOwner {
+		test.Fatalf("incorrect password %s:%s", password_type, password)
+	}
+
+	// assert lines too long to be a word are skipped instead of ending the run
+	cracker = NewCracker(parser.SecurityHandler(), []string{CrackRuleCase}, 2)
+	password, _, err = cracker.Run(strings.NewReader(strings.Repeat("x", 3 * crack_max_word_size) + "\nOWNER\n"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if password != "owner" || cracker.Skipped != 1 {
+		test.Fatalf("incorrect password %s or skipped lines %d", password, cracker.Skipped)
+	}
+	cracker.SessionPath = session.Name()
+	cracker.Fingerprint = "inputs"
+
+	// assert a session of other inputs or of an old format is not resumed
+	for _, data := range []string{"other\n1\n", "1\n"} {
+		ioutil.WriteFile(session.Name(), []byte(data), 0644)
+		if _, _, err = cracker.Run(strings.NewReader("User\nOWNER\n")); err != SessionMismatchError {
+			test.Fatalf("expected session mismatch for %q got %v", data, err)
+		}
+	}
+}
+
+func TestCrackSession(test *testing.T) {
+	// write a wordlist without the password
+	wordlist, err := ioutil.TempFile("", "wordlist")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(wordlist.Name())
+	wordlist.WriteString("one\ntwo\n")
+	wordlist.Close()
+	session := wordlist.Name() + ".session"
+	defer os.Remove(session)
+
+	// save a session that is interrupted after the first word
+	f, err := openTestPdf("encrypted_owner.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+	list, err := os.Open(wordlist.Name())
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer list.Close()
+	fingerprint, err := crackFingerprint(f, list, []string{CrackRuleCase})
+	if err != nil {
+		test.Fatal(err)
+	}
+	cracker := NewCracker(nil, []string{CrackRuleCase}, 1)
+	cracker.SessionPath = session
+	cracker.Fingerprint = fingerprint
+	cracker.saveSession(1)
+
+	// assert the session is refused with other rules, another pdf or a modified wordlist
+	if _, _, err = Crack(testPdfPath("encrypted_owner.pdf"), wordlist.Name(), []string{}, 1, session, nil); err != SessionMismatchError {
+		test.Fatalf("expected session mismatch for other rules got %v", err)
+	}
+	if _, _, err = Crack(testPdfPath("encrypted_aes_256.pdf"), wordlist.Name(), []string{CrackRuleCase}, 1, session, nil); err != SessionMismatchError {
+		test.Fatalf("expected session mismatch for another pdf got %v", err)
+	}
+	modified := time.Now().Add(time.Hour)
+	os.Chtimes(wordlist.Name(), modified, modified)
+	if _, _, err = Crack(testPdfPath("encrypted_owner.pdf"), wordlist.Name(), []string{CrackRuleCase}, 1, session, nil); err != SessionMismatchError {
+		test.Fatalf("expected session mismatch for a modified wordlist got %v", err)
+	}
+
+	// assert the session is resumed with the same inputs and removed once the run is complete
+	cracker.Fingerprint, err = crackFingerprint(f, list, []string{CrackRuleCase})
+	if err != nil {
+		test.Fatal(err)
+	}
+	cracker.saveSession(1)
+	if _, _, err = Crack(testPdfPath("encrypted_owner.pdf"), wordlist.Name(), []string{CrackRuleCase}, 1, session, nil); err != PasswordNotFoundError {
+		test.Fatalf("expected password not found got %v", err)
+	}
+	if _, err = os.Stat(session); !os.IsNotExist(err) {
+		test.Fatalf("expected session to be removed got %v", err)
+	}
+}
+
+func TestDiff(test *testing.T) {
+	// compare the revisions of the pdf
+	diff, err := DiffRevisions(testPdfPath("diff.pdf"), "", 0, 1)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the changes are found at each key path
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 || len(diff.Changed) != 3 {
+		test.Fatalf("incorrect diff %v", diff)
+	}
+	if c := fmt.Sprint(diff.Changed[0].Values); c != "[{[OpenAction]  5 0 R}]" {
+		test.Fatalf("incorrect value changes %s", c)
+	}
+
+	// assert decoded streams are compared line by line
+	if s := strings.Join(diff.Changed[1].Stream, "\n"); s != "-(Hello) Tj\n+(Goodbye) Tj" {
+		test.Fatalf("incorrect content stream diff %s", s)
+	}
+	if s := strings.Join(diff.Changed[2].Stream, "\n"); s != "+app.launchURL('http://example.com');" {
+		test.Fatalf("incorrect script diff %s", s)
+	}
+
+	// assert objects added and removed by a revision are found
+	diff, err = DiffRevisions(testPdfPath("revisions.pdf"), "", 0, 2)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if c := fmt.Sprint(diff.Added, diff.Removed, len(diff.Changed)); c != "[5 6] [4] 1" {
+		test.Fatalf("incorrect diff %s", c)
+	}
+}
+
+func TestDuplicateObject(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("duplicate_object.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert every definition is recorded
+	definitions := parser.Definitions(3)
+	if len(definitions) != 2 || definitions[0].Offset != 117 || definitions[1].Offset != 141 {
+		test.Fatalf("incorrect definitions %v", definitions)
+	}
+
+	// assert the xref definition and the shadowed definition can both be read
+	if s, ok := parser.GetObject(3).Value.(String); !ok || string(s) != "Shown" {
+		test.Fatalf("incorrect value %v", parser.GetObject(3).Value)
+	}
+	if object, ok := parser.GetObjectAt(141); !ok || object.Number != 3 || object.Value.String() != "(Shadowed)" {
+		test.Fatalf("incorrect shadowed object %v", object)
+	}
+
+	// assert duplicates are reported apart from incremental updates
+	anomalies := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		anomalies = append(anomalies, fmt.Sprintf("%s:%d:%d", anomaly.Code, anomaly.Object, anomaly.Offset))
+	}
+	if a := strings.Join(anomalies, ","); a != "redefined_object:2:308,duplicate_object:3:141" {
+		test.Fatalf("incorrect anomalies %s", a)
+	}
+}
+
+func TestEmptyArray(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("empty_array.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// read the object
+	object := parser.GetObject(1)
+
+	// assert value is correct
+	if object.Value.String() != "[]" {
+		test.Fatalf("incorrect value %s", object.Value.String())
+	}
+}
+
+func TestEmptyDictionary(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("empty_dictionary.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// read the object
+	object := parser.GetObject(1)
+
+	// assert value is correct
+	if object.Value.String() != "<<>>" {
+		test.Fatalf("incorrect value %s", object.Value.String())
+	}
+}
+
+func TestEncrypted(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("encrypted.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test string decryption
+	object := parser.GetObject(12)
+	d12, ok := object.Value.(Dictionary)
+	if !ok {
+		test.Fatalf("expected dictionary")
+	}
+	if lang, _ := d12.GetString("Lang"); lang != "en-US" {
+		test.Fatalf("incorrect value %s", lang)
+	}
+
+	// test stream decryption
+	object = parser.GetObject(8)
+	if string(object.Stream[:8]) != "/CIDInit" {
+		test.Fatalf("incorrect value %s", string(object.Stream[:8]))
+	}
+}
+
+func TestEncryptedAES256(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("encrypted_aes_256.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf with wrong password
+	parser := NewParser(f, nil)
+	if err = parser.Load("wrong"); err != EncryptionPasswordError {
+		test.Fatalf("expected password error got %v", err)
+	}
+
+	// load the pdf with owner password and user password in decomposed form
+	for _, password := range []string{"owner", "pa\u0308ss"} {
+		parser = NewParser(f, nil)
+		err = parser.Load(password)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		// test string decryption
+		object := parser.GetObject(1)
+		d1, ok := object.Value.(Dictionary)
+		if !ok {
+			test.Fatalf("expected dictionary")
+		}
+		if lang, _ := d1.GetString("Lang"); lang != "en-US" {
+			test.Fatalf("incorrect value %s", lang)
+		}
+
+		// test stream decryption
+		object = parser.GetObject(3)
+		if string(object.Stream) != "Hello World!" {
+			test.Fatalf("incorrect value %s", string(object.Stream))
+		}
+	}
+}
+
+func TestEncryptedAES256R5(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("encrypted_aes_256_r5.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("user")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test stream decryption
+	object := parser.GetObject(3)
+	if string(object.Stream) != "Hello World!" {
+		test.Fatalf("incorrect value %s", string(object.Stream))
+	}
+
+	// assert tampered perms are detected
+	if parser.security_handler.perms_valid {
+		test.Fatal("expected invalid perms")
+	}
+}
+
+func TestEncryptedOwnerPassword(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("encrypted_owner.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf with the owner password
+	parser := NewParser(f, nil)
+	err = parser.Load("owner")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert owner password matched and user password was recovered
+	security_handler := parser.SecurityHandler()
+	if security_handler.PasswordType != PasswordTypeOwner {
+		test.Fatalf("incorrect password type %s", security_handler.PasswordType)
+	}
+	if !security_handler.UserPasswordKnown || string(security_handler.UserPassword) != "user" {
+		test.Fatalf("incorrect user password %s", string(security_handler.UserPassword))
+	}
+
+	// test string decryption
+	object := parser.GetObject(1)
+	d1, ok := object.Value.(Dictionary)
+	if !ok {
+		test.Fatalf("expected dictionary")
+	}
+	if lang, _ := d1.GetString("Lang"); lang != "en-US" {
+		test.Fatalf("incorrect value %s", lang)
+	}
+
+	// test stream decryption
+	object = parser.GetObject(3)
+	if string(object.Stream) != "Hello World!" {
+		test.Fatalf("incorrect value %s", string(object.Stream))
+	}
+
+	// load the pdf with the user password
+	parser = NewParser(f, nil)
+	err = parser.Load("user")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if parser.SecurityHandler().PasswordType != PasswordTypeUser {
+		test.Fatalf("incorrect password type %s", parser.SecurityHandler().PasswordType)
+	}
+}
+
+func TestEncryptedKnownKey(test *testing.T) {
+	// test a standard security handler and a security handler only a known key can decrypt
+	for _, test_case := range []struct{file_name string; key string}{
+		{"encrypted_owner.pdf", "c33f4c2046d5a18893cd4824afc251ec"},
+		{"encrypted_key.pdf", "00112233445566778899aabbccddeeff"},
+	} {
+		// open the pdf
+		f, err := openTestPdf(test_case.file_name)
+		if err != nil {
+			test.Fatal(err)
+		}
+		defer f.Close()
+
+		// load the pdf with a wrong key
+		key, _ := ParseEncryptionKey("00000000000000000000000000000000")
+		parser := NewParser(f, nil)
+		parser.SecurityHandler().SetEncryptionKey(key)
+		if err = parser.Load(""); err != EncryptionKeyError {
+			test.Fatalf("%s: expected encryption key error, got %v", test_case.file_name, err)
+		}
+
+		// load the pdf with the known key
+		key, err = ParseEncryptionKey(test_case.key)
+		if err != nil {
+			test.Fatal(err)
+		}
+		parser = NewParser(f, nil)
+		parser.SecurityHandler().SetEncryptionKey(key)
+		if err = parser.Load(""); err != nil {
+			test.Fatalf("%s: %v", test_case.file_name, err)
+		}
+
+		// test string decryption
+		object := parser.GetObject(1)
+		d1, ok := object.Value.(Dictionary)
+		if !ok {
+			test.Fatalf("expected dictionary")
+		}
+		if lang, _ := d1.GetString("Lang"); lang != "en-US" {
+			test.Fatalf("%s: incorrect value %s", test_case.file_name, lang)
+		}
+
+		// test stream decryption
+		object = parser.GetObject(3)
+		if !strings.HasPrefix(string(object.Stream), "Hello World!") {
+			test.Fatalf("%s: incorrect value %s", test_case.file_name, string(object.Stream))
+		}
+	}
+
+	// a wrong key that decrypts the first stream to a zlib header and truncated data is not accepted
+	f, err := openTestPdf("encrypted_key_decoy.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+	key, _ := ParseEncryptionKey("ffeeddccbbaa99887766554433221100")
+	parser := NewParser(f, nil)
+	parser.SecurityHandler().SetEncryptionKey(key)
+	if err = parser.Load(""); err != EncryptionKeyError {
+		test.Fatalf("expected encryption key error, got %v", err)
+	}
+
+	// the known key is accepted by the stream after it
+	key, _ = ParseEncryptionKey("00112233445566778899aabbccddeeff")
+	parser = NewParser(f, nil)
+	parser.SecurityHandler().SetEncryptionKey(key)
+	if err = parser.Load(""); err != nil {
+		test.Fatal(err)
+	}
+
+	// keys must be hex encoded and 5 to 32 bytes long
+	if _, err := ParseEncryptionKey("0011"); err != EncryptionKeyFormatError {
+		test.Fatalf("expected encryption key format error")
+	}
+}
+
+func TestEncryptedPublicKey(test *testing.T) {
+	// read the recipient certificate and private key
+	_, test_path, _, _ := runtime.Caller(0)
+	test_dir := filepath.Join(filepath.Dir(test_path), "test")
+	certificate, err := ReadCertificate(filepath.Join(test_dir, "pubsec.crt"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	private_key, err := ReadPrivateKey(filepath.Join(test_dir, "pubsec.key"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, pdf_name := range []string{"encrypted_pubsec_s4.pdf", "encrypted_pubsec_s5.pdf"} {
+		// open the pdf
+		f, err := openTestPdf(pdf_name)
+		if err != nil {
+			test.Fatal(err)
+		}
+		defer f.Close()
+
+		// load the pdf without a certificate
+		parser := NewParser(f, nil)
+		if err = parser.Load(""); err != EncryptionCertificateError {
+			test.Fatalf("expected certificate error got %v", err)
+		}
+
+		// load the pdf with the certificate
+		parser = NewParser(f, nil)
+		parser.SecurityHandler().SetCertificate(certificate, private_key)
+		err = parser.Load("")
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		// test string decryption
+		object := parser.GetObject(1)
+		d1, ok := object.Value.(Dictionary)
+		if !ok {
+			test.Fatalf("expected dictionary")
+		}
+		if lang, _ := d1.GetString("Lang"); lang != "en-US" {
+			test.Fatalf("incorrect value %s", lang)
+		}
+
+		// test stream decryption
+		object = parser.GetObject(3)
+		if string(object.Stream) != "Hello World!" {
+			test.Fatalf("incorrect value %s", string(object.Stream))
+		}
+	}
+}
+
+func TestEncryptionInfo(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("encrypted_aes_256.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf with the wrong password
+	parser := NewParser(f, nil)
+	if err = parser.Load("wrong"); err != EncryptionPasswordError {
+		test.Fatalf("expected password error got %v", err)
+	}
+
+	// assert encryption is described without the password
+	info := parser.EncryptionInfo
+	if info == nil {
+		test.Fatal("missing encryption info")
+	}
+	if info.Filter != "Standard" || info.V != 5 || info.R != 6 {
+		test.Fatalf("incorrect handler %s V %d R %d", info.Filter, info.V, info.R)
+	}
+	if info.Algorithm != "AES-256" || info.KeyLength != 256 {
+		test.Fatalf("incorrect algorithm %s %d", info.Algorithm, info.KeyLength)
+	}
+	if info.StreamFilter != "StdCF" || info.StringFilter != "StdCF" || info.EmbeddedFileFilter != "StdCF" {
+		test.Fatalf("incorrect crypt filters %s %s %s", info.StreamFilter, info.StringFilter, info.EmbeddedFileFilter)
+	}
+	if !info.EncryptMetadata {
+		test.Fatal("expected encrypted metadata")
+	}
+
+	// assert permission bits are decoded from P -1028 which only clears the assemble bit
+	permissions := info.Permissions
+	if !permissions.Print || !permissions.Modify || !permissions.Copy || !permissions.Annotate || !permissions.FillForms || !permissions.Extract || permissions.Assemble || !permissions.HighQualityPrint {
+		test.Fatalf("incorrect permissions %+v", permissions)
+	}
+
+	// load the pdf with the owner password
+	parser = NewParser(f, nil)
+	if err = parser.Load("owner"); err != nil {
+		test.Fatal(err)
+	}
+	if parser.EncryptionInfo.PasswordType != PasswordTypeOwner || parser.EncryptionInfo.PermsValid == nil || !*parser.EncryptionInfo.PermsValid {
+		test.Fatal("incorrect authentication results")
+	}
+
+	// assert crypt filters are not named before V 4
+	f2, err := openTestPdf("encrypted_owner.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f2.Close()
+	parser = NewParser(f2, nil)
+	if err = parser.Load("wrong"); err != EncryptionPasswordError {
+		test.Fatalf("expected password error got %v", err)
+	}
+	info = parser.EncryptionInfo
+	if info.V >= 4 || info.Algorithm != "RC4" {
+		test.Fatalf("incorrect handler V %d %s", info.V, info.Algorithm)
+	}
+	if info.StreamFilter != "" || info.StringFilter != "" || info.EmbeddedFileFilter != "" {
+		test.Fatalf("incorrect crypt filters %s %s %s", info.StreamFilter, info.StringFilter, info.EmbeddedFileFilter)
+	}
+}
+
+func TestFileInfo(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("file_info.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// extract the pdf
+	sink := NewMemorySink()
+	if err = ParseReader(f, "", sink); err != nil {
+		test.Fatal(err)
+	}
+	result := sink.Result()
+
+	// assert the header and end of file markers are described
+	info := result.Report.Info
+	if info == nil || info.HeaderOffset != 0 || info.Version != "1.9" || !info.BinaryMarker || info.CatalogVersion != "1.7" {
+		test.Fatalf("incorrect header %v", info)
+	}
+	if info.EOFCount != 3 || info.StartXrefCount != 2 || info.StartXref != 74 || info.StartXrefValid {
+		test.Fatalf("incorrect end of file markers %v", info)
+	}
+
+	// assert the unknown version, earlier catalog version, invalid startxref and markers without an xref are reported
+	anomalies := []string{}
+	for _, anomaly := range result.Report.Anomalies {
+		anomalies = append(anomalies, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Offset))
+	}
+	if a := strings.Join(anomalies, ","); !strings.HasPrefix(a, "unknown_version:0,catalog_version_ignored:0,invalid_startxref:247,eof_without_xref:241,eof_without_xref:260") {
+		test.Fatalf("incorrect anomalies %s", a)
+	}
+
+	// extract a pdf with a later catalog version and data appended after the end of file marker
+	f2, err := openTestPdf("file_info_trailing.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f2.Close()
+	sink = NewMemorySink()
+	if err = ParseReader(f2, "", sink); err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the override and the appended data are reported instead of a missing startxref
+	info = sink.Result().Report.Info
+	if info.StartXrefCount != 1 || info.StartXref != -1 {
+		test.Fatalf("incorrect end of file markers %v", info)
+	}
+	anomalies = []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		anomalies = append(anomalies, fmt.Sprintf("%s:%d:%s", anomaly.Code, anomaly.Offset, anomaly.Message))
+	}
+	if a := strings.Join(anomalies, ","); !strings.HasPrefix(a, "catalog_version_override:0:catalog /Version overrides the header version (1.7 overrides 1.4),trailing_data:235:data after the last startxref marker (455 bytes)") || strings.Contains(a, "missing_startxref") {
+		test.Fatalf("incorrect anomalies %s", a)
+	}
 }
 
-func TestComments(test *testing.T) {
+func TestFilterASCII85Decode(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("comments.pdf")
+	f, err := openTestPdf("filter_ascii_85_decode.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -33,14 +863,14 @@ func TestComments(test *testing.T) {
 	object := parser.GetObject(1)
 
 	// assert value is correct
-	if object.Value.String() != "(%this is not a comment)" {
-		test.Fatalf("incorrect value %s", object.Value.String())
+	if string(object.Stream) != "\x00\x00\x00\x00%!FontType" {
+		test.Fatalf("incorrect value %s", string(object.Stream))
 	}
 }
 
-func TestEmptyArray(test *testing.T) {
+func TestFilterASCIIHexDecode(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("empty_array.pdf")
+	f, err := openTestPdf("filter_ascii_hex_decode.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -57,14 +887,14 @@ func TestEmptyArray(test *testing.T) {
 	object := parser.GetObject(1)
 
 	// assert value is correct
-	if object.Value.String() != "[]" {
-		test.Fatalf("incorrect value %s", object.Value.String())
+	if string(object.Stream) != "Hellop" {
+		test.Fatalf("incorrect value %s", string(object.Stream))
 	}
 }
 
-func TestEmptyDictionary(test *testing.T) {
+func TestFilterCCITTFaxDecode(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("empty_dictionary.pdf")
+	f, err := openTestPdf("filter_ccitt_fax_decode.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -77,92 +907,181 @@ func TestEmptyDictionary(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	// read the object
-	object := parser.GetObject(1)
+	// assert the 1D byte aligned image is correct
+	image := "ffc00000000000000000003ff01f60000000000000000000fff000000000000000000000000000fffffffffffffffffffffffff0bfffffffffffc0000000000000dfffffffffff00000000000030"
+	if stream := hex.EncodeToString(parser.GetObject(2).Stream); stream != image {
+		test.Fatalf("incorrect 1D image %s", stream)
+	}
 
-	// assert value is correct
-	if object.Value.String() != "<<>>" {
-		test.Fatalf("incorrect value %s", object.Value.String())
+	// assert the mixed 1D and 2D image with black as 1 is the inverse
+	inverse := "003fffffffffffffffffffc000e09fffffffffffffffffff0000fffffffffffffffffffffffff0000000000000000000000000004000000000003ffffffffffff0200000000000ffffffffffffc0"
+	if stream := hex.EncodeToString(parser.GetObject(3).Stream); stream != inverse {
+		test.Fatalf("incorrect 2D image %s", stream)
+	}
+
+	// assert the group 4 image is correct
+	if stream := hex.EncodeToString(parser.GetObject(4).Stream); stream != image {
+		test.Fatalf("incorrect group 4 image %s", stream)
 	}
 }
 
-func TestEncrypted(test *testing.T) {
+func TestFilterDecodeBudget(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("encrypted.pdf")
+	f, err := openTestPdf("filter_decode_budget.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer f.Close()
 
-	// load the pdf
-	parser := NewParser(f, nil)
-	err = parser.Load("")
-	if err != nil {
+	// extract the pdf with a 5 MiB document limit, streams are read more than once while extracting
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	parser.DecodeLimits = DecodeLimits{4 << 20, 5 << 20, 0}
+	if err = parser.Extract(""); err != nil {
 		test.Fatal(err)
 	}
 
-	// test string decryption
-	object := parser.GetObject(12)
-	d12, ok := object.Value.(Dictionary)
-	if !ok {
-		test.Fatalf("expected dictionary")
+	// assert the first stream is decoded and the second stops at the 2 MiB left of the document limit
+	sizes := map[int]int{}
+	for _, object := range sink.Result().Objects {
+		sizes[object.Number] = len(object.Stream)
 	}
-	if lang, _ := d12.GetString("Lang"); lang != "en-US" {
-		test.Fatalf("incorrect value %s", lang)
+	if sizes[3] != 3 << 20 || sizes[4] != 2 << 20 {
+		test.Fatalf("incorrect sizes %d %d", sizes[3], sizes[4])
 	}
 
-	// test stream decryption
-	object = parser.GetObject(8)
-	if string(object.Stream[:8]) != "/CIDInit" {
-		test.Fatalf("incorrect value %s", string(object.Stream[:8]))
+	// assert only the second stream is reported
+	codes := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		codes = append(codes, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Object))
+	}
+	if c := strings.Join(codes, ","); c != "decode_limit_exceeded:4" {
+		test.Fatalf("incorrect anomalies %s", c)
 	}
 }
 
-func TestFilterASCII85Decode(test *testing.T) {
+func TestFilterDecodeLimits(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("filter_ascii_85_decode.pdf")
+	f, err := openTestPdf("filter_decode_limits.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer f.Close()
 
-	// load the pdf
-	parser := NewParser(f, nil)
+	// load the pdf with a 4 MiB stream limit and a 5 MiB document limit
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	parser.DecodeLimits = DecodeLimits{4 << 20, 5 << 20, 1000}
 	err = parser.Load("")
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	// read the object
-	object := parser.GetObject(1)
+	// assert the strict and revision views use the same limits
+	if view := parser.newView(f, nil); view.DecodeLimits != parser.DecodeLimits {
+		test.Fatalf("incorrect view limits %v", view.DecodeLimits)
+	}
 
-	// assert value is correct
-	if string(object.Stream) != "\x00\x00\x00\x00%!FontType" {
-		test.Fatalf("incorrect value %s", string(object.Stream))
+	// assert each stream stops at its limit and keeps the data decoded before it
+	for _, test_case := range []struct{number int; size int; status string}{
+		{2, 1 << 20, FilterPartial},
+		{3, 4 << 20, FilterPartial},
+		{4, 20, FilterFailed},
+	} {
+		object := parser.GetObject(test_case.number)
+		if len(object.Stream) != test_case.size {
+			test.Fatalf("incorrect size %d %d", test_case.number, len(object.Stream))
+		}
+		if status := object.Filters[len(object.Filters) - 1].Status; status != test_case.status {
+			test.Fatalf("incorrect status %d %s", test_case.number, status)
+		}
+	}
+
+	// assert the limits and the repeated filter are reported
+	codes := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		codes = append(codes, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Object))
+		if anomaly.Code == DecodeLimitExceeded.Code && anomaly.Object == 3 && anomaly.Message != "stream decoding stopped at a decode limit (FlateDecode stream size limit, 4608 bytes decoded to 4194304 bytes, ratio 910.2)" {
+			test.Fatalf("incorrect message %s", anomaly.Message)
+		}
+	}
+	if c := strings.Join(codes, ","); c != "repeated_filter:2,decode_limit_exceeded:2,decode_limit_exceeded:3,decode_limit_exceeded:4" {
+		test.Fatalf("incorrect anomalies %s", c)
+	}
+
+	// load a flate chain whose first layer reaches a 1 MiB stream limit
+	f2, err := openTestPdf("filter_decode_limit_chain.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f2.Close()
+	sink = NewMemorySink()
+	parser = NewParser(f2, sink)
+	parser.DecodeLimits = DecodeLimits{1 << 20, 0, 0}
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the layer after the limit is skipped instead of failing on the data cut short by the limit
+	object := parser.GetObject(3)
+	if len(object.Stream) != 1 << 20 || object.Filters[0].Status != FilterPartial || object.Filters[1].Status != FilterSkipped {
+		test.Fatalf("incorrect filters %d %v", len(object.Stream), object.Filters)
+	}
+	codes = []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		codes = append(codes, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Object))
+	}
+	if c := strings.Join(codes, ","); c != "repeated_filter:3,decode_limit_exceeded:3" {
+		test.Fatalf("incorrect anomalies %s", c)
 	}
 }
 
-func TestFilterASCIIHexDecode(test *testing.T) {
+func TestFilterErrors(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("filter_ascii_hex_decode.pdf")
+	f, err := openTestPdf("filter_errors.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer f.Close()
 
 	// load the pdf
-	parser := NewParser(f, nil)
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
 	err = parser.Load("")
 	if err != nil {
 		test.Fatal(err)
 	}
 
-	// read the object
-	object := parser.GetObject(1)
+	// assert the outcome of each filter and the decoded data are correct
+	for _, test_case := range []struct{number int; stream string; filters string}{
+		{2, strings.Repeat("hello world\n", 5), "AHx:ASCIIHexDecode:decoded:47,Fl:FlateDecode:decoded:23"},
+		{3, strings.Repeat("hello world, ", 20) + "hello world,", "FlateDecode:FlateDecode:partial:20"},
+		{4, "not compressed", "FlateDecode:FlateDecode:failed:0,ASCIIHexDecode:ASCIIHexDecode:skipped:0"},
+		{5, "ABC", "ASCIIHexDecode:ASCIIHexDecode:decoded:7,FooDecode:FooDecode:unknown:0,FlateDecode:FlateDecode:skipped:0"},
+		{6, "\xff\xd8\xff\xe0", "DCTDecode:DCTDecode:undecoded:0,FlateDecode:FlateDecode:skipped:0"},
+		{7, "Helloabc", "RunLengthDecode:RunLengthDecode:partial:6"},
+	} {
+		object := parser.GetObject(test_case.number)
+		if string(object.Stream) != test_case.stream {
+			test.Fatalf("incorrect stream %d %q", test_case.number, string(object.Stream))
+		}
+		filters := []string{}
+		for _, result := range object.Filters {
+			filters = append(filters, fmt.Sprintf("%s:%s:%s:%d", result.Name, result.Filter, result.Status, result.Offset))
+		}
+		if f := strings.Join(filters, ","); f != test_case.filters {
+			test.Fatalf("incorrect filters %d %s", test_case.number, f)
+		}
+	}
 
-	// assert value is correct
-	if string(object.Stream) != "Hellop" {
-		test.Fatalf("incorrect value %s", string(object.Stream))
+	// assert the anomalies are correct, each abbreviated filter of object 2 is kept
+	codes := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		codes = append(codes, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Object))
+	}
+	if c := strings.Join(codes, ","); c != "abbreviated_filter:2,abbreviated_filter:2,filter_decode_error:3,filter_decode_error:4,unknown_filter:5,filter_decode_error:7" {
+		test.Fatalf("incorrect anomalies %s", c)
 	}
 }
 
@@ -190,6 +1109,142 @@ func TestFilterFlateDecode(test *testing.T) {
 	}
 }
 
+func TestFilterFlateRecovery(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("filter_flate_recovery.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert streams with a bad header or checksum are decoded
+	for i := 2; i < 6; i++ {
+		if stream := string(parser.GetObject(i).Stream); stream != strings.Repeat("hello world\n", 5) {
+			test.Fatalf("incorrect stream %d %s", i, stream)
+		}
+	}
+
+	// assert the prefix before the corrupt tail is kept
+	object := parser.GetObject(6)
+	if stream := string(object.Stream); !strings.HasPrefix(stream, "line 0\nline 1\n") || !strings.Contains(stream, "line 190\n") {
+		test.Fatalf("incorrect prefix %s", stream)
+	}
+	if object.Filters[0].Status != FilterPartial {
+		test.Fatalf("incorrect status %s", object.Filters[0].Status)
+	}
+
+	// assert each recovery is reported
+	codes := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		codes = append(codes, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Object))
+	}
+	if c := strings.Join(codes, ","); c != "flate_invalid_header:2,flate_invalid_header:3,flate_checksum_mismatch:4,flate_missing_checksum:5,filter_decode_error:6" {
+		test.Fatalf("incorrect anomalies %s", c)
+	}
+}
+
+func TestFilterJBIG2Decode(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("filter_jbig2_decode.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the text, generic and refinement regions using the global symbols are correct
+	page1 := "ffffffffff8e71ffffffddb6ffb6dfdc31ffedb7ddb6ffdb6f8db1ff8007ffffff8007ffffff8007cffff1ffffcffff6fffffffff1fffffffff6fffffffff1ffffffffffffff7ffffffffffffffffffffeffffffffffffffffffffffffffff0000ffffff"
+	if stream := hex.EncodeToString(parser.GetObject(3).Stream); stream != page1 {
+		test.Fatalf("incorrect page 1 %s", stream)
+	}
+
+	// assert the refined and aggregated symbols, mmr region and region of unknown length are correct
+	page2 := "1c03a03c6eafc03c0eafe03c6eafe03c6c03fffcffd3fffcffffdddcffffeeecfffff77cfffffbbcfffffffcfffffffc"
+	if stream := hex.EncodeToString(parser.GetObject(4).Stream); stream != page2 {
+		test.Fatalf("incorrect page 2 %s", stream)
+	}
+
+	// assert the bad segments are reported
+	parser.GetObject(5)
+	parser.GetObject(6)
+	codes := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		codes = append(codes, fmt.Sprintf("%s:%d", anomaly.Code, anomaly.Object))
+	}
+	if c := strings.Join(codes, ","); c != "jbig2_symbol_out_of_range:5,jbig2_unusual_segment:5,jbig2_unsupported_segment:5,jbig2_unknown_segment:5,jbig2_oversized_bitmap:6,filter_decode_error:6" {
+		test.Fatalf("incorrect anomalies %s", c)
+	}
+
+	// assert decoding stops when the symbols, regions and page together exceed the stream limit
+	parser = NewParser(f, nil)
+	parser.DecodeLimits = DecodeLimits{200, 0, 0}
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+	object := parser.GetObject(3)
+	if stream := hex.EncodeToString(object.Stream); stream != strings.Repeat("ff", 100) {
+		test.Fatalf("incorrect limited page 1 %s", stream)
+	}
+	if object.Filters[0].Status != FilterPartial {
+		test.Fatalf("incorrect status %s", object.Filters[0].Status)
+	}
+}
+
+func TestFilterJBIG2Huffman(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("filter_jbig2_huffman.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the huffman coded dictionaries and the text regions using standard and custom tables are correct
+	page := "8ff17fffffffde767fffffffddb17fffffffdc367fffffff8db17ffffffffdb27ffffffffffffffffffffffffffffffffffff9ffffffcffff6c7ffffcffff0effffffffff6effffffffff6efffffffffffc7ffffffffffffffff1c47bdffffff6ed77effffff0ec7bdffffff6effffffffff6c7fffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	if stream := hex.EncodeToString(parser.GetObject(2).Stream); stream != page {
+		test.Fatalf("incorrect page %s", stream)
+	}
+
+	// assert the bad codes and tables are reported
+	parser.GetObject(3)
+	anomalies := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		anomalies = append(anomalies, fmt.Sprintf("%s:%d:%s", anomaly.Code, anomaly.Object, anomaly.Message))
+	}
+	expected := []string{
+		"jbig2_invalid_segment:3:invalid jbig2 segment (segment 3, invalid symbol code at instance 0)",
+		"jbig2_invalid_segment:3:invalid jbig2 segment (segment 4, missing custom table)",
+		"jbig2_invalid_segment:3:invalid jbig2 segment (segment 5, truncated tables)",
+		"jbig2_symbol_out_of_range:3:jbig2 symbol reference is out of range (segment 7, symbol 3 of 3)",
+	}
+	if a := strings.Join(anomalies, ","); a != strings.Join(expected, ",") {
+		test.Fatalf("incorrect anomalies %s", a)
+	}
+}
+
 func TestFilterLZWDecode(test *testing.T) {
 	// open the pdf
 	f, err := openTestPdf("filter_lzw_decode.pdf")
@@ -335,24 +1390,145 @@ func TestMaxCmapSize(test *testing.T) {
 			test.Fatal(err)
 		}
 
-		// read the object
-		object := parser.GetObject(1)
-		if d, ok := object.Value.(Dictionary); ok {
-			NewFont(d)
+		// read the object
+		object := parser.GetObject(1)
+		if d, ok := object.Value.(Dictionary); ok {
+			NewFont(d)
+		}
+	}()
+
+	// wait until done or timed out
+	select {
+		case <-done:
+		case <-time.After(time.Second):
+			test.Fatal("timed out")
+	}
+}
+
+func TestMemorySink(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("report.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// parse the pdf into two memory sinks
+	sink1 := NewMemorySink()
+	sink2 := NewMemorySink()
+	if err = ParseReader(f, "", NewMultiSink(sink1, sink2)); err != nil {
+		test.Fatal(err)
+	}
+
+	// assert both sinks have the results
+	for _, sink := range []*MemorySink{sink1, sink2} {
+		result := sink.Result()
+		if result.Report.File.Size != 527 || result.Report.File.Path != f.Name() {
+			test.Fatalf("incorrect file summary %v", result.Report.File)
+		}
+		if len(result.Report.Scripts) != 1 || result.Report.Scripts[0].Script != "app.alert(1)" {
+			test.Fatalf("incorrect scripts %v", result.Report.Scripts)
+		}
+		if len(result.Report.URLs) != 1 || len(result.Report.Commands) != 1 || len(result.Report.Anomalies) == 0 {
+			test.Fatalf("missing findings %v", result.Report)
+		}
+		if len(result.Objects) != 4 || result.Objects[0].Number != 1 {
+			test.Fatalf("incorrect objects %v", result.Objects)
+		}
+	}
+}
+
+func TestNames(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("names.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// read object
+	object := parser.GetObject(1)
+
+	// assert value is correct
+	if object.Value.String() != "/Hello /World!\x00qz" {
+		test.Fatalf("incorrect value %s", object.Value.String())
+	}
+}
+
+func TestObjectStream(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("object_stream.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// read the compressed object
+	object := parser.GetObject(3)
+
+	// assert value is correct
+	if object.Value.String() != "(Hello World!)" {
+		test.Fatalf("incorrect value %s", object.Value.String())
+	}
+
+	// read the compressed catalog
+	object = parser.GetObject(2)
+	d, ok := object.Value.(Dictionary)
+	if !ok {
+		test.Fatal("expected dictionary")
+	}
+
+	// assert reference in compressed object resolves
+	if message, _ := d.GetString("Message"); message != "Hello World!" {
+		test.Fatalf("incorrect value %s", message)
+	}
+}
+
+func TestObjectStreamBadOffset(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("object_stream_bad_offset.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert objects with overflowed or negative offsets are null
+	for _, number := range []int{3, 4} {
+		if object := parser.GetObject(number); object.Value != KEYWORD_NULL {
+			test.Fatalf("incorrect value %d %s", number, object.Value.String())
 		}
-	}()
+	}
 
-	// wait until done or timed out
-	select {
-		case <-done:
-		case <-time.After(time.Second):
-			test.Fatal("timed out")
+	// assert the objects with valid offsets are read
+	if object := parser.GetObject(5); object.Value.String() != "(Hello World!)" {
+		test.Fatalf("incorrect value %s", object.Value.String())
 	}
 }
 
-func TestNames(test *testing.T) {
+func TestObjectStreamRepair(test *testing.T) {
 	// open the pdf
-	f, err := openTestPdf("names.pdf")
+	f, err := openTestPdf("object_stream_repair.pdf")
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -365,15 +1541,56 @@ func TestNames(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	// read object
-	object := parser.GetObject(1)
+	// assert xref length is correct
+	if len(parser.Xref) != 3 {
+		test.Fatalf("%d != 3", len(parser.Xref))
+	}
+
+	// read the compressed object
+	object := parser.GetObject(3)
 
 	// assert value is correct
-	if object.Value.String() != "/Hello /World!\x00qz" {
+	if object.Value.String() != "(Hello World!)" {
 		test.Fatalf("incorrect value %s", object.Value.String())
 	}
 }
 
+func TestPolyglot(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("polyglot.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// extract the pdf
+	sink := NewMemorySink()
+	if err = ParseReader(f, "", sink); err != nil {
+		test.Fatal(err)
+	}
+	result := sink.Result()
+
+	// assert the png before the header, the pe, html and jar between and after the objects and the zip directory at the end are found
+	formats := []string{}
+	for _, format := range result.Report.Formats {
+		formats = append(formats, fmt.Sprintf("%s:%d:%s", format.Format, format.Offset, format.Region))
+	}
+	if f := strings.Join(formats, ","); f != "png:0:start,pe:65:uncovered,html:137:uncovered,script:143:uncovered,jar:348:uncovered,jar:486:end" {
+		test.Fatalf("incorrect formats %s", f)
+	}
+
+	// assert each format is reported
+	count := 0
+	for _, anomaly := range result.Report.Anomalies {
+		if anomaly.Code == "polyglot_format" {
+			count++
+		}
+	}
+	if count != 6 {
+		test.Fatalf("incorrect anomalies %v", result.Report.Anomalies)
+	}
+}
+
 func TestReference(test *testing.T) {
 	// open the pdf
 	f, err := openTestPdf("reference.pdf")
@@ -489,6 +1706,153 @@ func TestReferenceNull(test *testing.T) {
 	}
 }
 
+func TestReport(test *testing.T) {
+	// get the pdf path
+	f, err := openTestPdf("report.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	f.Close()
+
+	// parse the pdf
+	output_dir, err := ioutil.TempDir("", "pdfparser")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(output_dir)
+	if err = Parse(f.Name(), "", output_dir); err != nil {
+		test.Fatal(err)
+	}
+
+	// read the report
+	data, err := ioutil.ReadFile(filepath.Join(output_dir, "report.json"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var report Report
+	if err = json.Unmarshal(data, &report); err != nil {
+		test.Fatal(err)
+	}
+	if report.Version != ReportVersion {
+		test.Fatalf("incorrect version %d", report.Version)
+	}
+
+	// assert findings are traced back to their objects
+	if len(report.Scripts) != 1 || report.Scripts[0].Script != "app.alert(1)" {
+		test.Fatalf("incorrect scripts %v", report.Scripts)
+	}
+	script := report.Scripts[0]
+	if script.Object != 3 || script.Offset != 125 || strings.Join(script.Path, ",") != "Root,OpenAction,JS" {
+		test.Fatalf("incorrect script location %d %d %v", script.Object, script.Offset, script.Path)
+	}
+	if len(report.URLs) != 1 || report.URLs[0].URL != "http://example.com/" || report.URLs[0].Object != 4 {
+		test.Fatalf("incorrect urls %v", report.URLs)
+	}
+	if strings.Join(report.URLs[0].Path, ",") != "Root,Pages,Kids,0,Annots,0,A,URI" {
+		test.Fatalf("incorrect url path %v", report.URLs[0].Path)
+	}
+	if len(report.Commands) != 1 || report.Commands[0].Command != "cmd.exe /c calc" {
+		test.Fatalf("incorrect commands %v", report.Commands)
+	}
+	if len(report.Files) != 1 || report.Files[0].Name != "cmd.exe" || report.Files[0].Extracted {
+		test.Fatalf("incorrect files %v", report.Files)
+	}
+
+	// assert anomalies are located and deduplicated
+	if len(report.Anomalies) != 1 {
+		test.Fatalf("incorrect anomalies %v", report.Anomalies)
+	}
+	anomaly := report.Anomalies[0]
+	if anomaly.Code != UnnecessaryEscapeName.Code || anomaly.Severity != SeverityInfo || anomaly.Offset != 356 || anomaly.Object != 4 {
+		test.Fatalf("incorrect anomaly %v", anomaly)
+	}
+	if anomaly.Count < 2 || !strings.Contains(anomaly.Context, "/Unnecessary#41") {
+		test.Fatalf("incorrect anomaly count %d or context %s", anomaly.Count, anomaly.Context)
+	}
+
+	// assert errors.txt has one line per anomaly
+	data, err = ioutil.ReadFile(filepath.Join(output_dir, "errors.txt"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "info:unnecessary_escape_name:356:4:0:") || strings.Count(string(data), "\n") != 1 {
+		test.Fatalf("incorrect errors.txt %s", string(data))
+	}
+}
+
+func TestAnomalyDetails(test *testing.T) {
+	// add anomalies of the same type at the same location with different details
+	report := NewReport()
+	for _, name := range []string{"FooDecode", "BarDecode", "FooDecode"} {
+		report.addAnomaly(NewAnomaly(UnknownFilter.withDetail("%s", name), Location{}, ""))
+	}
+
+	// assert each detail is kept and repeated details are counted
+	if len(report.Anomalies) != 2 {
+		test.Fatalf("incorrect anomalies %v", report.Anomalies)
+	}
+	for i, test_case := range []struct{name string; count int}{
+		{"FooDecode", 2},
+		{"BarDecode", 1},
+	} {
+		anomaly := report.Anomalies[i]
+		if !strings.Contains(anomaly.Message, test_case.name) || anomaly.Count != test_case.count {
+			test.Fatalf("incorrect anomaly %s %d", anomaly.Message, anomaly.Count)
+		}
+	}
+}
+
+func TestRevisions(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("revisions.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// assert the changes of each revision
+	parser := NewParser(f, nil)
+	revisions := parser.Revisions()
+	if len(revisions) != 3 {
+		test.Fatalf("incorrect number of revisions %d", len(revisions))
+	}
+	changes := []string{"[1 2 3 4] [] []", "[5] [3] []", "[6] [] [4]"}
+	for i, revision := range revisions {
+		if c := fmt.Sprint(revision.Added, " ", revision.Modified, " ", revision.Freed); c != changes[i] {
+			test.Fatalf("incorrect changes in revision %d: %s", i, c)
+		}
+	}
+
+	// assert each revision only sees its own objects
+	values := []string{"Original", "Updated", "Updated"}
+	for i := range revisions {
+		revision_parser, err := parser.OpenRevision(i)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if err = revision_parser.Load(""); err != nil {
+			test.Fatal(err)
+		}
+		if s, ok := revision_parser.GetObject(3).Value.(String); !ok || string(s) != values[i] {
+			test.Fatalf("incorrect value in revision %d: %v", i, revision_parser.GetObject(3).Value)
+		}
+	}
+
+	// assert the first revision is truncated after its %%EOF
+	var buffer bytes.Buffer
+	if err = parser.WriteRevision(0, &buffer); err != nil {
+		test.Fatal(err)
+	}
+	if int64(buffer.Len()) != revisions[0].EndOffset || !bytes.HasSuffix(buffer.Bytes(), []byte("%%EOF\n")) {
+		test.Fatalf("incorrect revision data length %d", buffer.Len())
+	}
+
+	// assert missing revisions are an error
+	if _, err = parser.OpenRevision(3); err != RevisionNotFoundError {
+		test.Fatalf("incorrect error %v", err)
+	}
+}
+
 func TestCarriageReturn(test *testing.T) {
 	// open the pdf
 	f, err := openTestPdf("carriage_return.pdf")
@@ -513,6 +1877,84 @@ func TestCarriageReturn(test *testing.T) {
 	}
 }
 
+func TestStreamLength(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("stream_length.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert indirect lengths are resolved
+	if s := string(parser.GetObject(1).Stream); s != "hello" {
+		test.Fatalf("incorrect stream %q", s)
+	}
+
+	// assert the length is used when the data contains an endstream marker
+	if s := string(parser.GetObject(3).Stream); s != "abc\nendstream\nxyz\x00\x01" {
+		test.Fatalf("incorrect stream %q", s)
+	}
+
+	// assert the data is scanned if the endstream marker does not follow the length
+	if s := string(parser.GetObject(4).Stream); s != "hello smuggled" {
+		test.Fatalf("incorrect stream %q", s)
+	}
+	if s := string(parser.GetObject(5).Stream); s != "self" {
+		test.Fatalf("incorrect stream %q", s)
+	}
+
+	// assert the mismatch is reported at the declared end of the stream
+	anomalies := sink.Result().Report.Anomalies
+	if len(anomalies) != 1 || anomalies[0].Code != "stream_length_mismatch" || anomalies[0].Offset != 187 || !strings.Contains(anomalies[0].Message, "declared 5, found 14") {
+		test.Fatalf("incorrect anomalies %v", anomalies)
+	}
+}
+
+func TestStreamLengthCompressed(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("stream_length_compressed.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	sink := NewMemorySink()
+	parser := NewParser(f, sink)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert lengths in an object stream are resolved
+	for _, test_case := range []struct{number int; stream string}{
+		{1, "hello"},
+		{2, "hello smuggled"},
+	} {
+		object := parser.GetObject(test_case.number)
+		if string(object.Stream) != test_case.stream {
+			test.Fatalf("incorrect stream %d %q", test_case.number, string(object.Stream))
+		}
+	}
+	if _, ok := parser.GetObject(3).Value.(Dictionary); !ok {
+		test.Fatal("expected catalog in the object stream whose length is in itself")
+	}
+
+	// assert the compressed length that disagrees with the data is reported
+	anomalies := sink.Result().Report.Anomalies
+	if len(anomalies) != 1 || anomalies[0].Code != "stream_length_mismatch" || anomalies[0].Object != 2 || !strings.Contains(anomalies[0].Message, "declared 5, found 14") {
+		test.Fatalf("incorrect anomalies %v", anomalies)
+	}
+}
+
 func TestStrings(test *testing.T) {
 	// open the pdf
 	f, err := openTestPdf("strings.pdf")
@@ -1021,6 +2463,88 @@ func TestUnclosedStringOctal2(test *testing.T) {
 	}
 }
 
+func TestXrefEmptyChain(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("object_stream_repair.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// extract the pdf
+	sink := NewMemorySink()
+	if err = ParseReader(f, "", sink); err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the startxref chain without xref sections is reported once instead of once per object
+	codes := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		if strings.HasPrefix(anomaly.Code, "xref_") {
+			codes = append(codes, fmt.Sprintf("%s:%s", anomaly.Code, anomaly.Message))
+		}
+	}
+	if c := strings.Join(codes, ","); c != "xref_empty_chain:startxref chain has no xref sections (3 objects are only found by scanning)" {
+		test.Fatalf("incorrect anomalies %s", c)
+	}
+}
+
+func TestXrefHybrid(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("xref_hybrid.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert objects that are free in the table are found in the supplemental xref stream
+	if xref_entry, ok := parser.Xref[5]; !ok || xref_entry.Type != XrefTypeCompressedObject {
+		test.Fatal("object 5 is not compressed")
+	}
+	if s, ok := parser.GetObject(5).Value.(String); !ok || string(s) != "Hello World!" {
+		test.Fatalf("incorrect value %v", parser.GetObject(5).Value)
+	}
+	if d, ok := parser.GetObject(6).Value.(Dictionary); !ok || d.String() != "<</Producer (Word)>>" {
+		test.Fatalf("incorrect value %v", parser.GetObject(6).Value)
+	}
+
+	// assert entries in use in the table take precedence over the supplemental xref stream
+	if s, ok := parser.GetObject(3).Value.(String); !ok || string(s) != "table" {
+		test.Fatalf("incorrect value %v", parser.GetObject(3).Value)
+	}
+}
+
+func TestXrefHybridUpdate(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("xref_hybrid_update.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the update overrides the supplemental xref stream of the previous section
+	if s, ok := parser.GetObject(5).Value.(String); !ok || string(s) != "Updated" {
+		test.Fatalf("incorrect value %v", parser.GetObject(5).Value)
+	}
+	if d, ok := parser.GetObject(6).Value.(Dictionary); !ok || d.String() != "<</Producer (Word)>>" {
+		test.Fatalf("incorrect value %v", parser.GetObject(6).Value)
+	}
+}
+
 func TestXrefLoop(test *testing.T) {
 	// create a done signal channel
 	done := make(chan bool, 1)
@@ -1165,3 +2689,92 @@ func TestXrefTableChain(test *testing.T) {
 		test.Fatal("xref length != 10")
 	}
 }
+
+func TestXrefValidEntry(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("xref_valid_entry.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the xref entry that points at the object is not replaced by the stray definition after it
+	object := parser.GetObject(2)
+	if object.Value.String() != "(Original)" {
+		test.Fatalf("incorrect value %s", object.Value.String())
+	}
+}
+
+func TestXrefValidEntryProducer(test *testing.T) {
+	// open a pdf written by pdfTeX
+	f, err := openTestPdf("pdftex.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// load only the startxref chain
+	strict := NewParser(f, nil)
+	start_xref_offset, ok := strict.getStartXrefOffset()
+	if !ok {
+		test.Fatal("missing startxref")
+	}
+	strict.loadXref(start_xref_offset, map[int64]interface{}{})
+
+	// load the pdf
+	parser := NewParser(f, nil)
+	err = parser.Load("")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// assert no xref entry of the chain is moved by the repair
+	for number, xref_entry := range strict.Xref {
+		if parser.Xref[number].Offset != xref_entry.Offset || parser.Xref[number].Type != xref_entry.Type {
+			test.Fatalf("xref entry %d moved from %d to %d", number, xref_entry.Offset, parser.Xref[number].Offset)
+		}
+	}
+}
+
+func TestXrefView(test *testing.T) {
+	// open the pdf
+	f, err := openTestPdf("xref_view.pdf")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	// extract the pdf
+	sink := NewMemorySink()
+	if err = ParseReader(f, "", sink); err != nil {
+		test.Fatal(err)
+	}
+
+	// assert the strict view has the wrong object 2 and no object 4
+	strict := NewParser(f, nil)
+	if err = strict.LoadStrict(""); err != nil {
+		test.Fatal(err)
+	}
+	if s, ok := strict.GetObject(2).Value.(String); !ok || string(s) != "Three" {
+		test.Fatalf("incorrect strict value %v", strict.GetObject(2).Value)
+	}
+	if _, ok := strict.Xref[4]; ok {
+		test.Fatal("object 4 is in the strict view")
+	}
+
+	// assert the differences are reported at the recovered objects
+	anomalies := []string{}
+	for _, anomaly := range sink.Result().Report.Anomalies {
+		anomalies = append(anomalies, fmt.Sprintf("%s:%d:%d", anomaly.Code, anomaly.Object, anomaly.Offset))
+	}
+	if a := strings.Join(anomalies, ","); a != "xref_wrong_object:2:83,xref_missing_object:4:154" {
+		test.Fatalf("incorrect anomalies %s", a)
+	}
+}
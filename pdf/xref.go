@@ -1,5 +1,6 @@
 package pdf
 
+// compressed objects use Offset as the object stream number and Generation as the index in the object stream
 const (
 	XrefTypeFreeObject = iota
 	XrefTypeIndirectObject
@@ -12,8 +13,9 @@ type XrefEntry struct {
 	Type int
 	IsEncrypted bool
 	IsXrefStream bool
+	IsObjectStream bool
 }
 
 func NewXrefEntry(offset int64, generation int, type_value int) *XrefEntry {
-	return &XrefEntry{offset, generation, type_value, true, false}
+	return &XrefEntry{offset, generation, type_value, true, false, false}
 }
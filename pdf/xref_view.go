@@ -0,0 +1,169 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// XrefDifference is an object that resolves differently in the strict and recovered views of a pdf
+// the strict view only uses the startxref chain, the recovered view is the one Load uses
+type XrefDifference struct {
+	Object int
+	Type AnomalyType
+
+	// Strict and Recovered are the xref entries of the object in each view, nil if the object is not in the view
+	Strict *XrefEntry
+	Recovered *XrefEntry
+}
+
+// LoadStrict loads only the xref sections in the startxref chain
+// objects are not scanned for and broken xref entries are not repaired
+func (parser *Parser) LoadStrict(password string) error {
+	if start_xref_offset, ok := parser.getStartXrefOffset(); ok {
+		parser.loadXref(start_xref_offset, map[int64]interface{}{})
+	}
+	return parser.loadEncryption(password)
+}
+
+// XrefDifferences compares the loaded parser to a strict view of the same pdf and returns the objects that resolve differently
+// objects with the same xref entries in both views are not read, streams are only decoded if their encoded data differs
+// if the startxref chain has no xref sections a single XrefEmptyChain difference with object 0 is returned
+func (parser *Parser) XrefDifferences(password string) []XrefDifference {
+	differences := []XrefDifference{}
+
+	// load the strict view, anomalies are reported by the recovered view
+	strict := parser.newView(parser.seeker, nil)
+	if err := strict.LoadStrict(password); err != nil {
+		strict = parser.newView(parser.seeker, nil)
+	}
+
+	// every object is missing from an empty startxref chain
+	strict_numbers := strict.objectNumbers()
+	recovered_numbers := parser.objectNumbers()
+	if len(strict.Xref) == 0 {
+		if len(recovered_numbers) > 0 {
+			differences = append(differences, XrefDifference{0, XrefEmptyChain, nil, nil})
+		}
+		return differences
+	}
+
+	// compare every object in either view in order
+	numbers := []int{}
+	for number := range strict_numbers {
+		numbers = append(numbers, number)
+	}
+	for number := range recovered_numbers {
+		if _, ok := strict_numbers[number]; !ok {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		_, in_strict := strict_numbers[number]
+		_, in_recovered := recovered_numbers[number]
+		strict_entry := strict.Xref[number]
+		recovered_entry := parser.Xref[number]
+
+		if !in_strict {
+			differences = append(differences, XrefDifference{number, XrefMissingObject, nil, recovered_entry})
+			continue
+		}
+		if !in_recovered {
+			differences = append(differences, XrefDifference{number, XrefValueMismatch, strict_entry, nil})
+			continue
+		}
+
+		// objects at the same place in both views resolve to the same value
+		if sameXrefEntry(strict, parser, number) {
+			continue
+		}
+
+		// objects that resolve to the same value are not differences, streams that are encoded differently may decode the same
+		strict_object := strict.getRawObject(number)
+		recovered_object := parser.getRawObject(number)
+		changes := []ValueChange{}
+		diffValues(strict_object.Value, recovered_object.Value, []string{}, &changes)
+		if len(changes) == 0 && !bytes.Equal(strict_object.Stream, recovered_object.Stream) {
+			strict_object = strict.GetObject(number)
+			recovered_object = parser.GetObject(number)
+		}
+		if len(changes) == 0 && bytes.Equal(strict_object.Stream, recovered_object.Stream) {
+			continue
+		}
+
+		// determine why the values differ
+		difference := XrefDifference{number, XrefValueMismatch, strict_entry, recovered_entry}
+		if strict_entry.Type == XrefTypeIndirectObject && !strict.isObjectAt(number, strict_entry.Offset) {
+			difference.Type = XrefWrongObject
+		} else if strict_entry.Type != recovered_entry.Type || strict_entry.Offset != recovered_entry.Offset || strict_entry.Generation != recovered_entry.Generation {
+			difference.Type = XrefRepairedOffset
+		}
+		differences = append(differences, difference)
+	}
+
+	return differences
+}
+
+// sameXrefEntry returns true if an object has the same xref entry in both views, and so does the object stream of a compressed object
+func sameXrefEntry(strict *Parser, recovered *Parser, number int) bool {
+	strict_entry, recovered_entry := strict.Xref[number], recovered.Xref[number]
+	if strict_entry == nil || recovered_entry == nil || strict_entry.Type != recovered_entry.Type || strict_entry.Offset != recovered_entry.Offset || strict_entry.Generation != recovered_entry.Generation {
+		return false
+	}
+	if strict_entry.Type == XrefTypeCompressedObject {
+		object_stream_number := int(strict_entry.Offset)
+		return strict.Xref[object_stream_number] != nil && strict.Xref[object_stream_number].Type == XrefTypeIndirectObject && sameXrefEntry(strict, recovered, object_stream_number)
+	}
+	return true
+}
+
+// getRawObject returns an object with its stream decrypted but not decoded
+func (parser *Parser) getRawObject(number int) *IndirectObject {
+	parser.raw_streams = true
+	defer func() {
+		parser.raw_streams = false
+	}()
+	return parser.GetObject(number)
+}
+
+// logXrefDifferences reports the objects that resolve differently in the strict view as anomalies
+func (parser *Parser) logXrefDifferences(password string) {
+	for _, difference := range parser.XrefDifferences(password) {
+		// an empty startxref chain is reported once at the end of the file
+		if difference.Type == XrefEmptyChain {
+			size, _ := parser.Seek(0, io.SeekEnd)
+			parser.logErrorAt(size, XrefEmptyChain.withDetail("%d objects are only found by scanning", len(parser.objectNumbers())))
+			continue
+		}
+
+		// report at the object in the recovered view, or at the strict xref entry if the object is not in the recovered view
+		if difference.Recovered != nil {
+			parser.location = parser.objectLocation(difference.Object)
+		} else {
+			parser.location = Location{difference.Object, difference.Strict.Generation, 0, difference.Strict.Offset, nil}
+		}
+		if parser.location.ObjectStream == 0 {
+			parser.Seek(parser.location.Offset, io.SeekStart)
+		}
+		parser.log_error(difference.Type)
+	}
+	parser.location = Location{}
+}
+
+// isObjectAt returns true if the object header at offset is the header of object number
+func (parser *Parser) isObjectAt(number int, offset int64) bool {
+	parser.Seek(offset, io.SeekStart)
+	n, _, ok := parser.ReadObjectHeader()
+	return ok && n == number
+}
+
+// newView returns a parser of reader with the same decryption settings and decode limits
+func (parser *Parser) newView(reader io.ReadSeeker, sink Sink) *Parser {
+	view := NewParser(reader, sink)
+	view.DecodeLimits = parser.DecodeLimits
+	view.security_handler.SetEncryptionKey(parser.security_handler.known_key)
+	view.security_handler.SetCertificate(parser.security_handler.certificate, parser.security_handler.private_key)
+	return view
+}
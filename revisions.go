@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/KarmaPenny/pdfparser/pdf"
+	"os"
+)
+
+func revisionsUsage() {
+	fmt.Fprintln(os.Stderr, "PDF Parser - Lists the incremental updates of a PDF file")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Usage: pdfparser revisions [OPTION]... [FILE]")
+	fmt.Fprintln(os.Stderr, "Example: pdfparser revisions -x 0 -o original.pdf input.pdf")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "  -o        output file for the extracted revision (default: stdout)")
+	fmt.Fprintln(os.Stderr, "  -x        extract the revision with this number instead of listing revisions")
+}
+
+func revisions(args []string) {
+	// parse command line
+	flags := flag.NewFlagSet("revisions", flag.ExitOnError)
+	output := flags.String("o", "", "output file")
+	extract := flags.Int("x", -1, "revision to extract")
+	flags.Usage = revisionsUsage
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		revisionsUsage()
+		os.Exit(1)
+	}
+
+	// open the pdf
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	defer file.Close()
+	parser := pdf.NewParser(file, nil)
+
+	// list the revisions: number, xref offset, end offset and the objects added, modified and freed
+	if *extract < 0 {
+		for _, revision := range parser.Revisions() {
+			fmt.Printf("%d:%d:%d:added %v:modified %v:freed %v\n", revision.Number, revision.XrefOffset, revision.EndOffset, revision.Added, revision.Modified, revision.Freed)
+		}
+		return
+	}
+
+	// write the revision to stdout or the output file
+	writer := os.Stdout
+	if *output != "" {
+		if writer, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer writer.Close()
+	}
+	if err = parser.WriteRevision(*extract, writer); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}